@@ -0,0 +1,78 @@
+// Command render renders the Talos machine configurations of every pool of a stack offline.
+// The configurations are validated like in a deployment and their secrets are redacted.
+//
+//	go run ./cmd/render --stack-config Pulumi.dev.yaml
+//	go run ./cmd/render --stack-config Pulumi.dev.yaml --diff
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/render"
+)
+
+func main() {
+	stackConfig := flag.String("stack-config", "", "stack config file to render, e.g. Pulumi.dev.yaml")
+	out := flag.String("out", "", "directory of the rendered configurations (default out/render/<stack>)")
+	diff := flag.Bool("diff", false, "print the changes to the render in the output directory instead of writing it, exits with 1 on changes")
+	flag.Parse()
+
+	if *stackConfig == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *out == "" {
+		stack := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(*stackConfig), "Pulumi."), ".yaml")
+		*out = filepath.Join("out", "render", stack)
+	}
+
+	changed, err := run(*stackConfig, *out, *diff)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if changed {
+		os.Exit(1)
+	}
+}
+
+// run renders the stack config into the output directory, with diff it prints the changes and reports if there are any
+func run(stackConfig, out string, diff bool) (bool, error) {
+	cfg, err := render.LoadStackConfig(stackConfig)
+	if err != nil {
+		return false, err
+	}
+
+	files, err := render.MachineConfigurations(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	if !diff {
+		err = files.Write(out)
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("rendered %d machine configurations to %s\n", len(files), out)
+
+		return false, nil
+	}
+
+	previous, err := render.ReadFiles(out)
+	if err != nil {
+		return false, err
+	}
+
+	changes, err := files.Diff(previous)
+	if err != nil {
+		return false, err
+	}
+	fmt.Print(changes)
+
+	return changes != "", nil
+}
@@ -0,0 +1,98 @@
+// Package testcert issues short-lived certificates for the in-process test servers.
+package testcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+)
+
+// lifetime is the lifetime of the generated certificates
+const lifetime = time.Hour
+
+// Certificate is a generated certificate with its key, parsed and PEM encoded
+type Certificate struct {
+	Certificate    *x509.Certificate
+	Key            *ecdsa.PrivateKey
+	CertificatePEM []byte
+	KeyPEM         []byte
+}
+
+// NewCA creates a self-signed CA with the given common name
+func NewCA(commonName string) (*Certificate, error) {
+	return newCertificate(nil, commonName, false)
+}
+
+// IssueServer issues a server certificate for 127.0.0.1 signed by the CA
+func (ca *Certificate) IssueServer() (*Certificate, error) {
+	return newCertificate(ca, ca.Certificate.Subject.CommonName, true)
+}
+
+// IssueClient issues a client certificate signed by the CA
+func (ca *Certificate) IssueClient() (*Certificate, error) {
+	return newCertificate(ca, ca.Certificate.Subject.CommonName, false)
+}
+
+// newCertificate creates a server or client certificate signed by the parent,
+// or a self-signed CA if parent is nil.
+func newCertificate(parent *Certificate, commonName string, server bool) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62)) //nolint:mnd // random serial number
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(lifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	signer, signerKey := template, key
+	switch {
+	case parent == nil:
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	case server:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		signer, signerKey = parent.Certificate, parent.Key
+	default:
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		signer, signerKey = parent.Certificate, parent.Key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificate{
+		Certificate:    cert,
+		Key:            key,
+		CertificatePEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:         pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
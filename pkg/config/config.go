@@ -30,6 +30,14 @@ func LoadConfig(ctx *pulumi.Context) (*PulumiConfig, error) {
 
 func GetCustomValidations() []pulumiconfig.Validator {
 	return []pulumiconfig.Validator{
+		pulumiconfig.FieldValidation{
+			Tag:      validators.DurationTag,
+			Validate: validators.ValidateDuration,
+		},
+		pulumiconfig.FieldValidation{
+			Tag:      validators.OneTaintPerKeyTag,
+			Validate: validators.ValidateOneTaintPerKey,
+		},
 		pulumiconfig.StructValidation{
 			Struct:   PulumiConfig{},
 			Validate: validators.ValidateHcloudToken,
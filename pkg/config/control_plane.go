@@ -15,6 +15,15 @@ type ControlPlaneConfig struct {
 	// guarantees provided by the load balancer.
 	DisableLoadBalancer bool `json:"disable_load_balancer"`
 
+	// EndpointMode selects the endpoint of the Kubernetes API.
+	// "load_balancer" puts a Hetzner load balancer in front of the control planes.
+	// "floating_ip" assigns a Hetzner floating IP to one control plane through the Talos VIP, which moves it to another
+	// control plane when the node fails. It never creates a load balancer. Defaults to "load_balancer".
+	EndpointMode string `json:"endpoint_mode" validate:"default=load_balancer,oneof=load_balancer floating_ip"`
+
+	// APIEndpoint exposes the Kubernetes API under a hostname instead of the IP of the load balancer or floating IP.
+	APIEndpoint *APIEndpointConfig `json:"api_endpoint"`
+
 	// Protect the resource from accidental deletion
 	Protect bool `json:"protect"`
 
@@ -29,10 +38,65 @@ type ControlPlaneConfig struct {
 	NodePools []ControlPlaneNodePoolConfig `json:"node_pools" validate:"required"`
 }
 
+const (
+	// EndpointModeLoadBalancer exposes the Kubernetes API through a Hetzner load balancer
+	EndpointModeLoadBalancer = "load_balancer"
+	// EndpointModeFloatingIP exposes the Kubernetes API through a Hetzner floating IP and the Talos VIP
+	EndpointModeFloatingIP = "floating_ip"
+)
+
+// LoadBalancerEnabled returns true if the Kubernetes API is exposed through a load balancer
+func (c *ControlPlaneConfig) LoadBalancerEnabled() bool {
+	return c.EndpointMode != EndpointModeFloatingIP && !c.DisableLoadBalancer
+}
+
+// APIEndpointConfig configures the hostname of the Kubernetes API.
+// The cluster endpoint of the nodes is https://<hostname>:6443, so replacing the load balancer does not change it.
+type APIEndpointConfig struct {
+	// Hostname of the Kubernetes API, e.g. "api.cluster.example.com". It is added to the certificate SANs
+	// of the Kubernetes API server and the Talos API of the control planes.
+	Hostname string `json:"hostname" validate:"required,fqdn"`
+
+	// DNS manages the A and AAAA records of the hostname. If not set, the records are managed outside of the stack.
+	DNS *APIEndpointDNSConfig `json:"dns"`
+}
+
+// APIEndpointDNSConfig configures the DNS records of the API endpoint.
+// The records point at the load balancer, the floating IP or, without any of them, all control plane nodes.
+type APIEndpointDNSConfig struct {
+	// Provider manages the records. Only "hetzner" (Hetzner DNS) is supported. Defaults to "hetzner".
+	Provider string `json:"provider" validate:"default=hetzner,oneof=hetzner"`
+
+	// Zone is the DNS zone of the hostname, e.g. "example.com"
+	Zone string `json:"zone" validate:"required,fqdn"`
+
+	// TTL of the records in seconds. Defaults to 300.
+	TTL int `json:"ttl" validate:"default=300,min=60"`
+
+	// Token of the Hetzner project of the zone. Defaults to the Hetzner token.
+	Token string `json:"token"`
+
+	// APIURL overrides the URL of the Hetzner Cloud API which manages the zone
+	APIURL *string `json:"api_url" validate:"omitempty,url"`
+}
+
+// ControlPlaneUpgradeStrategyConfig controls the order in which Talos upgrades roll through the control plane pools.
+// Control plane nodes are always upgraded one at a time and control plane pools one after the other,
+// so etcd keeps its quorum. Unlike worker pools, there is no batch size.
+type ControlPlaneUpgradeStrategyConfig struct {
+	// Order sorts the control plane pools for upgrades, lower orders are upgraded first. Defaults to 0.
+	Order int `json:"order"`
+}
+
 type ControlPlaneNodePoolConfig struct {
 	// Number of control‑plane nodes
 	Count int `json:"count" validate:"default=1,min=1"`
 
+	// Decommission lists the indices of nodes which are removed from the pool, e.g. 3 to remove "<pool>-3".
+	// The pool keeps Count nodes, decommissioned indices are skipped and the other nodes keep their names.
+	// To replace a node, decommission it without lowering Count. Keep the index listed while it should stay unused.
+	Decommission []int `json:"decommission" validate:"unique,dive,min=0"`
+
 	// Hetzner server type (e.g. "cx23", "cax11")
 	ServerSize string `json:"server_size" validate:"required"`
 
@@ -50,6 +114,23 @@ type ControlPlaneNodePoolConfig struct {
 
 	Labels      map[string]string `json:"labels" validate:"dive,keys,excludes=/"`
 	Annotations map[string]string `json:"annotations" validate:"dive,keys,excludes=/"`
-	// Taints will only be applied, when a node is created. Update of taints is not supported by talos.
-	Taints []Taint `json:"taints" validate:"dive"`
+	// Taints are managed by Talos, added and removed taints are applied to existing nodes.
+	// Talos keeps one value and effect per key, so a key can not be repeated with another value or effect.
+	Taints []Taint `json:"taints" validate:"one_taint_per_key,dive"`
+
+	// Upgrade controls how Talos upgrades roll through the pool.
+	Upgrade ControlPlaneUpgradeStrategyConfig `json:"upgrade"`
+
+	// ConfigPatches are Talos config patches for the nodes of the pool, applied after the cluster-wide patches.
+	// Strategic merge patches in YAML and JSON6902 patches are accepted.
+	ConfigPatches []string `json:"config_patches"`
+
+	// Ephemeral sizes the EPHEMERAL partition of the nodes. Control plane pools have no volumes to place it on.
+	Ephemeral *EphemeralConfig `json:"ephemeral"`
+
+	// ImageCache enables the Talos image cache on the nodes.
+	ImageCache *ImageCacheConfig `json:"image_cache"`
+
+	// Swap enables swap on the nodes. Control plane pools have no volumes to place it on.
+	Swap *SwapConfig `json:"swap"`
 }
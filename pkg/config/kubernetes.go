@@ -39,7 +39,7 @@ type KubernetesMetricsServerChartConfig struct {
 
 // KubernetesConfig configures in‑cluster Hetzner components.
 type KubernetesConfig struct {
-	// Token passed to CCM, CSI driver and autoscaler
+	// Token passed to CCM, CSI driver, autoscaler and the Talos VIP of the floating IP endpoint
 	// This is required when enable CCM, CSI driver or autoscaler
 	HCloudToken string `json:"hcloud_token" validate:"env=K8S_HCLOUD_TOKEN"`
 
@@ -21,4 +21,24 @@ type NetworkConfig struct {
 	// If not provided, defaults to Quad9 and Google Public DNS
 	// Example: ["9.9.9.9", "2620:fe::fe", "8.8.8.8", "2001:4860:4860::8888"]
 	Nameservers []string `json:"nameservers"`
+
+	// NATGateway is the internet egress of the node pools without public IPv4.
+	// It is only created if a node pool has no public IPv4, see NodePoolConfig.PublicNetwork.
+	NATGateway NATGatewayConfig `json:"nat_gateway"`
+}
+
+// NATGatewayConfig configures the NAT gateway, a small server which masquerades the traffic of the network to the internet.
+// The network routes all traffic to the internet through it.
+type NATGatewayConfig struct {
+	// ServerSize is the server type of the gateway. Defaults to "cx23".
+	ServerSize string `json:"server_size" validate:"default=cx23"`
+
+	// Image is the Hetzner image of the gateway, it must come with nftables and cloud-init. Defaults to "debian-12".
+	Image string `json:"image" validate:"default=debian-12"`
+
+	// Region of the gateway. Defaults to the region of the first control plane pool.
+	Region *string `json:"region"`
+
+	// Protect the gateway from accidental deletion
+	Protect bool `json:"protect"`
 }
@@ -14,6 +14,95 @@ type Taint struct {
 	Effect string `json:"effect" validate:"required,oneof=NoSchedule NoExecute PreferNoSchedule"`
 }
 
+// UpgradeStrategyConfig controls how Talos upgrades roll through the nodes of a worker pool.
+type UpgradeStrategyConfig struct {
+	// BatchSize is the number of nodes which are upgraded at the same time.
+	// The next batch starts when all nodes of the previous batch are upgraded. Defaults to 1.
+	BatchSize int `json:"batch_size" validate:"default=1,min=1"`
+
+	// MaxUnavailable caps the number of nodes of the pool which are unavailable at the same time.
+	// It limits the batch size. A pool with more than one node always keeps at least one node available.
+	MaxUnavailable *int `json:"max_unavailable" validate:"omitempty,min=1"`
+
+	// Order sorts the pools for upgrades, lower orders are upgraded first.
+	// Pools with the same order are upgraded in the configured order. Defaults to 0.
+	Order int `json:"order"`
+}
+
+// ReplacementConfig enables the rolling replacement of the nodes of a pool.
+// A change of the server size, the region, the architecture or the Talos image creates new nodes,
+// the old nodes are drained and removed once their replacements are ready.
+type ReplacementConfig struct {
+	// MaxSurge is the number of new nodes which are created before old nodes are removed. Defaults to 1.
+	MaxSurge *int `json:"max_surge" validate:"omitempty,min=0"`
+
+	// MaxUnavailable is the number of old nodes which are removed before their replacements are ready. Defaults to 0.
+	// If both MaxSurge and MaxUnavailable are 0, one new node is created before an old node is removed.
+	MaxUnavailable int `json:"max_unavailable" validate:"min=0"`
+}
+
+// NodeVolumeConfig is a Hetzner volume which is attached to every node of a pool and mounted as Talos user volume.
+type NodeVolumeConfig struct {
+	// Name of the Talos user volume, it is mounted at /var/mnt/<name>.
+	// Letters, digits and hyphens are allowed.
+	Name string `json:"name" validate:"required,max=34"`
+
+	// Size of the volume in GB. The volumes of a pool are told apart by their size, so it must be unique in the pool.
+	Size int `json:"size" validate:"min=10,max=10240"`
+
+	// Format is the filesystem Talos formats the volume with. Can be "xfs" or "ext4". Defaults to "xfs".
+	Format string `json:"format" validate:"default=xfs,oneof=xfs ext4"`
+
+	// Automount mounts the volume as Talos user volume. Defaults to true.
+	// Without it the volume is only attached, e.g. as raw block device for Longhorn.
+	Automount *bool `json:"automount"`
+}
+
+// EphemeralConfig sizes and places the EPHEMERAL partition, which holds /var with the container images and pod data.
+// Talos only provisions the partition when a node is installed.
+type EphemeralConfig struct {
+	// MinSize is the minimum size of the partition, e.g. "10GiB".
+	MinSize string `json:"min_size"`
+
+	// MaxSize is the maximum size of the partition, e.g. "100GiB" or "80%". Defaults to the whole disk.
+	MaxSize string `json:"max_size"`
+
+	// Grow grows the partition up to MaxSize when the disk has free space. Defaults to the Talos default, which grows it.
+	Grow *bool `json:"grow"`
+
+	// Volume places the partition on the volume of the pool with this name instead of the root disk, see NodePoolConfig.Volumes.
+	// The volume is not mounted as user volume.
+	Volume string `json:"volume"`
+}
+
+// ImageCacheConfig enables the Talos image cache, which serves container images from the IMAGECACHE partition.
+// Talos only provisions the partition when a node is installed.
+type ImageCacheConfig struct {
+	// Enabled enables the local image cache.
+	Enabled bool `json:"enabled"`
+
+	// MaxSize is the maximum size of the partition, e.g. "2GiB". Defaults to the Talos default.
+	MaxSize string `json:"max_size"`
+}
+
+// SwapConfig enables swap on the nodes with a Talos swap volume.
+// The swap partition needs free space on the root disk, see EphemeralConfig.MaxSize, or a volume of the pool.
+type SwapConfig struct {
+	// Size of the swap partition, e.g. "4GiB".
+	Size string `json:"size" validate:"required"`
+
+	// Encrypted encrypts the swap partition with a key derived from the node UUID.
+	Encrypted bool `json:"encrypted"`
+
+	// Behavior is the swap behavior of the kubelet. Can be "LimitedSwap" or "NoSwap". Defaults to "LimitedSwap".
+	// With "NoSwap" only processes outside of Kubernetes pods use swap.
+	Behavior string `json:"behavior" validate:"default=LimitedSwap,oneof=LimitedSwap NoSwap"`
+
+	// Volume places the swap partition on the volume of the pool with this name instead of the root disk, see NodePoolConfig.Volumes.
+	// The volume is not mounted as user volume.
+	Volume string `json:"volume"`
+}
+
 // NodePoolConfig holds a set of identical worker nodes.
 type NodePoolConfig struct {
 	Name string `json:"name" validate:"required"`
@@ -21,6 +110,11 @@ type NodePoolConfig struct {
 	// Count is the number of nodes in the pool. Those nodes will are deployed through pulumi and autoscaler can not remove them.
 	Count int `json:"count"`
 
+	// Decommission lists the indices of nodes which are removed from the pool, e.g. 3 to remove "<pool>-3".
+	// The pool keeps Count nodes, decommissioned indices are skipped and the other nodes keep their names.
+	// To replace a node, decommission it without lowering Count. Keep the index listed while it should stay unused.
+	Decommission []int `json:"decommission" validate:"unique,dive,min=0"`
+
 	// AutoScaler is the configuration for the autoscaler.
 	AutoScaler *AutoScalerConfig `json:"auto_scaler"`
 
@@ -33,8 +127,52 @@ type NodePoolConfig struct {
 
 	Labels      map[string]string `json:"labels" validate:"dive,keys,excludes=/"`
 	Annotations map[string]string `json:"annotations" validate:"dive,keys,excludes=/"`
-	// Taints will only be applied, when a node is created. Update of taints is not supported by talos.
-	Taints []Taint `json:"taints" validate:"dive"`
+	// Taints are managed by Talos, added and removed taints are applied to existing nodes.
+	// Talos keeps one value and effect per key, so a key can not be repeated with another value or effect.
+	Taints []Taint `json:"taints" validate:"one_taint_per_key,dive"`
+
+	// Upgrade controls how Talos upgrades roll through the pool.
+	Upgrade UpgradeStrategyConfig `json:"upgrade"`
+
+	// ConfigPatches are Talos config patches for the nodes of the pool, applied after the cluster-wide patches.
+	// Strategic merge patches in YAML and JSON6902 patches are accepted.
+	ConfigPatches []string `json:"config_patches"`
+
+	// Replacement replaces the nodes instead of changing their servers in place, when set.
+	// Enabling it on an existing pool replaces all of its nodes once.
+	Replacement *ReplacementConfig `json:"replacement"`
+
+	// Volumes are Hetzner volumes which are created and attached for every node of the pool.
+	// The cluster autoscaler can not create volumes, pools with volumes can not be autoscaled.
+	Volumes []NodeVolumeConfig `json:"volumes" validate:"excluded_with=AutoScaler,unique=Name,unique=Size,dive"`
+
+	// Ephemeral sizes and places the EPHEMERAL partition of the nodes.
+	Ephemeral *EphemeralConfig `json:"ephemeral"`
+
+	// ImageCache enables the Talos image cache on the nodes.
+	ImageCache *ImageCacheConfig `json:"image_cache"`
+
+	// Swap enables swap on the nodes, including the nodes created by the cluster autoscaler.
+	Swap *SwapConfig `json:"swap"`
+
+	// PublicNetwork is the public network of the nodes: "dual" (IPv4 and IPv6), "ipv6" or "none". Defaults to "dual".
+	// Nodes without public IPv4 reach the internet through the NAT gateway of the network, see NetworkConfig.NATGateway,
+	// and their Talos API is reached through the control planes. Such pools can not be autoscaled.
+	PublicNetwork string `json:"public_network" validate:"default=dual,oneof=none ipv6 dual"`
+}
+
+const (
+	// PublicNetworkDual gives the nodes a public IPv4 and IPv6 address
+	PublicNetworkDual = "dual"
+	// PublicNetworkIPv6 gives the nodes only a public IPv6 address
+	PublicNetworkIPv6 = "ipv6"
+	// PublicNetworkNone gives the nodes no public address, they are only attached to the private network
+	PublicNetworkNone = "none"
+)
+
+// HasPublicIPv4 returns true if the nodes of the pool have a public IPv4 address
+func (c *NodePoolConfig) HasPublicIPv4() bool {
+	return c.PublicNetwork == "" || c.PublicNetwork == PublicNetworkDual
 }
 
 // NodePoolsConfig holds a list of worker node pools.
@@ -53,4 +191,18 @@ type NodePoolsConfig struct {
 	// WARNING: This should NEVER be enabled in production as it will prevent
 	// proper management of auto-scaler created nodes.
 	SkipAutoScalerDiscovery bool `json:"skip_auto_scaler_discovery"`
+
+	// UpgradeParallelism is the number of worker pools which are upgraded at the same time,
+	// in the order given by their upgrade order. Defaults to 1, one pool after the other.
+	UpgradeParallelism int `json:"upgrade_parallelism" validate:"default=1,min=1"`
+}
+
+// NATGatewayRequired returns true if a node pool has no public IPv4 address and needs the NAT gateway
+func (c *NodePoolsConfig) NATGatewayRequired() bool {
+	for i := range c.NodePools {
+		if !c.NodePools[i].HasPublicIPv4() {
+			return true
+		}
+	}
+	return false
 }
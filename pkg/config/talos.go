@@ -54,28 +54,102 @@ type ClusterInlineManifest struct {
 	Contents string `json:"contents" validate:"required"`
 }
 
+// InlineChartConfig declares a Helm chart which is rendered into an inline manifest of the control plane,
+// e.g. for components which must exist before the Kubernetes phase like a CNI, the CCM or ArgoCD.
+type InlineChartConfig struct {
+	// Name of the inline manifest and of the release.
+	Name string `json:"name" validate:"required"`
+	// Chart is the name of the chart in the repository, or the path of a vendored chart directory or archive.
+	Chart string `json:"chart" validate:"required"`
+	// Repo is the URL of the chart repository, empty for a vendored chart.
+	Repo string `json:"repo"`
+	// Version of the chart. Required for a repository chart, a cached chart of the version is rendered offline.
+	Version string `json:"version" validate:"required_with=Repo"`
+	// Namespace of the release. Defaults to "kube-system".
+	Namespace string `json:"namespace" validate:"default=kube-system"`
+	// CreateNamespace adds the namespace of the release to the inline manifest.
+	CreateNamespace bool `json:"create_namespace"`
+	// Values of the release.
+	Values map[string]interface{} `json:"values"`
+}
+
+// CNICilium is the name of the CNI which installs Cilium at bootstrap.
+const CNICilium = "cilium"
+
 // CNIConfig holds the CNI configuration for the cluster.
 type CNIConfig struct {
-	// Name of the CNI to use. Can be "flannel", "custom", or "none".
-	Name string `json:"name" validate:"required,oneof=flannel custom none"`
+	// Name of the CNI to use. Can be "flannel", "cilium", "custom", or "none".
+	// "cilium" installs Cilium at bootstrap as replacement of kube-proxy, see CiliumConfig.
+	Name string `json:"name" validate:"required,oneof=flannel cilium custom none"`
 	// URLs of the CNI manifests to apply if Name is "custom".
 	URLs []string `json:"urls,omitempty" validate:"required_if=Name custom"`
+	// Cilium configures Cilium if Name is "cilium".
+	Cilium CiliumConfig `json:"cilium"`
+}
+
+// CiliumConfig configures Cilium, which is rendered from its Helm chart into the inline manifests of the control plane.
+// Pods are routed natively over the Hetzner private network through the routes of the Hetzner CCM,
+// the CCM must be enabled.
+type CiliumConfig struct {
+	// Version of the Cilium chart. Defaults to "1.18.2".
+	Version string `json:"version" validate:"default=1.18.2"`
+	// GatewayAPI enables the Cilium Gateway API support and installs the Gateway API CRDs.
+	GatewayAPI bool `json:"gateway_api"`
+	// GatewayAPIVersion is the version of the Gateway API CRDs. Defaults to "v1.3.0".
+	// See: https://docs.cilium.io/en/stable/network/servicemesh/gateway-api/gateway-api/
+	GatewayAPIVersion string `json:"gateway_api_version" validate:"default=v1.3.0"`
+	// Values are merged into the chart values and take precedence over the predefined values.
+	// The kube-proxy replacement and its API server endpoint can not be overridden, kube-proxy is disabled with Cilium.
+	Values map[string]interface{} `json:"values"`
 }
 
 // ProxyConfig holds the proxy configuration for the cluster.
 type ProxyConfig struct {
-	// Disabled disables the kube-proxy.
+	// Disabled disables the kube-proxy, e.g. when the CNI replaces it.
 	Disabled bool `json:"disabled,omitempty"`
+	// Mode is the proxy mode of kube-proxy. Can be "iptables", "ipvs" or "nftables".
+	// Defaults to the kube-proxy default when empty.
+	Mode string `json:"mode,omitempty" validate:"omitempty,oneof=iptables ipvs nftables"`
+	// ExtraArgs are additional command line arguments for kube-proxy.
+	ExtraArgs map[string]string `json:"extra_args,omitempty"`
 }
 
 // EncryptionKeyNodeID configuration.
 type EncryptionKeyNodeID struct{}
 
-// EncryptionKeyConfig defines a single encryption key.
+// EncryptionKeyStatic is a key with a passphrase stored in the machine configuration.
+// Set the passphrase as a secret: pulumi config set --secret --path hcloud-k8s:talos.disk_encryption.keys[0].static.passphrase <passphrase>
+type EncryptionKeyStatic struct {
+	// Passphrase is the static passphrase of the key.
+	Passphrase string `json:"passphrase" validate:"required"`
+}
+
+// EncryptionKeyKMS is a key which is sealed and unsealed by a KMS server, e.g. a KMS server on the private network.
+// See: https://github.com/siderolabs/kms-client
+type EncryptionKeyKMS struct {
+	// Endpoint is the URL of the KMS server.
+	Endpoint string `json:"endpoint" validate:"required,url"`
+}
+
+// EncryptionKeyTPM is a key which is sealed and unsealed by the TPM of the node.
+type EncryptionKeyTPM struct {
+	// PCRs are the PCRs the key is bound to. Talos binds the key to PCR 7 when not set, an empty list disables the binding.
+	PCRs []int `json:"pcrs" validate:"omitempty,dive,min=0,max=23"`
+	// CheckSecurebootStatusOnEnroll fails the enrollment of the key when Secure Boot is not enabled.
+	CheckSecurebootStatusOnEnroll bool `json:"check_secureboot_status_on_enroll"`
+}
+
+// EncryptionKeyConfig defines a single encryption key, exactly one key type has to be set.
 type EncryptionKeyConfig struct {
 	// Slot is the LUKS2 keyslot index; LUKS2 supports keyslots 0–31.
 	Slot   int                  `json:"slot" validate:"min=0,max=31"`
-	NodeID *EncryptionKeyNodeID `json:"node_id,omitempty"`
+	NodeID *EncryptionKeyNodeID `json:"node_id,omitempty" validate:"required_without_all=Static KMS TPM,excluded_with=Static KMS TPM"`
+	Static *EncryptionKeyStatic `json:"static,omitempty" validate:"excluded_with=NodeID KMS TPM"`
+	KMS    *EncryptionKeyKMS    `json:"kms,omitempty" validate:"excluded_with=NodeID Static TPM"`
+	TPM    *EncryptionKeyTPM    `json:"tpm,omitempty" validate:"excluded_with=NodeID Static KMS"`
+	// LockToState locks the key to the random salt stored in the STATE partition,
+	// so the volume can not be unlocked with a replaced STATE partition. It is not applied to the STATE partition itself.
+	LockToState bool `json:"lock_to_state"`
 }
 
 // DiskEncryptionConfig configures disk encryption.
@@ -86,8 +160,58 @@ type DiskEncryptionConfig struct {
 	EncryptEphemeral bool `json:"encrypt_ephemeral"`
 	// Keys is a list of encryption keys to use.
 	Keys []EncryptionKeyConfig `json:"keys" validate:"dive"`
+	// Cipher is the LUKS2 cipher, e.g. "aes-xts-plain64" or "xchacha20,aes-adiantum-plain64". Defaults to the Talos default.
+	Cipher string `json:"cipher,omitempty"`
+	// KeySize is the length of the encryption key in bits. Defaults to the Talos default.
+	KeySize uint `json:"key_size,omitempty" validate:"omitempty,oneof=256 512"`
+	// BlockSize is the sector size in bytes. Defaults to the Talos default.
+	BlockSize uint64 `json:"block_size,omitempty" validate:"omitempty,oneof=512 4096"`
+	// Options are additional LUKS2 performance options.
+	Options []string `json:"options,omitempty" validate:"omitempty,dive,oneof=no_read_workqueue no_write_workqueue same_cpu_crypt"`
+}
+
+// ReadinessConfig configures the readiness gate between the infrastructure and the Kubernetes phase.
+// Before any Kubernetes resource is deployed, the Talos health checks (etcd members, kubelet ready,
+// all nodes ready) are polled and the Kubernetes API server is probed through the cluster endpoint.
+type ReadinessConfig struct {
+	// Disabled skips the readiness gate. Kubernetes resources are deployed as soon as the kubeconfig is available.
+	Disabled bool `json:"disabled"`
+
+	// Timeout is the maximum duration of a single health check attempt.
+	// Must be a valid Go duration string. Defaults to "10m".
+	Timeout string `json:"timeout" validate:"default=10m,duration"`
+
+	// Retries is the number of attempts before the deployment fails. Defaults to 3.
+	Retries int `json:"retries" validate:"default=3,min=1"`
+
+	// RetryInterval is the pause between two failed attempts.
+	// Must be a valid Go duration string. Defaults to "30s".
+	RetryInterval string `json:"retry_interval" validate:"default=30s,duration"`
 }
 
+// DecommissionConfig configures how nodes are removed from the cluster before their servers are deleted.
+// A removed node is cordoned and drained, control plane nodes leave etcd,
+// then the node is gracefully reset and its Kubernetes Node object is deleted.
+type DecommissionConfig struct {
+	// DrainTimeout is the maximum duration to evict the pods of a node. Evictions honour PodDisruptionBudgets,
+	// a drain which does not finish in time fails the deployment and the node is kept.
+	// Must be a valid Go duration string. Defaults to "5m".
+	DrainTimeout string `json:"drain_timeout" validate:"default=5m,duration"`
+
+	// SkipDrain resets removed nodes without draining them and keeps their Node objects,
+	// e.g. to destroy a cluster whose Kubernetes API is not reachable anymore.
+	SkipDrain bool `json:"skip_drain"`
+}
+
+const (
+	// CreationOnlyChangesWarn reports existing nodes which were created with other creation-only configuration
+	CreationOnlyChangesWarn = "warn"
+	// CreationOnlyChangesFail stops the deployment on existing nodes which were created with other creation-only configuration
+	CreationOnlyChangesFail = "fail"
+	// CreationOnlyChangesReplace replaces existing nodes which were created with other creation-only configuration
+	CreationOnlyChangesReplace = "replace"
+)
+
 // TalosConfig contains all Talos Linux image & version settings.
 type TalosConfig struct {
 	// If set, overrides the ID of the Talos image on Hetzner
@@ -115,7 +239,7 @@ type TalosConfig struct {
 	//	"720h"  - 30 days   before expiry (default)
 	//
 	// Defaults to "720h" (30 days).
-	K8sCertificateRenewalDuration string `json:"k8s_certificate_renewal_duration" validate:"default=720h"`
+	K8sCertificateRenewalDuration string `json:"k8s_certificate_renewal_duration" validate:"default=720h,duration"`
 
 	// VM sizes for building x86 & ARM images
 	GeneratorSizes ImageGeneratorSizes `json:"generator_sizes"`
@@ -174,6 +298,15 @@ type TalosConfig struct {
 	// These will get automatically deployed as part of the bootstrap.
 	InlineManifests []ClusterInlineManifest `json:"inline_manifests"`
 
+	// InlineCharts are Helm charts which are rendered into inline manifests at deployment.
+	// These will get automatically deployed as part of the bootstrap, after the InlineManifests.
+	InlineCharts []InlineChartConfig `json:"inline_charts" validate:"dive"`
+
+	// ChartCacheDir is the directory of the downloaded charts of InlineCharts and the CNI.
+	// Charts are downloaded once per version, commit the directory to render them offline.
+	// Defaults to the Helm repository cache.
+	ChartCacheDir string `json:"chart_cache_dir"`
+
 	// EnableHetznerCCMExtraManifest enables installation of Hetzner Cloud Controller Manager via Talos extra manifests.
 	// If enabled, the following manifests will be installed:
 	//   - https://raw.githubusercontent.com/hetznercloud/hcloud-cloud-controller-manager/refs/heads/main/deploy/ccm-networks.yaml
@@ -187,6 +320,36 @@ type TalosConfig struct {
 	// CNI configuration for the cluster.
 	CNI *CNIConfig `json:"cni"`
 
+	// Proxy configures kube-proxy, e.g. to disable it when the CNI replaces it.
+	Proxy *ProxyConfig `json:"proxy"`
+
 	// DiskEncryption configures disk encryption for system partitions.
 	DiskEncryption *DiskEncryptionConfig `json:"disk_encryption"`
+
+	// Readiness configures the wait for a healthy cluster before Kubernetes resources are deployed.
+	Readiness ReadinessConfig `json:"readiness"`
+
+	// Decommission configures how nodes are removed from the cluster when a pool shrinks.
+	Decommission DecommissionConfig `json:"decommission"`
+
+	// CreationOnlyChanges is the policy for existing nodes, when configuration which Talos only applies
+	// at the installation of a node changed since they were created, e.g. the disk encryption.
+	// "warn" reports the nodes, "fail" stops the deployment and "replace" creates new nodes in pools with rolling replacement,
+	// pools without fail. Defaults to "warn".
+	CreationOnlyChanges string `json:"creation_only_changes" validate:"default=warn,oneof=warn fail replace"`
+
+	// ConfigPatches are Talos config patches for all nodes, applied after the generated configuration.
+	// Strategic merge patches in YAML and JSON6902 patches are accepted, e.g. to configure Talos features
+	// which are not modelled by this configuration.
+	// Example:
+	//
+	//	- |
+	//	  machine:
+	//	    sysctls:
+	//	      net.core.somaxconn: "65535"
+	//	- |
+	//	  - op: add
+	//	    path: /machine/kernel/modules
+	//	    value: [{name: br_netfilter}]
+	ConfigPatches []string `json:"config_patches"`
 }
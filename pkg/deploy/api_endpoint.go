@@ -0,0 +1,84 @@
+package deploy
+
+import (
+	"fmt"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/dns"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/compute"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/lb"
+
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// apiEndpointHostname returns the hostname of the Kubernetes API, empty if the API is reached through its IP
+func apiEndpointHostname(cfg *config.PulumiConfig) string {
+	if cfg.ControlPlane.APIEndpoint == nil {
+		return ""
+	}
+
+	return cfg.ControlPlane.APIEndpoint.Hostname
+}
+
+// newAPIEndpointRecords creates the DNS records of the API endpoint hostname, if they are managed by the stack.
+// The records point at the load balancer, the floating IP or, without any of them, all control plane nodes.
+func newAPIEndpointRecords(ctx *pulumi.Context, name string, cfg *config.PulumiConfig, hetznerProvider *hcloud.Provider, cpLb *lb.Controlplane, cpFloatingIP *hcloud.FloatingIp, cpPools []*compute.NodePool, opts ...pulumi.ResourceOption) ([]pulumi.Resource, error) {
+	endpoint := cfg.ControlPlane.APIEndpoint
+	if endpoint == nil || endpoint.DNS == nil {
+		return nil, nil
+	}
+
+	recordName, err := dns.RelativeName(endpoint.Hostname, endpoint.DNS.Zone)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := dns.NewProvider(ctx, name, &dns.ProviderArgs{
+		Config:          endpoint.DNS,
+		HetznerProvider: hetznerProvider,
+		Token:           cfg.Hetzner.Token,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := map[string]pulumi.StringArray{}
+	switch {
+	case cpLb != nil:
+		addresses["A"] = pulumi.StringArray{cpLb.LoadBalancer.Ipv4}
+		addresses["AAAA"] = pulumi.StringArray{cpLb.LoadBalancer.Ipv6}
+	case cpFloatingIP != nil:
+		addresses["A"] = pulumi.StringArray{cpFloatingIP.IpAddress}
+	default:
+		// the records are updated in place when control planes are added or replaced
+		for _, cpPool := range cpPools {
+			for _, node := range cpPool.Nodes {
+				addresses["A"] = append(addresses["A"], node.Node.Ipv4Address)
+			}
+		}
+	}
+
+	records := []pulumi.Resource{}
+	for _, recordType := range []string{"A", "AAAA"} {
+		values, ok := addresses[recordType]
+		if !ok {
+			continue
+		}
+
+		record, err := provider.NewRecord(ctx, fmt.Sprintf("%s-api-%s", name, recordType), &dns.RecordArgs{
+			ClusterName: name,
+			Zone:        endpoint.DNS.Zone,
+			Name:        recordName,
+			Type:        recordType,
+			TTL:         endpoint.DNS.TTL,
+			Values:      values,
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
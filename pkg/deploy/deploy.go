@@ -1,6 +1,10 @@
 package deploy
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/compute"
 	hfirewall "github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/firewall"
@@ -13,10 +17,24 @@ import (
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/core"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
 
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
+const (
+	// clusterType is the type token of the cluster component
+	clusterType = "hcloud-k8s:index:HetznerTalosKubernetesCluster"
+	// clusterGroupTypePrefix prefixes the type tokens of the group components of a cluster
+	clusterGroupTypePrefix = "hcloud-k8s:cluster"
+	// hcloudProviderType is the type token of the Hetzner provider
+	hcloudProviderType = "pulumi:providers:hcloud"
+)
+
+// HetznerTalosKubernetesCluster is the component resource of a cluster.
+// Its children are grouped into the network, control plane, worker pools and applications components.
 type HetznerTalosKubernetesCluster struct {
+	pulumi.ResourceState
+
 	Kubeconfig          *core.Kubeconfig
 	TalosConfig         pulumi.StringOutput
 	ClusterApplications *cluster.Applications
@@ -27,13 +45,42 @@ type HetznerTalosKubernetesCluster struct {
 // NewHetznerTalosKubernetesCluster creates a new Hetzner Talos Kubernetes cluster with the given name and configuration.
 // It sets up the necessary Hetzner provider, images, network, control plane load balancer, placement group,
 // machine configuration manager, firewalls, control plane and worker node pools, and Kubernetes provider.
-// It also applies Talos upgrades and exports the kubeconfig and talosconfig.
-func NewHetznerTalosKubernetesCluster(ctx *pulumi.Context, name string, cfg *config.PulumiConfig) (*HetznerTalosKubernetesCluster, error) { //nolint:cyclop,funlen // TODO: refactor
+// It also applies Talos upgrades and registers the kubeconfig and talosconfig as outputs.
+// Resources of stacks created before the cluster became a component resource are aliased to their former URNs.
+func NewHetznerTalosKubernetesCluster(ctx *pulumi.Context, name string, cfg *config.PulumiConfig, opts ...pulumi.ResourceOption) (*HetznerTalosKubernetesCluster, error) { //nolint:cyclop,funlen // TODO: refactor
+	if err := core.ValidateKubernetesVersion(cfg.Talos.ImageVersion, cfg.Talos.KubernetesVersion); err != nil {
+		return nil, err
+	}
+
 	out := &HetznerTalosKubernetesCluster{}
+	err := ctx.RegisterComponentResource(clusterType, name, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	networkGroup, err := newClusterGroup(ctx, name, "Network", out)
+	if err != nil {
+		return nil, err
+	}
+
+	controlPlaneGroup, err := newClusterGroup(ctx, name, "ControlPlane", out)
+	if err != nil {
+		return nil, err
+	}
+
+	workerPoolsGroup, err := newClusterGroup(ctx, name, "WorkerPools", out)
+	if err != nil {
+		return nil, err
+	}
+
+	applicationsGroup, err := newClusterGroup(ctx, name, "Applications", out)
+	if err != nil {
+		return nil, err
+	}
 
-	hetznerProvider, err := provider.NewProvider(ctx, "hetzner", &provider.ProviderArgs{
+	hetznerProvider, err := provider.NewProvider(ctx, fmt.Sprintf("%s-hetzner", name), &provider.ProviderArgs{
 		Token: cfg.Hetzner.Token,
-	})
+	}, pulumi.Parent(out), meta.LegacyAlias(ctx, "hetzner", hcloudProviderType))
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +100,7 @@ func NewHetznerTalosKubernetesCluster(ctx *pulumi.Context, name string, cfg *con
 	}
 	enableARMImages, enableX86Images := image.DetectRequiredArchitecturesFromList(architectures)
 
-	images, err := image.NewImages(ctx, &image.ImagesArgs{
+	images, err := image.NewImages(ctx, name, &image.ImagesArgs{
 		HetznerToken:            cfg.Hetzner.Token,
 		EnableARMImageUpload:    enableARMImages,
 		EnableX86ImageUpload:    enableX86Images,
@@ -67,68 +114,183 @@ func NewHetznerTalosKubernetesCluster(ctx *pulumi.Context, name string, cfg *con
 		return nil, err
 	}
 
-	net, err := network.NewNetwork(ctx, "talos-network", &network.NetworkArgs{
+	net, err := network.NewNetwork(ctx, fmt.Sprintf("%s-talos-network", name), &network.NetworkArgs{
+		ClusterName: name,
 		NetworkZone: cfg.Network.Zone,
 		CIDR:        cfg.Network.CIDR,
 		Subnet:      cfg.Network.Subnet,
-	}, pulumi.Parent(hetznerProvider), pulumi.Provider(hetznerProvider))
+	}, pulumi.Parent(networkGroup), pulumi.Provider(hetznerProvider),
+		// the subnet shares the options, a name and parent alias keeps its type
+		pulumi.Aliases([]pulumi.Alias{{
+			Name:      pulumi.String("talos-network"),
+			ParentURN: meta.LegacyURN(ctx, "hetzner", hcloudProviderType),
+		}}),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	cpLb, err := lb.NewControlplane(ctx, "controlplane-lb", &lb.ControlplaneArgs{
-		DisableLoadBalancer: cfg.ControlPlane.DisableLoadBalancer,
+	// node pools without public IPv4 reach the internet through the NAT gateway of the network
+	if cfg.NodePools.NATGatewayRequired() {
+		natGatewayRegion := cfg.ControlPlane.NodePools[0].Region
+		if cfg.Network.NATGateway.Region != nil {
+			natGatewayRegion = *cfg.Network.NATGateway.Region
+		}
+
+		net.NATGateway, err = network.NewNATGateway(ctx, fmt.Sprintf("%s-nat-gateway", name), &network.NATGatewayArgs{
+			ClusterName: name,
+			Network:     net,
+			CIDR:        cfg.Network.CIDR,
+			ServerSize:  cfg.Network.NATGateway.ServerSize,
+			Image:       cfg.Network.NATGateway.Image,
+			Region:      natGatewayRegion,
+			Protect:     cfg.Network.NATGateway.Protect,
+		}, pulumi.Parent(networkGroup), pulumi.Provider(hetznerProvider))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cpLb, err := lb.NewControlplane(ctx, fmt.Sprintf("%s-controlplane-lb", name), &lb.ControlplaneArgs{
+		ClusterName:         name,
+		DisableLoadBalancer: !cfg.ControlPlane.LoadBalancerEnabled(),
 		LoadBalancerType:    cfg.ControlPlane.LoadBalancerType,
 		Network:             net,
 		Location:            cfg.ControlPlane.LoadBalancerLocation,
 		Protect:             cfg.ControlPlane.Protect,
-	}, pulumi.Parent(net.Network), pulumi.Provider(hetznerProvider))
+	}, pulumi.Parent(net.Network), pulumi.Provider(hetznerProvider), meta.LegacyName("controlplane-lb-controlplane"))
 	if err != nil {
 		return nil, err
 	}
 
-	cpPg, err := compute.NewPlacementGroup(ctx, "controlplane-placement-group", &compute.PlacementGroupArgs{
+	// the nodes without public IPv4 are configured through the Talos API of the load balancer
+	if cpLb != nil {
+		err = cpLb.NewTalosService(ctx, pulumi.Provider(hetznerProvider))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cpPg, err := compute.NewPlacementGroup(ctx, fmt.Sprintf("%s-controlplane-placement-group", name), &compute.PlacementGroupArgs{
 		ServerNodeType: meta.ControlPlaneNode,
-	}, pulumi.Parent(net.Network), pulumi.Provider(hetznerProvider))
+	}, pulumi.Parent(controlPlaneGroup), pulumi.Provider(hetznerProvider),
+		meta.LegacyAlias(ctx, "controlplane-placement-group", hcloudProviderType, "hcloud:index/network:Network", "hcloud:index/placementGroup:PlacementGroup"),
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	// the control planes share a floating IP as Talos VIP instead of a load balancer
+	var cpFloatingIP *hcloud.FloatingIp
+	if cfg.ControlPlane.EndpointMode == config.EndpointModeFloatingIP {
+		cpFloatingIP, err = lb.NewControlplaneFloatingIP(ctx, fmt.Sprintf("%s-controlplane-fip", name), &lb.ControlplaneFloatingIPArgs{
+			HomeLocation: cfg.ControlPlane.NodePools[0].Region,
+			Protect:      cfg.ControlPlane.Protect,
+		}, pulumi.Parent(controlPlaneGroup), pulumi.Provider(hetznerProvider))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	machineConfigurationManager, err := core.NewMachineConfigurationManager(ctx, name, &core.MachineConfigurationManagerArgs{
 		ControlplaneLoadBalancer: cpLb,
+		ControlplaneFloatingIP:   cpFloatingIP,
+		Hostname:                 apiEndpointHostname(cfg),
 		TalosVersion:             cfg.Talos.ImageVersion,
 		KubernetesVersion:        cfg.Talos.KubernetesVersion,
-	})
+	}, pulumi.Parent(out), meta.LegacyAlias(ctx, fmt.Sprintf("%s-secret", name), "talos:machine/secrets:Secrets"))
 	if err != nil {
 		return nil, err
 	}
 
-	firewallCp, err := hfirewall.NewControlplaneFirewall(ctx, "fw-controlplane", &hfirewall.ControlplaneFirewallArgs{
+	firewallCp, err := hfirewall.NewControlplaneFirewall(ctx, fmt.Sprintf("%s-fw-controlplane", name), &hfirewall.ControlplaneFirewallArgs{
 		VpnCidrs:                               cfg.Firewall.VpnCidrs,
 		OpenAPIToEveryone:                      cfg.Firewall.OpenTalosAPI,
-		ExposeKubernetesAPIWithoutLoadBalancer: cfg.ControlPlane.DisableLoadBalancer,
+		ExposeKubernetesAPIWithoutLoadBalancer: !cfg.ControlPlane.LoadBalancerEnabled(),
 		CustomRules:                            hfirewall.ToCustomFirewallRuleArgs(cfg.Firewall.CustomRulesControlplane),
-	}, pulumi.Provider(hetznerProvider))
+	}, pulumi.Parent(networkGroup), pulumi.Provider(hetznerProvider), meta.LegacyAlias(ctx, "fw-controlplane", "hcloud:index/firewall:Firewall"))
 	if err != nil {
 		return nil, err
 	}
 
-	firewallWorker, err := hfirewall.NewWorkerFirewall(ctx, "fw-worker", &hfirewall.WorkerFirewallArgs{
+	firewallWorker, err := hfirewall.NewWorkerFirewall(ctx, fmt.Sprintf("%s-fw-worker", name), &hfirewall.WorkerFirewallArgs{
 		VpnCidrs:          cfg.Firewall.VpnCidrs,
 		OpenAPIToEveryone: cfg.Firewall.OpenTalosAPI,
 		CustomRules:       hfirewall.ToCustomFirewallRuleArgs(cfg.Firewall.CustomRulesWorker),
-	}, pulumi.Provider(hetznerProvider))
+	}, pulumi.Parent(networkGroup), pulumi.Provider(hetznerProvider), meta.LegacyAlias(ctx, "fw-worker", "hcloud:index/firewall:Firewall"))
 	if err != nil {
 		return nil, err
 	}
 
-	cpPools, err := compute.DeployControlPlanePools(ctx, cfg, images, net, cpPg, machineConfigurationManager, firewallCp, hetznerProvider)
+	cpPools, err := compute.DeployControlPlanePools(ctx, name, cfg, images, net, cpPg, machineConfigurationManager, firewallCp, hetznerProvider)
 	if err != nil {
 		return nil, err
 	}
 	out.ControlPlanePools = cpPools
 
-	workerPools, err := compute.DeployWorkerPools(ctx, cfg, images, net, machineConfigurationManager, firewallWorker, hetznerProvider)
+	if cpLb != nil {
+		cpServers := []pulumi.Resource{}
+		for _, cpPool := range cpPools {
+			for _, node := range cpPool.Nodes {
+				cpServers = append(cpServers, node.Node)
+			}
+		}
+
+		err = cpLb.NewTarget(ctx, pulumi.Provider(hetznerProvider), meta.LegacyName("controlplane-lb-controlplane"), pulumi.DependsOn(cpServers))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	apiEndpointRecords, err := newAPIEndpointRecords(ctx, name, cfg, hetznerProvider, cpLb, cpFloatingIP, cpPools, pulumi.Parent(controlPlaneGroup))
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []pulumi.StringOutput{}
+	for _, cpPool := range cpPools {
+		for _, node := range cpPool.Nodes {
+			endpoints = append(endpoints, node.Node.Ipv4Address)
+		}
+	}
+
+	clusterEndpoint, err := machineConfigurationManager.ClusterEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	talosEndpoint, err := machineConfigurationManager.TalosEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	kubernetesCA := machineConfigurationManager.Secrets.MachineSecrets.Certs().K8s()
+
+	// Talos upgrades, resets and rolling replacements are done through the Talos API, the credentials stay in memory.
+	// The hooks are registered before the worker pools, which roll their nodes through them.
+	drainTimeout, err := time.ParseDuration(cfg.Talos.Decommission.DrainTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid decommission drain timeout: %w", err)
+	}
+
+	talosHooksArgs := &cli.TalosHooksArgs{
+		Endpoints:         endpoints,
+		CACertificate:     machineConfigurationManager.Secrets.ClientConfiguration.CaCertificate(),
+		ClientCertificate: machineConfigurationManager.Secrets.ClientConfiguration.ClientCertificate(),
+		ClientKey:         machineConfigurationManager.Secrets.ClientConfiguration.ClientKey(),
+		DrainTimeout:      drainTimeout,
+	}
+	if !cfg.Talos.Decommission.SkipDrain {
+		// removed nodes are drained and their Node objects deleted through the Kubernetes API
+		talosHooksArgs.KubernetesHost = clusterEndpoint
+		talosHooksArgs.KubernetesCACertificate = kubernetesCA.Cert()
+		talosHooksArgs.KubernetesCAKey = kubernetesCA.Key()
+	}
+
+	talosHooks, err := cli.NewTalosHooks(ctx, name, talosHooksArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	workerPools, err := compute.DeployWorkerPools(ctx, name, cfg, images, net, machineConfigurationManager, firewallWorker, hetznerProvider, talosHooks, workerPoolsGroup)
 	if err != nil {
 		return nil, err
 	}
@@ -149,21 +311,54 @@ func NewHetznerTalosKubernetesCluster(ctx *pulumi.Context, name string, cfg *con
 		workerPoolDependsOn = append(workerPoolDependsOn,
 			cpLb.LoadBalancer,
 			cpLb.Service,
+			cpLb.TalosService,
 			cpLb.Target,
 			cpLb.LoadBalancerNetwork,
 		)
 	}
 
+	if cpFloatingIP != nil {
+		workerPoolDependsOn = append(workerPoolDependsOn, cpFloatingIP)
+	}
+
+	workerPoolDependsOn = append(workerPoolDependsOn, apiEndpointRecords...)
+
+	nodes := append([]pulumi.StringOutput{}, endpoints...)
+	for _, workerPool := range workerPools {
+		for _, node := range workerPool.Nodes {
+			nodes = append(nodes, node.Address())
+		}
+	}
+
+	// Roll a changed Kubernetes version through the cluster node by node, before the configuration is applied to all nodes
+	kubernetesUpgrade, err := compute.UpgradeKubernetesOnAllPools(ctx, name, cpPools, workerPools, &cli.KubernetesUpgradeArgs{
+		Endpoints:               endpoints,
+		CACertificate:           machineConfigurationManager.Secrets.ClientConfiguration.CaCertificate(),
+		ClientCertificate:       machineConfigurationManager.Secrets.ClientConfiguration.ClientCertificate(),
+		ClientKey:               machineConfigurationManager.Secrets.ClientConfiguration.ClientKey(),
+		KubernetesHost:          clusterEndpoint,
+		KubernetesCACertificate: kubernetesCA.Cert(),
+		KubernetesCAKey:         kubernetesCA.Key(),
+		KubernetesVersion:       cfg.Talos.KubernetesVersion,
+	}, pulumi.Parent(out), pulumi.DependsOn(workerPoolDependsOn))
+	if err != nil {
+		return nil, err
+	}
+
 	// Apply configuration patches to all nodes
-	configurationApplies, err := compute.ApplyConfigPatchesToAllPools(ctx, cpPools, workerPools, hetznerProvider)
+	configurationApplies, err := compute.ApplyConfigPatchesToAllPools(ctx, cpPools, workerPools, hetznerProvider,
+		pulumi.DependsOn([]pulumi.Resource{kubernetesUpgrade.Version}),
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	// TODO: remove bootstrap creation from k8s package
-	out.Kubeconfig, err = core.NewKubeconfig(ctx, &core.KubeconfigArgs{
+	out.Kubeconfig, err = core.NewKubeconfig(ctx, name, &core.KubeconfigArgs{
 		CertificateRenewalDuration: cfg.Talos.K8sCertificateRenewalDuration,
 		FirstControlPlane:          cpPools[0].Nodes[0].Node,
+		TalosEndpoint:              talosEndpoint,
+		ClusterEndpoint:            clusterEndpoint,
 		Secrets:                    machineConfigurationManager.Secrets,
 	},
 		pulumi.DependsOn(workerPoolDependsOn),
@@ -173,21 +368,6 @@ func NewHetznerTalosKubernetesCluster(ctx *pulumi.Context, name string, cfg *con
 		return nil, err
 	}
 
-	endpoints := []pulumi.StringOutput{}
-	nodes := []pulumi.StringOutput{}
-	for _, cpPool := range cpPools {
-		for _, node := range cpPool.Nodes {
-			endpoints = append(endpoints, node.Node.Ipv4Address)
-			nodes = append(nodes, node.Node.Ipv4Address)
-		}
-	}
-
-	for _, workerPool := range workerPools {
-		for _, node := range workerPool.Nodes {
-			nodes = append(nodes, node.Node.Ipv4Address)
-		}
-	}
-
 	out.TalosConfig = cli.NewTalosConfiguration(&cli.TalosConfigurationArgs{
 		Context:           machineConfigurationManager.ClusterName,
 		Endpoints:         endpoints,
@@ -198,26 +378,78 @@ func NewHetznerTalosKubernetesCluster(ctx *pulumi.Context, name string, cfg *con
 	})
 
 	// Upgrade Talos on all nodes
-	upgradedNodes, err := compute.UpgradeTalosOnAllPools(ctx, cpPools, workerPools, cfg.Talos.ImageVersion, images, out.TalosConfig,
+	upgradedNodes, err := compute.UpgradeTalosOnAllPools(ctx, cpPools, workerPools, cfg.NodePools.UpgradeParallelism, cfg.Talos.ImageVersion, images, talosHooks,
 		pulumi.DependsOn(append(workerPoolDependsOn, out.Kubeconfig.Bootstrap)),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// Wait until the cluster is healthy before deploying any Kubernetes resource
+	controlPlaneNodes := []pulumi.StringOutput{}
+	for _, cpPool := range cpPools {
+		controlPlaneNodes = append(controlPlaneNodes, cpPool.PrivateIPs()...)
+	}
+
+	workerNodes := []pulumi.StringOutput{}
+	for _, workerPool := range workerPools {
+		workerNodes = append(workerNodes, workerPool.PrivateIPs()...)
+	}
+
+	readiness, err := core.NewClusterReadiness(ctx, name, &core.ClusterReadinessArgs{
+		Secrets:           machineConfigurationManager.Secrets,
+		Kubeconfig:        out.Kubeconfig,
+		Endpoints:         endpoints,
+		ControlPlaneNodes: controlPlaneNodes,
+		WorkerNodes:       workerNodes,
+		TalosVersion:      cfg.Talos.ImageVersion,
+		KubernetesVersion: cfg.Talos.KubernetesVersion,
+		DependsOn:         upgradedNodes,
+		Config:            cfg.Talos.Readiness,
+	}, pulumi.Parent(applicationsGroup))
+	if err != nil {
+		return nil, err
+	}
+
 	out.ClusterApplications, err = cluster.NewApplications(ctx, name, &cluster.ApplicationsArgs{
 		Cfg:                         cfg,
 		Kubeconfig:                  out.Kubeconfig.Kubeconfig,
+		Readiness:                   readiness,
 		Network:                     net,
 		Images:                      images,
 		MachineConfigurationManager: machineConfigurationManager,
 		FirewallWorker:              firewallWorker,
 	},
+		pulumi.Parent(applicationsGroup),
 		pulumi.DependsOn(upgradedNodes),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	err = ctx.RegisterResourceOutputs(out, pulumi.Map{
+		"kubeconfig":  out.Kubeconfig.KubeconfigRaw,
+		"talosconfig": out.TalosConfig,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return out, nil
 }
+
+// clusterGroup is a component resource which groups the resources of a part of the cluster
+type clusterGroup struct {
+	pulumi.ResourceState
+}
+
+// newClusterGroup registers the group of the given kind below the cluster
+func newClusterGroup(ctx *pulumi.Context, name, kind string, cluster *HetznerTalosKubernetesCluster) (*clusterGroup, error) {
+	group := &clusterGroup{}
+	err := ctx.RegisterComponentResource(fmt.Sprintf("%s:%s", clusterGroupTypePrefix, kind), fmt.Sprintf("%s-%s", name, strings.ToLower(kind)), group, pulumi.Parent(cluster))
+	if err != nil {
+		return nil, err
+	}
+
+	return group, ctx.RegisterResourceOutputs(group, pulumi.Map{})
+}
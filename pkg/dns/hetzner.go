@@ -0,0 +1,41 @@
+package dns
+
+import (
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// HetznerProvider manages the record sets of zones in Hetzner DNS as hcloud.ZoneRrset resources.
+// The zone must exist in the project of the provider.
+type HetznerProvider struct {
+	// Provider is the hcloud provider of the project of the zone, nil for the provider of the options
+	Provider *hcloud.Provider
+}
+
+// NewRecord creates the record set in the zone, changed values and TTL are updated in place
+func (p *HetznerProvider) NewRecord(ctx *pulumi.Context, name string, args *RecordArgs, opts ...pulumi.ResourceOption) (pulumi.Resource, error) {
+	recordOpts := append([]pulumi.ResourceOption{}, opts...)
+	if p.Provider != nil {
+		recordOpts = append(recordOpts, pulumi.Provider(p.Provider))
+	}
+
+	records := args.Values.ToStringArrayOutput().ApplyT(func(values []string) []hcloud.ZoneRrsetRecord {
+		records := make([]hcloud.ZoneRrsetRecord, 0, len(values))
+		for _, value := range values {
+			records = append(records, hcloud.ZoneRrsetRecord{Value: value})
+		}
+		return records
+	}).(hcloud.ZoneRrsetRecordArrayOutput)
+
+	return hcloud.NewZoneRrset(ctx, name, &hcloud.ZoneRrsetArgs{
+		Zone:    pulumi.String(args.Zone),
+		Name:    pulumi.String(args.Name),
+		Type:    pulumi.String(args.Type),
+		Ttl:     pulumi.Int(args.TTL),
+		Records: records,
+		Labels: meta.NewLabels(ctx, &meta.ServerLabelsArgs{
+			ClusterName: args.ClusterName,
+		}),
+	}, recordOpts...)
+}
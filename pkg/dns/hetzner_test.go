@@ -0,0 +1,78 @@
+package dns
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mocks records the resources which are created
+type mocks struct {
+	mu        sync.Mutex
+	resources []pulumi.MockResourceArgs
+}
+
+func (m *mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resources = append(m.resources, args)
+	return args.Name + "_id", args.Inputs, nil
+}
+
+func (m *mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+// resource returns the inputs of the created resource with the type and name
+func (m *mocks) resource(t *testing.T, typ, name string) pulumi.MockResourceArgs {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.resources {
+		if r.TypeToken == typ && r.Name == name {
+			return r
+		}
+	}
+	require.Failf(t, "resource not created", "%s %s", typ, name)
+	return pulumi.MockResourceArgs{}
+}
+
+func TestHetznerProvider_NewRecord(t *testing.T) {
+	m := &mocks{}
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		hetznerProvider, err := hcloud.NewProvider(ctx, "staging-hetzner", &hcloud.ProviderArgs{Token: pulumi.String("token")})
+		require.NoError(t, err)
+
+		_, err = (&HetznerProvider{Provider: hetznerProvider}).NewRecord(ctx, "staging-api-A", &RecordArgs{
+			ClusterName: "staging",
+			Zone:        "example.com",
+			Name:        "api",
+			Type:        "A",
+			TTL:         300,
+			Values:      pulumi.StringArray{pulumi.String("203.0.113.10"), pulumi.String("203.0.113.11")},
+		})
+		return err
+	}, pulumi.WithMocks("project", "stack", m))
+	require.NoError(t, err)
+
+	record := m.resource(t, "hcloud:index/zoneRrset:ZoneRrset", "staging-api-A")
+	assert.Equal(t, "example.com", record.Inputs["zone"].StringValue())
+	assert.Equal(t, "api", record.Inputs["name"].StringValue())
+	assert.Equal(t, "A", record.Inputs["type"].StringValue())
+	assert.Equal(t, float64(300), record.Inputs["ttl"].NumberValue())
+	assert.Equal(t, "staging", record.Inputs["labels"].ObjectValue()["cluster"].StringValue())
+	assert.Contains(t, record.Provider, "staging-hetzner")
+
+	values := []string{}
+	for _, r := range record.Inputs["records"].ArrayValue() {
+		values = append(values, r.ObjectValue()["value"].StringValue())
+	}
+	assert.Equal(t, []string{"203.0.113.10", "203.0.113.11"}, values)
+}
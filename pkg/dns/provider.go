@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+const (
+	// ProviderHetzner manages the records through the DNS API of Hetzner
+	ProviderHetzner = "hetzner"
+	// apexName is the relative name of the records of the zone itself
+	apexName = "@"
+)
+
+var (
+	// ErrUnknownProvider is returned for a DNS provider which is not supported
+	ErrUnknownProvider = errors.New("unknown DNS provider")
+	// ErrHostnameNotInZone is returned when a hostname is not part of the DNS zone
+	ErrHostnameNotInZone = errors.New("hostname is not part of the DNS zone")
+)
+
+// Provider manages the record sets of DNS zones as Pulumi resources,
+// so changed records are updated in place and drift is detected on refresh
+type Provider interface {
+	// NewRecord creates the record set resource, changed values and TTL are updated in place
+	NewRecord(ctx *pulumi.Context, name string, args *RecordArgs, opts ...pulumi.ResourceOption) (pulumi.Resource, error)
+}
+
+// ProviderArgs are the arguments for the NewProvider function
+type ProviderArgs struct {
+	// Config is the DNS configuration of the API endpoint
+	Config *config.APIEndpointDNSConfig
+	// HetznerProvider manages the records if the configuration has no token and API URL of its own
+	HetznerProvider *hcloud.Provider
+	// Token authenticates the requests if the configuration has none, e.g. the Hetzner token
+	Token string
+}
+
+// NewProvider returns the DNS provider of the configuration.
+// A configuration with its own token or API URL gets its own hcloud provider, e.g. for a zone in another project.
+func NewProvider(ctx *pulumi.Context, name string, args *ProviderArgs, opts ...pulumi.ResourceOption) (Provider, error) {
+	cfg := args.Config
+
+	switch cfg.Provider {
+	case ProviderHetzner, "":
+		if cfg.Token == "" && cfg.APIURL == nil {
+			return &HetznerProvider{Provider: args.HetznerProvider}, nil
+		}
+
+		token := args.Token
+		if cfg.Token != "" {
+			token = cfg.Token
+		}
+		hetznerProvider, err := hcloud.NewProvider(ctx, fmt.Sprintf("%s-dns", name), &hcloud.ProviderArgs{
+			Token:    pulumi.String(token),
+			Endpoint: pulumi.StringPtrFromPtr(cfg.APIURL),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &HetznerProvider{Provider: hetznerProvider}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, cfg.Provider)
+	}
+}
+
+// RelativeName returns the name of the hostname relative to the zone, "@" for the zone itself
+func RelativeName(hostname, zone string) (string, error) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+
+	if hostname == zone {
+		return apexName, nil
+	}
+
+	name, found := strings.CutSuffix(hostname, "."+zone)
+	if !found || name == "" {
+		return "", fmt.Errorf("%w: %s in %s", ErrHostnameNotInZone, hostname, zone)
+	}
+
+	return name, nil
+}
@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelativeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		hostname string
+		zone     string
+		want     string
+		wantErr  error
+	}{
+		{name: "subdomain", hostname: "api.cluster.example.com", zone: "example.com", want: "api.cluster"},
+		{name: "zone apex", hostname: "example.com", zone: "example.com", want: "@"},
+		{name: "trailing dots and case", hostname: "API.example.com.", zone: "Example.com.", want: "api"},
+		{name: "other zone", hostname: "api.example.org", zone: "example.com", wantErr: ErrHostnameNotInZone},
+		{name: "suffix without label boundary", hostname: "apiexample.com", zone: "example.com", wantErr: ErrHostnameNotInZone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RelativeName(tt.hostname, tt.zone)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	apiURL := "http://127.0.0.1:8080/v1"
+	m := &mocks{}
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		hetznerProvider, err := hcloud.NewProvider(ctx, "staging-hetzner", &hcloud.ProviderArgs{Token: pulumi.String("hcloud-token")})
+		require.NoError(t, err)
+
+		provider, err := NewProvider(ctx, "staging", &ProviderArgs{
+			Config:          &config.APIEndpointDNSConfig{Provider: ProviderHetzner},
+			HetznerProvider: hetznerProvider,
+			Token:           "hcloud-token",
+		})
+		require.NoError(t, err)
+		assert.Same(t, hetznerProvider, provider.(*HetznerProvider).Provider, "the Hetzner provider manages the records of the project")
+
+		provider, err = NewProvider(ctx, "staging", &ProviderArgs{
+			Config:          &config.APIEndpointDNSConfig{Token: "dns-token", APIURL: &apiURL},
+			HetznerProvider: hetznerProvider,
+			Token:           "hcloud-token",
+		})
+		require.NoError(t, err)
+		assert.NotSame(t, hetznerProvider, provider.(*HetznerProvider).Provider, "a zone with its own token gets its own provider")
+
+		_, err = NewProvider(ctx, "staging", &ProviderArgs{Config: &config.APIEndpointDNSConfig{Provider: "route53"}})
+		assert.ErrorIs(t, err, ErrUnknownProvider)
+		return nil
+	}, pulumi.WithMocks("project", "stack", m))
+	require.NoError(t, err)
+
+	dnsProvider := m.resource(t, "pulumi:providers:hcloud", "staging-dns")
+	assert.Equal(t, "dns-token", dnsProvider.Inputs["token"].SecretValue().Element.StringValue(), "the token of the configuration is preferred")
+	assert.Equal(t, apiURL, dnsProvider.Inputs["endpoint"].StringValue())
+}
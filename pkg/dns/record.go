@@ -0,0 +1,19 @@
+package dns
+
+import "github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+
+// RecordArgs are the arguments of a record set, see Provider.NewRecord
+type RecordArgs struct {
+	// ClusterName is the name of the cluster, it is the value of the cluster label of the record set
+	ClusterName string
+	// Zone is the name of the DNS zone
+	Zone string
+	// Name is the name of the records relative to the zone, see RelativeName
+	Name string
+	// Type is the record type, e.g. "A" or "AAAA"
+	Type string
+	// TTL of the records in seconds
+	TTL int
+	// Values are the values of the records, e.g. the IP addresses of the API endpoint
+	Values pulumi.StringArrayInput
+}
@@ -0,0 +1,132 @@
+package compute
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ErrCreationOnlyChange indicates existing nodes which were created with other creation-only configuration
+var ErrCreationOnlyChange = errors.New("creation-only configuration changed, existing nodes keep the configuration they were created with")
+
+// CreationTracking stores the hash of the creation-only configuration in a label of the servers, which is never updated.
+// Existing servers with another hash are handled by the creation-only change policy.
+type CreationTracking struct {
+	// Hash identifies the creation-only configuration of new nodes, see NodeConfigurations.CreationHash
+	Hash string
+	// Policy is the creation-only change policy, see config.TalosConfig.CreationOnlyChanges
+	Policy string
+	// Servers are the existing servers of the cluster with the node type of the pool by their node name, see findServers
+	Servers map[string]hcloud.GetServersServer
+}
+
+// findServers returns the existing servers of the cluster with the node type by their node name, see nodeNameOfServer
+func findServers(ctx *pulumi.Context, clusterName string, serverNodeType meta.ServerNodeType, opts ...pulumi.InvokeOption) (map[string]hcloud.GetServersServer, error) {
+	servers, err := findClusterServers(ctx, clusterName, []string{fmt.Sprintf("type=%s", serverNodeType)}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]hcloud.GetServersServer, len(servers))
+	for _, server := range servers {
+		byName[nodeNameOfServer(clusterName, server.Name)] = server
+	}
+
+	return byName, nil
+}
+
+// findClusterServers returns the servers of the cluster in the stack which meet the requirements.
+// Servers created before they were labeled with their cluster are included, they get the label with their next update.
+func findClusterServers(ctx *pulumi.Context, clusterName string, requirements []string, opts ...pulumi.InvokeOption) ([]hcloud.GetServersServer, error) {
+	selectors := []string{
+		meta.ClusterSelector(ctx, clusterName, requirements...),
+		meta.LegacyClusterSelector(ctx, requirements...),
+	}
+
+	out := []hcloud.GetServersServer{}
+	for _, selector := range selectors {
+		servers, err := hcloud.GetServers(ctx, &hcloud.GetServersArgs{
+			WithSelector: pulumi.StringRef(selector),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, servers.Servers...)
+	}
+
+	return out, nil
+}
+
+// generationHash returns the creation hash which is part of the generation of pools with rolling replacement.
+// Only with the policy replace, a changed creation-only configuration creates new nodes.
+func (c *CreationTracking) generationHash() string {
+	if c == nil || c.Policy != config.CreationOnlyChangesReplace {
+		return ""
+	}
+
+	return c.Hash
+}
+
+// outdated returns the names of the existing servers of the nodes which were created with another hash, sorted.
+// Servers without the label were created before the hash was tracked, they are assumed to be up to date.
+func (c *CreationTracking) outdated(names []string) []string {
+	outdated := []string{}
+	for _, name := range names {
+		server, ok := c.Servers[name]
+		if !ok {
+			continue
+		}
+
+		hash, tracked := server.Labels[meta.CreationHashLabel]
+		if tracked && hash != c.Hash {
+			outdated = append(outdated, name)
+		}
+	}
+	sort.Strings(outdated)
+
+	return outdated
+}
+
+// check applies the policy to the existing servers of the nodes with the given names.
+// Pools with rolling replacement and the policy replace never have outdated servers, their generation includes the hash.
+func (c *CreationTracking) check(ctx *pulumi.Context, poolName string, names []string) error {
+	if c == nil {
+		return nil
+	}
+
+	outdated := c.outdated(names)
+	if len(outdated) == 0 {
+		return nil
+	}
+
+	switch c.Policy {
+	case config.CreationOnlyChangesWarn:
+		return ctx.Log.Warn(fmt.Sprintf("pool %s: %s: %s, decommission the nodes to replace them", poolName, ErrCreationOnlyChange, strings.Join(outdated, ", ")), nil)
+	case config.CreationOnlyChangesReplace:
+		return fmt.Errorf("pool %s: %w: %s, the pool has no rolling replacement to replace them", poolName, ErrCreationOnlyChange, strings.Join(outdated, ", "))
+	default:
+		return fmt.Errorf("pool %s: %w: %s", poolName, ErrCreationOnlyChange, strings.Join(outdated, ", "))
+	}
+}
+
+// serverOptions keeps the label of an existing server with the hash it was created with.
+// Servers without the label get the current hash.
+func (c *CreationTracking) serverOptions(name string) []pulumi.ResourceOption {
+	if c == nil {
+		return nil
+	}
+
+	if _, tracked := c.Servers[name].Labels[meta.CreationHashLabel]; !tracked {
+		return nil
+	}
+
+	return []pulumi.ResourceOption{
+		pulumi.IgnoreChanges([]string{fmt.Sprintf("labels[%q]", meta.CreationHashLabel)}),
+	}
+}
@@ -0,0 +1,82 @@
+package compute
+
+import (
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreationTracking_check(t *testing.T) {
+	servers := map[string]hcloud.GetServersServer{
+		"pool-0": {Name: "pool-0", Labels: map[string]string{meta.CreationHashLabel: "current"}},
+		"pool-1": {Name: "pool-1", Labels: map[string]string{meta.CreationHashLabel: "previous"}},
+		"pool-2": {Name: "pool-2", Labels: map[string]string{}},
+		"other":  {Name: "other", Labels: map[string]string{meta.CreationHashLabel: "previous"}},
+	}
+	names := []string{"pool-0", "pool-1", "pool-2", "pool-3"}
+
+	tests := []struct {
+		name     string
+		creation *CreationTracking
+		wantErr  string
+	}{
+		{name: "not tracked"},
+		{
+			name:     "warn",
+			creation: &CreationTracking{Hash: "current", Policy: config.CreationOnlyChangesWarn, Servers: servers},
+		},
+		{
+			name:     "fail",
+			creation: &CreationTracking{Hash: "current", Policy: config.CreationOnlyChangesFail, Servers: servers},
+			wantErr:  "pool pool: " + ErrCreationOnlyChange.Error() + ": pool-1",
+		},
+		{
+			name:     "replace without rolling replacement",
+			creation: &CreationTracking{Hash: "current", Policy: config.CreationOnlyChangesReplace, Servers: servers},
+			wantErr:  "the pool has no rolling replacement",
+		},
+		{
+			name:     "unchanged",
+			creation: &CreationTracking{Hash: "previous", Policy: config.CreationOnlyChangesFail, Servers: map[string]hcloud.GetServersServer{"pool-1": servers["pool-1"]}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+				return tt.creation.check(ctx, "pool", names)
+			}, pulumi.WithMocks("project", "stack", mocks(0)))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCreationTracking_outdated(t *testing.T) {
+	creation := &CreationTracking{
+		Hash: "current",
+		Servers: map[string]hcloud.GetServersServer{
+			"pool-2": {Labels: map[string]string{meta.CreationHashLabel: ""}},
+			"pool-1": {Labels: map[string]string{meta.CreationHashLabel: "previous"}},
+			"pool-0": {Labels: map[string]string{}},
+		},
+	}
+
+	assert.Equal(t, []string{"pool-1", "pool-2"}, creation.outdated([]string{"pool-2", "pool-1", "pool-0"}))
+	assert.Len(t, creation.serverOptions("pool-1"), 1, "the label of tracked servers is kept")
+	assert.Empty(t, creation.serverOptions("pool-0"), "untracked servers get the current hash")
+	assert.Empty(t, creation.serverOptions("pool-3"), "new servers get the current hash")
+}
+
+func TestCreationTracking_generationHash(t *testing.T) {
+	var untracked *CreationTracking
+	assert.Empty(t, untracked.generationHash())
+	assert.Empty(t, (&CreationTracking{Hash: "current", Policy: config.CreationOnlyChangesWarn}).generationHash())
+	assert.Equal(t, "current", (&CreationTracking{Hash: "current", Policy: config.CreationOnlyChangesReplace}).generationHash())
+}
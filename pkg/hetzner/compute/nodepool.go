@@ -9,6 +9,8 @@ import (
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/network"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/charts/cilium"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/helm"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/cli"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/core"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
@@ -18,19 +20,24 @@ import (
 )
 
 var (
-	// talosUpgradeQueue is a queue of nodes to be upgraded
-	// this is used to upgrade the nodes in the node pool
-	// in a controlled manner
-	// the nodes are upgraded one by one
-	talosUpgradeQueue = []pulumi.Resource{}
-
 	// ErrAutoScalerNotSupportedForControlPlane indicates that auto-scaler nodes are not supported for control plane node pools
 	ErrAutoScalerNotSupportedForControlPlane = errors.New("auto-scaler nodes are not supported for control plane node pools")
+	// ErrAutoScalerRequiresPublicIPv4 indicates that the cluster autoscaler only creates nodes with public IPv4
+	ErrAutoScalerRequiresPublicIPv4 = errors.New("auto-scaler nodes require a public IPv4 network")
+	// ErrNATGatewayMissing indicates that a node pool without public IPv4 is deployed without NAT gateway
+	ErrNATGatewayMissing = errors.New("node pools without public IPv4 require the NAT gateway of the network")
+	// ErrTalosEndpointMissing indicates that a node pool without public IPv4 is deployed without control plane load balancer
+	ErrTalosEndpointMissing = errors.New("node pools without public IPv4 require the control plane load balancer, their Talos API is reached through it")
 )
 
 type NodePoolArgs struct {
+	// ClusterName prefixes the names of all resources of the pool and of new servers and volumes,
+	// it is the value of the cluster label of the servers and volumes
+	ClusterName string
 	// Count is the number of nodes in the pool
 	Count int
+	// Decommission are the indices of nodes which are removed from the pool, they are skipped when the nodes are numbered
+	Decommission []int
 	// ServerSize is the server type to use for the nodes
 	ServerSize string
 	// Images are the images to use for the nodes
@@ -60,9 +67,29 @@ type NodePoolArgs struct {
 	Firewall *hcloud.Firewall
 	// Protect the resource from accidental deletion
 	Protect bool
+	// UpgradeStrategy controls how Talos upgrades roll through the pool
+	UpgradeStrategy UpgradeStrategy
+	// Replacement replaces the nodes with new servers when their specification changes
+	// this is optional and can be nil, the servers are then changed in place
+	Replacement *ReplacementStrategy
+	// Creation tracks the creation-only configuration the servers were created with
+	// this is optional and can be nil
+	Creation *CreationTracking
+	// Volumes are created and attached for every node, they are mounted by the node configuration
+	Volumes []config.NodeVolumeConfig
+	// PublicNetwork is the public network of the nodes, see config.NodePoolConfig.PublicNetwork. Empty is "dual".
+	PublicNetwork string
+	// TalosEndpoint is the Talos API endpoint of the configuration applies of the nodes without public IPv4,
+	// see core.MachineConfigurationManager.TalosEndpoint
+	TalosEndpoint pulumi.StringInput
+	// Parent is the parent of the resources of the auto-scaler nodes and the retired nodes, they have no server to be created below
+	// this is optional and can be nil
+	Parent pulumi.Resource
 }
 
 type NodePool struct {
+	// ClusterName prefixes the names of all resources of the pool
+	ClusterName string
 	// NodePoolName is the name of the node pool
 	NodePoolName string
 	// ServerNodeType is the type of server node
@@ -75,12 +102,47 @@ type NodePool struct {
 	Nodes []Node
 	// AutoScalerNodes are the nodes in the node pool that are part of the auto-scaler
 	AutoScalerNodes []hcloud.GetServersServer
+	// UpgradeStrategy controls how Talos upgrades roll through the pool
+	UpgradeStrategy UpgradeStrategy
+	// Parent is the parent of the resources of the auto-scaler nodes
+	Parent pulumi.Resource
+	// TalosEndpoint is the Talos API endpoint of the configuration applies of the nodes without public IPv4,
+	// it proxies the requests through the private network
+	TalosEndpoint pulumi.StringInput
+
+	// machineConfiguration is generated once, see MachineConfiguration
+	machineConfiguration *pulumi.StringOutput
 }
 
 type Node struct {
-	Node    *hcloud.Server
+	// Index is the stable number of the node in its pool, it is part of the server and resource names
+	Index int
+	// Generation is the specification of the server of a pool with rolling replacement, it is part of the server and resource names
+	Generation string
+	Node       *hcloud.Server
+	// Network attaches the server to the private network, nil for servers without public IPv4 which are created in it
 	Network *hcloud.ServerNetwork
 	Protect bool
+	// Private is set for servers without public IPv4, their Talos API is reached through the private network
+	Private bool
+}
+
+// PrivateIP returns the IP of the node in the private network, the IP it is registered with in Kubernetes
+func (n Node) PrivateIP() pulumi.StringOutput {
+	if n.Network != nil {
+		return n.Network.Ip
+	}
+
+	return n.Node.Networks.Index(pulumi.Int(0)).Ip().Elem()
+}
+
+// Address returns the Talos API address of the node, its public IPv4 or, without it, its private IP
+func (n Node) Address() pulumi.StringOutput {
+	if n.Private {
+		return n.PrivateIP()
+	}
+
+	return n.Node.Ipv4Address
 }
 
 // NewNodePool creates a new node pool in Hetzner Cloud.
@@ -113,71 +175,165 @@ func NewNodePool(ctx *pulumi.Context, name string, args *NodePoolArgs, opts ...p
 		}
 	}
 
-	nodes := make([]Node, args.Count)
+	// worker servers were created at the top level before the cluster became a component resource,
+	// control plane servers keep the placement group as parent and inherit its aliases
+	legacyServerAlias := func(nodeName string) pulumi.ResourceOption {
+		if args.ServerNodeType == meta.WorkerNode {
+			return meta.LegacyAlias(ctx, nodeName, "hcloud:index/server:Server")
+		}
+		return meta.LegacyName(nodeName)
+	}
 
-	for i := 0; i < args.Count; i++ {
-		nodeName := fmt.Sprintf("%s-%d", name, i)
-		nodeName = strings.ToLower(nodeName) // Hetzner CCM requires nodes to have lowercase names
+	// servers of a pool with rolling replacement carry their generation, a new generation creates new servers
+	var generation string
+	if args.Replacement != nil {
+		generation = nodeGeneration(args.ServerSize, args.Region, args.Arch, args.Images, args.Creation.generationHash())
+	}
 
-		server, err := hcloud.NewServer(ctx, nodeName, &hcloud.ServerArgs{
-			Name:       pulumi.String(nodeName),
-			Image:      pulumi.Sprintf("%d", img.ImageId()),
-			ServerType: pulumi.String(args.ServerSize),
-			Location:   pulumi.String(args.Region),
-			Backups:    pulumi.Bool(args.EnableBackup),
-			Labels: meta.NewLabels(ctx, &meta.ServerLabelsArgs{
-				ServerNodeType: args.ServerNodeType,
-				Region:         &args.Region,
-				Arch:           &args.Arch,
-				NodePoolName:   args.NodePoolName,
-			}),
-			PublicNets: hcloud.ServerPublicNetArray{
-				&hcloud.ServerPublicNetArgs{
-					Ipv4Enabled: pulumi.Bool(true),
-					Ipv6Enabled: pulumi.Bool(true),
-				},
-			},
+	private := args.PublicNetwork != "" && args.PublicNetwork != config.PublicNetworkDual
+
+	networkID := args.Network.Network.ID().ApplyT(func(id pulumi.ID) int {
+		idInt, _ := strconv.Atoi(string(id))
+		return idInt
+	}).(pulumi.IntOutput)
+
+	// the firewall only applies to the public interfaces
+	firewallIDs := pulumi.IntArray{}
+	if args.PublicNetwork != config.PublicNetworkNone {
+		firewallIDs = append(firewallIDs, args.Firewall.ID().ApplyT(func(id pulumi.ID) int {
+			idInt, _ := strconv.Atoi(string(id))
+			return idInt
+		}).(pulumi.IntOutput))
+	}
+
+	indices := nodeIndices(args.Count, args.Decommission)
+
+	names := make([]string, 0, len(indices))
+	for _, index := range indices {
+		names = append(names, serverName(name, index, generation))
+	}
+	err = args.Creation.check(ctx, name, names)
+	if err != nil {
+		return nil, err
+	}
+
+	newNode := func(index int, dependsOn []pulumi.Resource) (Node, error) {
+		nodeName := serverName(name, index, generation)
+
+		serverOpts := append([]pulumi.ResourceOption{}, opts...)
+		serverOpts = append(serverOpts,
+			pulumi.AdditionalSecretOutputs([]string{"userData"}),
+			// servers created before the names were prefixed with the cluster name keep their name
+			pulumi.IgnoreChanges([]string{"userData", "image", "name"}),
+			pulumi.Protect(args.Protect),
+			pulumi.DependsOn(dependsOn),
+		)
+		serverOpts = append(serverOpts, args.Creation.serverOptions(nodeName)...)
+		// servers with a generation never existed under a legacy name
+		if generation == "" {
+			serverOpts = append(serverOpts, legacyServerAlias(nodeName))
+		}
+
+		labelsArgs := &meta.ServerLabelsArgs{
+			ClusterName:    args.ClusterName,
+			ServerNodeType: args.ServerNodeType,
+			Region:         &args.Region,
+			Arch:           &args.Arch,
+			NodePoolName:   args.NodePoolName,
+		}
+		if generation != "" {
+			labelsArgs.Generation = &generation
+		}
+		if args.Creation != nil {
+			labelsArgs.CreationHash = &args.Creation.Hash
+		}
+
+		serverArgs := &hcloud.ServerArgs{
+			Name:                   pulumi.String(clusterServerName(args.ClusterName, nodeName)),
+			Image:                  pulumi.Sprintf("%d", img.ImageId()),
+			ServerType:             pulumi.String(args.ServerSize),
+			Location:               pulumi.String(args.Region),
+			Backups:                pulumi.Bool(args.EnableBackup),
+			Labels:                 meta.NewLabels(ctx, labelsArgs),
+			PublicNets:             publicNets(args.PublicNetwork),
 			UserData:               userData,
 			ShutdownBeforeDeletion: pulumi.BoolPtr(true),
 			PlacementGroupId:       pg,
-			FirewallIds: pulumi.IntArray{
-				args.Firewall.ID().ApplyT(func(id pulumi.ID) int {
-					idInt, _ := strconv.Atoi(string(id))
-					return idInt
-				}).(pulumi.IntOutput),
-			},
-			RebuildProtection: pulumi.Bool(args.Protect),
-			DeleteProtection:  pulumi.Bool(args.Protect),
-		}, append(opts,
-			pulumi.AdditionalSecretOutputs([]string{"userData"}),
-			pulumi.IgnoreChanges([]string{"userData", "image"}),
-			pulumi.Protect(args.Protect),
-		)...)
+			FirewallIds:            firewallIDs,
+			RebuildProtection:      pulumi.Bool(args.Protect),
+			DeleteProtection:       pulumi.Bool(args.Protect),
+		}
+		// a server without public IPv4 must be created in the network, it reaches the internet through the NAT gateway
+		if private {
+			serverArgs.Networks = hcloud.ServerNetworkTypeArray{
+				&hcloud.ServerNetworkTypeArgs{
+					NetworkId: networkID,
+				},
+			}
+			serverOpts = append(serverOpts, pulumi.DependsOn([]pulumi.Resource{args.Network.NetworkSubnet}))
+		}
+
+		server, err := hcloud.NewServer(ctx, fmt.Sprintf("%s-%s", args.ClusterName, nodeName), serverArgs, serverOpts...)
 		if err != nil {
-			return nil, err
+			return Node{}, err
+		}
+
+		err = newNodeVolumes(ctx, args, nodeName, server, opts...)
+		if err != nil {
+			return Node{}, err
+		}
+
+		if private {
+			return Node{
+				Index:      index,
+				Generation: generation,
+				Node:       server,
+				Protect:    args.Protect,
+				Private:    true,
+			}, nil
+		}
+
+		networkOpts := append([]pulumi.ResourceOption{}, opts...)
+		networkOpts = append(networkOpts, pulumi.Parent(server))
+		if generation == "" {
+			networkOpts = append(networkOpts, meta.LegacyName(nodeName))
 		}
 
 		// attach the server to the network
-		network, err := hcloud.NewServerNetwork(ctx, nodeName, &hcloud.ServerNetworkArgs{
+		network, err := hcloud.NewServerNetwork(ctx, fmt.Sprintf("%s-%s", args.ClusterName, nodeName), &hcloud.ServerNetworkArgs{
 			ServerId: server.ID().ApplyT(func(id pulumi.ID) int {
 				idInt, _ := strconv.Atoi(string(id))
 				return idInt
 			}).(pulumi.IntOutput),
-			NetworkId: args.Network.Network.ID().ApplyT(func(id pulumi.ID) int {
-				idInt, _ := strconv.Atoi(string(id))
-				return idInt
-			}).(pulumi.IntOutput),
-		}, append(opts,
-			pulumi.Parent(server),
-		)...)
+			NetworkId: networkID,
+		}, networkOpts...)
 		if err != nil {
-			return nil, err
+			return Node{}, err
 		}
 
-		nodes[i] = Node{
-			Node:    server,
-			Network: network,
-			Protect: args.Protect,
+		return Node{
+			Index:      index,
+			Generation: generation,
+			Node:       server,
+			Network:    network,
+			Protect:    args.Protect,
+		}, nil
+	}
+
+	var nodes []Node
+	if args.Replacement != nil && args.Replacement.Hooks != nil && len(args.Replacement.OutdatedServers) > 0 {
+		nodes, err = args.Replacement.replaceNodes(ctx, args.ClusterName, name, indices, generation, newNode, args.Parent)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		nodes = make([]Node, 0, len(indices))
+		for _, index := range indices {
+			node, err := newNode(index, nil)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
 		}
 	}
 
@@ -187,21 +343,125 @@ func NewNodePool(ctx *pulumi.Context, name string, args *NodePoolArgs, opts ...p
 	}
 
 	return &NodePool{
+		ClusterName:                 args.ClusterName,
 		NodePoolName:                *args.NodePoolName,
 		ServerNodeType:              args.ServerNodeType,
 		MachineConfigurationManager: args.MachineConfigurationManager,
 		ConfigPatches:               args.ConfigPatches,
 		Nodes:                       nodes,
+		UpgradeStrategy:             args.UpgradeStrategy,
+		Parent:                      args.Parent,
+		TalosEndpoint:               args.TalosEndpoint,
 	}, nil
 }
 
+// publicNets returns the public network of the servers, see config.NodePoolConfig.PublicNetwork
+func publicNets(publicNetwork string) hcloud.ServerPublicNetArray {
+	return hcloud.ServerPublicNetArray{
+		&hcloud.ServerPublicNetArgs{
+			Ipv4Enabled: pulumi.Bool(publicNetwork == "" || publicNetwork == config.PublicNetworkDual),
+			Ipv6Enabled: pulumi.Bool(publicNetwork != config.PublicNetworkNone),
+		},
+	}
+}
+
+// newNodeVolumes creates the volumes of a node in the location of its server and attaches them.
+// The volumes belong to the server, they are deleted with it.
+func newNodeVolumes(ctx *pulumi.Context, args *NodePoolArgs, nodeName string, server *hcloud.Server, opts ...pulumi.ResourceOption) error {
+	for _, v := range args.Volumes {
+		volumeName := fmt.Sprintf("%s-%s", nodeName, strings.ToLower(v.Name))
+		volumeOpts := append([]pulumi.ResourceOption{}, opts...)
+		volumeOpts = append(volumeOpts, pulumi.Parent(server), pulumi.Protect(args.Protect))
+
+		vol, err := hcloud.NewVolume(ctx, fmt.Sprintf("%s-%s", args.ClusterName, volumeName), &hcloud.VolumeArgs{
+			Name:     pulumi.String(clusterServerName(args.ClusterName, volumeName)),
+			Size:     pulumi.Int(v.Size),
+			Location: pulumi.String(args.Region),
+			Labels: meta.NewLabels(ctx, &meta.ServerLabelsArgs{
+				ClusterName:    args.ClusterName,
+				ServerNodeType: args.ServerNodeType,
+				NodePoolName:   args.NodePoolName,
+			}),
+			DeleteProtection: pulumi.Bool(args.Protect),
+		}, volumeOpts...)
+		if err != nil {
+			return err
+		}
+
+		_, err = hcloud.NewVolumeAttachment(ctx, fmt.Sprintf("%s-%s", args.ClusterName, volumeName), &hcloud.VolumeAttachmentArgs{
+			ServerId: server.ID().ApplyT(func(id pulumi.ID) int {
+				idInt, _ := strconv.Atoi(string(id))
+				return idInt
+			}).(pulumi.IntOutput),
+			VolumeId: vol.ID().ApplyT(func(id pulumi.ID) int {
+				idInt, _ := strconv.Atoi(string(id))
+				return idInt
+			}).(pulumi.IntOutput),
+			// Talos formats and mounts the volume, see core.NodeConfigurationArgs.Volumes
+			Automount: pulumi.Bool(false),
+		}, volumeOpts...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serverName returns the name of the server of the node with the index.
+// The generation is only set for pools with rolling replacement.
+func serverName(name string, index int, generation string) string {
+	nodeName := fmt.Sprintf("%s-%d", name, index)
+	if generation != "" {
+		nodeName = fmt.Sprintf("%s-%s", nodeName, generation)
+	}
+
+	return strings.ToLower(nodeName) // Hetzner CCM requires nodes to have lowercase names
+}
+
+// clusterServerName returns the Hetzner name of a new server or volume of the cluster.
+// Hetzner names are unique in a project, the cluster name keeps the names of clusters in one project apart.
+func clusterServerName(clusterName, nodeName string) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s", clusterName, nodeName))
+}
+
+// nodeNameOfServer returns the node name of an existing server of the cluster, its name without the cluster prefix.
+// Servers created before the names were prefixed with the cluster name are named after the node.
+func nodeNameOfServer(clusterName, serverName string) string {
+	return strings.TrimPrefix(serverName, strings.ToLower(clusterName)+"-")
+}
+
+// nodeIndices returns the indices of the nodes of a pool with count nodes.
+// Decommissioned indices are skipped, so the other nodes keep their names when a node in the middle is removed.
+func nodeIndices(count int, decommission []int) []int {
+	skip := map[int]bool{}
+	for _, index := range decommission {
+		skip[index] = true
+	}
+
+	indices := make([]int, 0, count)
+	for index := 0; len(indices) < count; index++ {
+		if !skip[index] {
+			indices = append(indices, index)
+		}
+	}
+
+	return indices
+}
+
 // FindNodePoolAutoScalerNodes finds the nodes in the node pool that are part of the auto-scaler.
 // This fetch the Hetzner API to add the nodes which are created by the auto-scaler.
+// The auto-scaler only labels its servers with the node pool, the servers of the cluster are the ones in the network of the cluster.
 func (n *NodePool) FindNodePoolAutoScalerNodes(ctx *pulumi.Context, opts ...pulumi.InvokeOption) error {
 	if n.ServerNodeType == meta.ControlPlaneNode {
 		return fmt.Errorf("node pool %s: %w", n.NodePoolName, ErrAutoScalerNotSupportedForControlPlane)
 	}
 
+	networkIDs, err := findClusterNetworkIDs(ctx, n.ClusterName, opts...)
+	if err != nil {
+		return err
+	}
+
 	selector := fmt.Sprintf("%s=%s,!project", meta.NodePoolLabel, n.NodePoolName)
 
 	nodes, err := hcloud.GetServers(ctx, &hcloud.GetServersArgs{
@@ -211,34 +471,166 @@ func (n *NodePool) FindNodePoolAutoScalerNodes(ctx *pulumi.Context, opts ...pulu
 		return err
 	}
 
-	n.AutoScalerNodes = nodes.Servers
+	n.AutoScalerNodes = serversInNetworks(nodes.Servers, networkIDs)
 
 	return nil
 }
 
+// findClusterNetworkIDs returns the IDs of the networks of the cluster in the stack.
+// Networks created before they were labeled with their cluster are included, they get the label with their next update.
+func findClusterNetworkIDs(ctx *pulumi.Context, clusterName string, opts ...pulumi.InvokeOption) (map[int]bool, error) {
+	selectors := []string{
+		meta.ClusterSelector(ctx, clusterName),
+		meta.LegacyClusterSelector(ctx),
+	}
+
+	ids := map[int]bool{}
+	for _, selector := range selectors {
+		networks, err := hcloud.GetNetworks(ctx, &hcloud.GetNetworksArgs{
+			WithSelector: pulumi.StringRef(selector),
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, network := range networks.Networks {
+			ids[network.Id] = true
+		}
+	}
+
+	return ids, nil
+}
+
+// serversInNetworks filters the servers which are attached to one of the networks
+func serversInNetworks(servers []hcloud.GetServersServer, networkIDs map[int]bool) []hcloud.GetServersServer {
+	out := []hcloud.GetServersServer{}
+	for _, server := range servers {
+		for _, network := range server.Networks {
+			if networkIDs[network.NetworkId] {
+				out = append(out, server)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+// PrivateIPs returns the private network IPs of all nodes in the node pool, including the auto-scaler nodes.
+// These are the IPs the nodes are registered with in Kubernetes.
+func (n *NodePool) PrivateIPs() []pulumi.StringOutput {
+	ips := []pulumi.StringOutput{}
+	for _, node := range n.Nodes {
+		ips = append(ips, node.PrivateIP())
+	}
+
+	for _, node := range n.AutoScalerNodes {
+		if len(node.Networks) == 0 {
+			continue
+		}
+		ips = append(ips, pulumi.String(node.Networks[0].Ip).ToStringOutput())
+	}
+
+	return ips
+}
+
+// MachineConfiguration returns the machine configuration of the nodes in the node pool, with the config patches applied.
+// It is generated once and shared by the configuration applies and the Kubernetes upgrade.
+func (n *NodePool) MachineConfiguration(ctx *pulumi.Context) (pulumi.StringOutput, error) {
+	if n.machineConfiguration == nil {
+		machineConfiguration, err := n.MachineConfigurationManager.NewMachineConfiguration(ctx, &core.MachineConfigurationArgs{
+			ServerNodeType: n.ServerNodeType,
+			ConfigPatches:  n.ConfigPatches,
+		})
+		if err != nil {
+			return pulumi.StringOutput{}, err
+		}
+		n.machineConfiguration = &machineConfiguration
+	}
+
+	return *n.machineConfiguration, nil
+}
+
+// KubernetesUpgradeNodes returns the nodes of the node pool, including the auto-scaler nodes, for the Kubernetes upgrade
+func (n *NodePool) KubernetesUpgradeNodes(ctx *pulumi.Context) ([]cli.KubernetesUpgradeNode, error) {
+	machineConfiguration, err := n.MachineConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []cli.KubernetesUpgradeNode{}
+	for _, node := range n.Nodes {
+		nodes = append(nodes, cli.KubernetesUpgradeNode{
+			Address:              node.Address(),
+			InternalIP:           node.PrivateIP(),
+			MachineConfiguration: machineConfiguration,
+		})
+	}
+
+	for _, node := range n.AutoScalerNodes {
+		if len(node.Networks) == 0 {
+			continue
+		}
+		nodes = append(nodes, cli.KubernetesUpgradeNode{
+			Address:              pulumi.String(node.Ipv4Address).ToStringOutput(),
+			InternalIP:           pulumi.String(node.Networks[0].Ip).ToStringOutput(),
+			MachineConfiguration: machineConfiguration,
+		})
+	}
+
+	return nodes, nil
+}
+
+// resourceName prefixes the name of a resource of the node pool with the cluster name
+func (n *NodePool) resourceName(name string) string {
+	return fmt.Sprintf("%s-%s", n.ClusterName, name)
+}
+
+// nodeName returns the name of the node in the names of its resources
+func (n *NodePool) nodeName(node Node) string {
+	if node.Generation != "" {
+		return fmt.Sprintf("%s-%d-%s", n.NodePoolName, node.Index, node.Generation)
+	}
+
+	return fmt.Sprintf("%s-%d", n.NodePoolName, node.Index)
+}
+
+// legacyName returns the name the resources of the node had before they were prefixed with the cluster name.
+// Nodes with a generation were created afterwards and have no legacy name.
+func (n *NodePool) legacyName(node Node) string {
+	if node.Generation != "" {
+		return ""
+	}
+
+	return n.nodeName(node)
+}
+
 // ApplyConfigPatches applies the config patches to the nodes in the node pool.
 func (n *NodePool) ApplyConfigPatches(ctx *pulumi.Context, opts ...pulumi.ResourceOption) ([]*machine.ConfigurationApply, error) {
-	machineConfiguration, err := n.MachineConfigurationManager.NewMachineConfiguration(ctx, &core.MachineConfigurationArgs{
-		ServerNodeType: n.ServerNodeType,
-		ConfigPatches:  n.ConfigPatches,
-	})
+	machineConfiguration, err := n.MachineConfiguration(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	configurationApplies := []*machine.ConfigurationApply{}
 
-	for i, node := range n.Nodes {
-		configurationApply, err := machine.NewConfigurationApply(ctx, fmt.Sprintf("%s-%d", n.NodePoolName, i), &machine.ConfigurationApplyArgs{
+	for _, node := range n.Nodes {
+		nodeOpts := append([]pulumi.ResourceOption{}, opts...)
+		nodeOpts = append(nodeOpts, pulumi.Parent(node.Node), pulumi.Protect(false))
+		if legacyName := n.legacyName(node); legacyName != "" {
+			nodeOpts = append(nodeOpts, meta.LegacyName(legacyName))
+		}
+
+		applyArgs := &machine.ConfigurationApplyArgs{
 			ClientConfiguration:       n.MachineConfigurationManager.Secrets.ClientConfiguration,
 			MachineConfigurationInput: machineConfiguration,
-			Node:                      node.Node.Ipv4Address,
+			Node:                      node.Address(),
 			ConfigPatches:             n.ConfigPatches,
-		}, append(opts,
-			pulumi.Parent(node.Node),
-			pulumi.DependsOn(talosUpgradeQueue),
-			pulumi.Protect(false),
-		)...)
+		}
+		if node.Private {
+			applyArgs.Endpoint = n.TalosEndpoint
+		}
+
+		configurationApply, err := machine.NewConfigurationApply(ctx, n.resourceName(n.nodeName(node)), applyArgs, nodeOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -246,12 +638,16 @@ func (n *NodePool) ApplyConfigPatches(ctx *pulumi.Context, opts ...pulumi.Resour
 	}
 
 	for _, node := range n.AutoScalerNodes {
-		configurationApply, err := machine.NewConfigurationApply(ctx, node.Name, &machine.ConfigurationApplyArgs{
+		configurationApply, err := machine.NewConfigurationApply(ctx, n.resourceName(node.Name), &machine.ConfigurationApplyArgs{
 			ClientConfiguration:       n.MachineConfigurationManager.Secrets.ClientConfiguration,
 			MachineConfigurationInput: machineConfiguration,
 			Node:                      pulumi.String(node.Ipv4Address),
 			ConfigPatches:             n.ConfigPatches,
-		}, append(opts, pulumi.Protect(false))...)
+		}, append(opts,
+			pulumi.Parent(n.Parent),
+			pulumi.Protect(false),
+			meta.LegacyAlias(ctx, node.Name, "talos:machine/configurationApply:ConfigurationApply"),
+		)...)
 		if err != nil {
 			return nil, err
 		}
@@ -261,120 +657,328 @@ func (n *NodePool) ApplyConfigPatches(ctx *pulumi.Context, opts ...pulumi.Resour
 }
 
 type UpgradeTalosArgs struct {
-	// Talosconfig is the talos configuration to use for the Talos CLI
-	Talosconfig pulumi.StringOutput
+	// Hooks upgrade and reset the nodes through the Talos API
+	Hooks *cli.TalosHooks
 	// TalosVersion is the version of Talos to upgrade to
 	TalosVersion string
 	// Images are the images to use for the upgrade
 	Images *image.Images
 }
 
+// talosUpgradeTarget is a node of the pool with the arguments of its Talos upgrade
+type talosUpgradeTarget struct {
+	name string
+	args *cli.UpgradeTalosArgs
+	opts []pulumi.ResourceOption
+}
+
+// NewUpgradeTalos upgrades Talos on all nodes of the node pool, including the auto-scaler nodes.
+// The nodes are upgraded in batches as configured by the upgrade strategy of the pool,
+// a batch starts when all nodes of the previous batch are upgraded. The upgrades of all nodes are returned.
 func (n *NodePool) NewUpgradeTalos(ctx *pulumi.Context, args *UpgradeTalosArgs, opts ...pulumi.ResourceOption) ([]pulumi.Resource, error) {
-	for i, node := range n.Nodes {
-		// add network as dependency to ensure network is ready before upgrading Talos
-		talosUpgradeQueue = append(talosUpgradeQueue, node.Network)
-
-		upgradeTalos, err := cli.NewUpgradeTalos(ctx, fmt.Sprintf("%s-%d", n.NodePoolName, i), &cli.UpgradeTalosArgs{
-			Talosconfig:                   args.Talosconfig,
-			TalosVersion:                  args.TalosVersion,
-			Images:                        args.Images,
-			NodeIpv4Address:               node.Node.Ipv4Address,
-			NodeImage:                     node.Node.Image,
-			Protection:                    node.Protect,
-			RemoveNodeFromClusterOnDelete: true,
-		}, append(opts,
-			pulumi.Parent(node.Node),
-			pulumi.DependsOn(talosUpgradeQueue),
-			pulumi.Protect(node.Protect),
-		)...)
-		if err != nil {
-			return nil, err
+	targets := []talosUpgradeTarget{}
+
+	for _, node := range n.Nodes {
+		// ensure network is ready before upgrading Talos, servers without public IPv4 are created in it
+		dependsOn := []pulumi.Resource{}
+		if node.Network != nil {
+			dependsOn = append(dependsOn, node.Network)
 		}
 
-		// add to the upgrade queue to ensure controlled upgrade
-		talosUpgradeQueue = append(talosUpgradeQueue, upgradeTalos.Upgrade)
+		targets = append(targets, talosUpgradeTarget{
+			name: n.resourceName(n.nodeName(node)),
+			args: &cli.UpgradeTalosArgs{
+				LegacyName:                    n.legacyName(node),
+				Hooks:                         args.Hooks,
+				TalosVersion:                  args.TalosVersion,
+				Images:                        args.Images,
+				NodeIpv4Address:               node.Address(),
+				NodeImage:                     node.Node.Image,
+				Protection:                    node.Protect,
+				RemoveNodeFromClusterOnDelete: true,
+				NodeName:                      node.Node.Name,
+				NodeInternalIP:                node.PrivateIP(),
+				ControlPlane:                  n.ServerNodeType == meta.ControlPlaneNode,
+			},
+			opts: []pulumi.ResourceOption{
+				pulumi.Parent(node.Node),
+				pulumi.DependsOn(dependsOn),
+				pulumi.Protect(node.Protect),
+			},
+		})
 	}
 
 	for _, node := range n.AutoScalerNodes {
-		upgradeTalos, err := cli.NewUpgradeTalos(ctx, node.Name, &cli.UpgradeTalosArgs{
-			Talosconfig:                   args.Talosconfig,
-			TalosVersion:                  args.TalosVersion,
-			Images:                        args.Images,
-			NodeIpv4Address:               pulumi.String(node.Ipv4Address).ToStringOutput(),
-			NodeImage:                     pulumi.StringPtr(node.Image).ToStringPtrOutput(),
-			RemoveNodeFromClusterOnDelete: false,
-		}, append(opts, pulumi.DependsOn(talosUpgradeQueue), pulumi.Protect(false))...)
+		targets = append(targets, talosUpgradeTarget{
+			name: n.resourceName(node.Name),
+			args: &cli.UpgradeTalosArgs{
+				LegacyName:                    node.Name,
+				LegacyTopLevel:                true,
+				Hooks:                         args.Hooks,
+				TalosVersion:                  args.TalosVersion,
+				Images:                        args.Images,
+				NodeIpv4Address:               pulumi.String(node.Ipv4Address).ToStringOutput(),
+				NodeImage:                     pulumi.StringPtr(node.Image).ToStringPtrOutput(),
+				RemoveNodeFromClusterOnDelete: false,
+			},
+			opts: []pulumi.ResourceOption{
+				pulumi.Parent(n.Parent),
+				pulumi.Protect(false),
+			},
+		})
+	}
+
+	upgrades := []pulumi.Resource{}
+	previousBatch := []pulumi.Resource{}
+
+	for _, batch := range batches(targets, n.UpgradeStrategy.batchSize(n.ServerNodeType, len(targets))) {
+		currentBatch := []pulumi.Resource{}
+
+		for _, target := range batch {
+			nodeOpts := append([]pulumi.ResourceOption{}, opts...)
+			nodeOpts = append(nodeOpts, target.opts...)
+			nodeOpts = append(nodeOpts, pulumi.DependsOn(previousBatch))
+
+			upgradeTalos, err := cli.NewUpgradeTalos(ctx, target.name, target.args, nodeOpts...)
+			if err != nil {
+				return nil, err
+			}
+			currentBatch = append(currentBatch, upgradeTalos.Upgrade)
+		}
+
+		upgrades = append(upgrades, currentBatch...)
+		previousBatch = currentBatch
+	}
+
+	return upgrades, nil
+}
+
+// BootstrapManifests returns the inline and extra manifests of the control plane configuration.
+// The inline charts are rendered after the inline manifests. With Cilium as CNI,
+// the rendered Cilium chart comes first and the Gateway API CRDs are added.
+func BootstrapManifests(cfg *config.PulumiConfig) ([]config.ClusterInlineManifest, []string, error) {
+	chartManifests, err := helm.NewInlineManifestsFromConfig(cfg.Talos.InlineCharts, cfg.Talos.KubernetesVersion, cfg.Talos.ChartCacheDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inlineManifests := append(append([]config.ClusterInlineManifest{}, cfg.Talos.InlineManifests...), chartManifests...)
+	if cfg.Talos.CNI == nil || cfg.Talos.CNI.Name != config.CNICilium {
+		return inlineManifests, cfg.Talos.ExtraManifests, nil
+	}
+
+	ciliumManifests, err := cilium.NewBootstrapManifests(&cilium.BootstrapManifestsArgs{
+		Config:            cfg.Talos.CNI.Cilium,
+		PodSubnets:        cfg.Network.PodSubnets,
+		KubernetesVersion: cfg.Talos.KubernetesVersion,
+		CacheDir:          cfg.Talos.ChartCacheDir,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inlineManifests = append(ciliumManifests.InlineManifests, inlineManifests...)
+	extraManifests := append(append([]string{}, cfg.Talos.ExtraManifests...), ciliumManifests.ExtraManifests...)
+
+	return inlineManifests, extraManifests, nil
+}
+
+// ControlPlanePoolName returns the name of a control plane pool
+func ControlPlanePoolName(pool *config.ControlPlaneNodePoolConfig) string {
+	return fmt.Sprintf("controlplane-%s-%s", pool.Region, pool.ServerSize)
+}
+
+// NodeConfigurations are the config patches of the nodes of a pool
+type NodeConfigurations struct {
+	// Bootstrap are the config patches the nodes are created with
+	Bootstrap []string
+	// Applied are the config patches applied to existing nodes, they have no creation-only fields
+	Applied []string
+	// CreationHash identifies the creation-only fields of Bootstrap, see core.NodeConfigurationArgs.CreationOnlyFields
+	CreationHash string
+}
+
+// BootstrapSecret returns the bootstrap config patches as secret, they can contain static disk encryption passphrases
+func (c *NodeConfigurations) BootstrapSecret() pulumi.StringArrayOutput {
+	return pulumi.ToSecret(pulumi.ToStringArray(c.Bootstrap)).(pulumi.StringArrayOutput)
+}
+
+// newNodeConfigurations generates the configurations of the nodes of a pool from the arguments of the bootstrap configuration
+func newNodeConfigurations(args *core.NodeConfigurationArgs) (*NodeConfigurations, error) {
+	bootstrap, err := core.NewNodeConfiguration(args)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := core.NewNodeConfiguration(args.Reconcilable())
+	if err != nil {
+		return nil, err
+	}
+
+	creationHash, err := args.CreationHash()
+	if err != nil {
+		return nil, err
+	}
+
+	return &NodeConfigurations{
+		Bootstrap:    bootstrap,
+		Applied:      applied,
+		CreationHash: creationHash,
+	}, nil
+}
+
+// ControlPlaneNodeConfigurations returns the configurations of the nodes of a control plane pool
+func ControlPlaneNodeConfigurations(cfg *config.PulumiConfig, pool *config.ControlPlaneNodePoolConfig, inlineManifests []config.ClusterInlineManifest, extraManifests []string) (*NodeConfigurations, error) {
+	configPatches := append(append([]string{}, cfg.Talos.ConfigPatches...), pool.ConfigPatches...)
+
+	return newNodeConfigurations(&core.NodeConfigurationArgs{
+		ServerNodeType:                 meta.ControlPlaneNode,
+		Subnet:                         cfg.Network.Subnet,
+		PodSubnets:                     cfg.Network.PodSubnets,
+		DNSDomain:                      cfg.Network.DNSDomain,
+		ServiceSubnet:                  cfg.Network.ServiceSubnet,
+		EnableLonghornSupport:          cfg.Talos.EnableLonghorn,
+		LocalStorageFolders:            cfg.Talos.LocalStorageFolders,
+		Nameservers:                    cfg.Network.Nameservers,
+		SecretboxEncryptionSecret:      cfg.Talos.SecretboxEncryptionSecret,
+		AllowSchedulingOnControlPlanes: cfg.Talos.AllowSchedulingOnControlPlanes,
+		NodeLabels:                     pool.Labels,
+		NodeTaints:                     pool.Taints,
+		NodeAnnotations:                pool.Annotations,
+		Registries:                     cfg.Talos.Registries,
+		CertLifetime:                   cfg.Talos.CertLifetime,
+		ExtraManifests:                 extraManifests,
+		ExtraManifestHeaders:           cfg.Talos.ExtraManifestHeaders,
+		InlineManifests:                inlineManifests,
+		EnableHetznerCCMExtraManifest:  cfg.Talos.EnableHetznerCCMExtraManifest,
+		EnableKubeSpan:                 cfg.Talos.EnableKubeSpan,
+		CNI:                            cfg.Talos.CNI,
+		Proxy:                          cfg.Talos.Proxy,
+		ConfigPatches:                  configPatches,
+		CertSANs:                       apiEndpointCertSANs(cfg),
+		DiskEncryption:                 cfg.Talos.DiskEncryption,
+		Ephemeral:                      pool.Ephemeral,
+		ImageCache:                     pool.ImageCache,
+		Swap:                           pool.Swap,
+	})
+}
+
+// apiEndpointCertSANs returns the certificate SANs of the API endpoint hostname, if the control planes have one
+func apiEndpointCertSANs(cfg *config.PulumiConfig) []string {
+	if cfg.ControlPlane.APIEndpoint == nil {
+		return nil
+	}
+
+	return []string{cfg.ControlPlane.APIEndpoint.Hostname}
+}
+
+// WorkerNodeConfigurations returns the configurations of the nodes of a worker pool
+func WorkerNodeConfigurations(cfg *config.PulumiConfig, pool *config.NodePoolConfig) (*NodeConfigurations, error) {
+	configPatches := append(append([]string{}, cfg.Talos.ConfigPatches...), pool.ConfigPatches...)
+
+	// nodes without public IPv4 reach the internet through the route of the network to the NAT gateway
+	var defaultGateway string
+	if !pool.HasPublicIPv4() {
+		gateway, err := network.Gateway(cfg.Network.CIDR)
 		if err != nil {
 			return nil, err
 		}
-		talosUpgradeQueue = append(talosUpgradeQueue, upgradeTalos.Upgrade)
+		defaultGateway = gateway
 	}
 
-	return talosUpgradeQueue, nil
+	return newNodeConfigurations(&core.NodeConfigurationArgs{
+		ServerNodeType:        meta.WorkerNode,
+		Subnet:                cfg.Network.Subnet,
+		PodSubnets:            cfg.Network.PodSubnets,
+		DNSDomain:             cfg.Network.DNSDomain,
+		ServiceSubnet:         cfg.Network.ServiceSubnet,
+		NodeLabels:            pool.Labels,
+		NodeTaints:            pool.Taints,
+		NodeAnnotations:       pool.Annotations,
+		EnableLonghornSupport: cfg.Talos.EnableLonghorn,
+		LocalStorageFolders:   cfg.Talos.LocalStorageFolders,
+		Nameservers:           cfg.Network.Nameservers,
+		Registries:            cfg.Talos.Registries,
+		EnableKubeSpan:        cfg.Talos.EnableKubeSpan,
+		CNI:                   cfg.Talos.CNI,
+		Proxy:                 cfg.Talos.Proxy,
+		ConfigPatches:         configPatches,
+		DiskEncryption:        cfg.Talos.DiskEncryption,
+		Volumes:               pool.Volumes,
+		Ephemeral:             pool.Ephemeral,
+		ImageCache:            pool.ImageCache,
+		Swap:                  pool.Swap,
+		PublicNetwork:         pool.PublicNetwork,
+		DefaultGateway:        defaultGateway,
+	})
+}
+
+// validateNodeConfigurations validates the configurations of the nodes of a pool, when they are created and when they are applied
+func validateNodeConfigurations(validator *core.MachineConfigurationValidator, nodeType meta.ServerNodeType, configurations ...[]string) error {
+	for _, configuration := range configurations {
+		err := validator.Validate(nodeType, configuration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // DeployControlPlanePools deploys all control plane node pools
-func DeployControlPlanePools(ctx *pulumi.Context, cfg *config.PulumiConfig, images *image.Images, net *network.Network, cpPg *hcloud.PlacementGroup, machineConfigurationManager *core.MachineConfigurationManager, firewallCp *hcloud.Firewall, hetznerProvider *hcloud.Provider) ([]*NodePool, error) {
+func DeployControlPlanePools(ctx *pulumi.Context, name string, cfg *config.PulumiConfig, images *image.Images, net *network.Network, cpPg *hcloud.PlacementGroup, machineConfigurationManager *core.MachineConfigurationManager, firewallCp *hcloud.Firewall, hetznerProvider *hcloud.Provider) ([]*NodePool, error) {
 	cpPools := []*NodePool{}
 
+	inlineManifests, extraManifests, err := BootstrapManifests(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := core.NewMachineConfigurationValidator(cfg.Talos.ImageVersion, cfg.Talos.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := findServers(ctx, name, meta.ControlPlaneNode, pulumi.Provider(hetznerProvider))
+	if err != nil {
+		return nil, err
+	}
+
+	// the Kubernetes token manages the floating IP of the Talos VIP, like the CCM does for the load balancers
+	vipToken := cfg.Kubernetes.HCloudToken
+	if vipToken == "" {
+		vipToken = cfg.Hetzner.Token
+	}
+	vipConfigPatch, hasVIP := machineConfigurationManager.ControlplaneVIPConfigPatch(vipToken)
+	talosEndpointConfigPatch, hasTalosEndpoint := machineConfigurationManager.TalosEndpointConfigPatch()
+
 	for _, pool := range cfg.ControlPlane.NodePools {
-		cpNodeConfigurationBootstrap, err := core.NewNodeConfiguration(&core.NodeConfigurationArgs{
-			ServerNodeType:                 meta.ControlPlaneNode,
-			Subnet:                         cfg.Network.Subnet,
-			PodSubnets:                     cfg.Network.PodSubnets,
-			DNSDomain:                      cfg.Network.DNSDomain,
-			ServiceSubnet:                  cfg.Network.ServiceSubnet,
-			EnableLonghornSupport:          cfg.Talos.EnableLonghorn,
-			LocalStorageFolders:            cfg.Talos.LocalStorageFolders,
-			Nameservers:                    cfg.Network.Nameservers,
-			SecretboxEncryptionSecret:      cfg.Talos.SecretboxEncryptionSecret,
-			AllowSchedulingOnControlPlanes: cfg.Talos.AllowSchedulingOnControlPlanes,
-			NodeLabels:                     pool.Labels,
-			NodeTaints:                     pool.Taints,
-			NodeAnnotations:                pool.Annotations,
-			Registries:                     cfg.Talos.Registries,
-			CertLifetime:                   cfg.Talos.CertLifetime,
-			ExtraManifests:                 cfg.Talos.ExtraManifests,
-			ExtraManifestHeaders:           cfg.Talos.ExtraManifestHeaders,
-			InlineManifests:                cfg.Talos.InlineManifests,
-			EnableHetznerCCMExtraManifest:  cfg.Talos.EnableHetznerCCMExtraManifest,
-			EnableKubeSpan:                 cfg.Talos.EnableKubeSpan,
-			CNI:                            cfg.Talos.CNI,
-			DiskEncryption:                 cfg.Talos.DiskEncryption,
-		})
+		configurations, err := ControlPlaneNodeConfigurations(cfg, &pool, inlineManifests, extraManifests)
 		if err != nil {
 			return nil, err
 		}
 
-		cpNodeConfiguration, err := core.NewNodeConfiguration(&core.NodeConfigurationArgs{
-			ServerNodeType:                 meta.ControlPlaneNode,
-			Subnet:                         cfg.Network.Subnet,
-			PodSubnets:                     cfg.Network.PodSubnets,
-			DNSDomain:                      cfg.Network.DNSDomain,
-			ServiceSubnet:                  cfg.Network.ServiceSubnet,
-			EnableLonghornSupport:          cfg.Talos.EnableLonghorn,
-			LocalStorageFolders:            cfg.Talos.LocalStorageFolders,
-			Nameservers:                    cfg.Network.Nameservers,
-			SecretboxEncryptionSecret:      cfg.Talos.SecretboxEncryptionSecret,
-			AllowSchedulingOnControlPlanes: cfg.Talos.AllowSchedulingOnControlPlanes,
-			NodeLabels:                     pool.Labels,
-			NodeTaints:                     pool.Taints,
-			NodeAnnotations:                pool.Annotations,
-			Registries:                     cfg.Talos.Registries,
-			CertLifetime:                   cfg.Talos.CertLifetime,
-			ExtraManifests:                 cfg.Talos.ExtraManifests,
-			ExtraManifestHeaders:           cfg.Talos.ExtraManifestHeaders,
-			InlineManifests:                cfg.Talos.InlineManifests,
-			EnableHetznerCCMExtraManifest:  cfg.Talos.EnableHetznerCCMExtraManifest,
-			EnableKubeSpan:                 cfg.Talos.EnableKubeSpan,
-			CNI:                            cfg.Talos.CNI,
-		})
+		poolName := ControlPlanePoolName(&pool)
+		err = validateNodeConfigurations(validator, meta.ControlPlaneNode, configurations.Bootstrap, configurations.Applied)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("control plane pool %s: %w", poolName, err)
 		}
 
-		cpPool, err := NewNodePool(ctx, fmt.Sprintf("controlplane-%s-%s", pool.Region, pool.ServerSize), &NodePoolArgs{
+		configPatchesBootstrap := configurations.BootstrapSecret()
+		configPatches := pulumi.ToStringArray(configurations.Applied).ToStringArrayOutput()
+		if hasVIP {
+			configPatchesBootstrap = appendConfigPatch(configPatchesBootstrap, vipConfigPatch)
+			configPatches = appendConfigPatch(configPatches, vipConfigPatch)
+		}
+		if hasTalosEndpoint {
+			configPatchesBootstrap = appendConfigPatch(configPatchesBootstrap, talosEndpointConfigPatch)
+			configPatches = appendConfigPatch(configPatches, talosEndpointConfigPatch)
+		}
+
+		cpPool, err := NewNodePool(ctx, poolName, &NodePoolArgs{
+			ClusterName:                 name,
 			Count:                       pool.Count,
+			Decommission:                pool.Decommission,
 			ServerSize:                  pool.ServerSize,
 			Images:                      images,
 			Arch:                        pool.Arch,
@@ -384,10 +988,19 @@ func DeployControlPlanePools(ctx *pulumi.Context, cfg *config.PulumiConfig, imag
 			Network:                     net,
 			EnableBackup:                pool.EnableBackup,
 			MachineConfigurationManager: machineConfigurationManager,
-			ConfigPatchesBootstrap:      pulumi.ToStringArray(cpNodeConfigurationBootstrap),
-			ConfigPatches:               pulumi.ToStringArray(cpNodeConfiguration),
+			ConfigPatchesBootstrap:      configPatchesBootstrap,
+			ConfigPatches:               configPatches,
 			Firewall:                    firewallCp,
 			Protect:                     pool.Protect,
+			// control plane nodes are always upgraded one at a time
+			UpgradeStrategy: UpgradeStrategy{
+				Order: pool.Upgrade.Order,
+			},
+			Creation: &CreationTracking{
+				Hash:    configurations.CreationHash,
+				Policy:  cfg.Talos.CreationOnlyChanges,
+				Servers: servers,
+			},
 		},
 			pulumi.Parent(cpPg),
 			pulumi.Provider(hetznerProvider),
@@ -405,10 +1018,28 @@ func DeployControlPlanePools(ctx *pulumi.Context, cfg *config.PulumiConfig, imag
 	return cpPools, nil
 }
 
-// DeployWorkerPools deploys all worker node pools
-func DeployWorkerPools(ctx *pulumi.Context, cfg *config.PulumiConfig, images *image.Images, net *network.Network, machineConfigurationManager *core.MachineConfigurationManager, firewallWorker *hcloud.Firewall, hetznerProvider *hcloud.Provider) ([]*NodePool, error) {
+// appendConfigPatch appends a config patch which is only known at deployment, e.g. the Talos VIP of the floating IP
+func appendConfigPatch(patches pulumi.StringArrayOutput, patch pulumi.StringOutput) pulumi.StringArrayOutput {
+	return pulumi.All(patches, patch).ApplyT(func(values []interface{}) []string {
+		return append(append([]string{}, values[0].([]string)...), values[1].(string))
+	}).(pulumi.StringArrayOutput)
+}
+
+// DeployWorkerPools deploys all worker node pools below the given parent.
+// The hooks roll pools with rolling replacement, they can be nil.
+func DeployWorkerPools(ctx *pulumi.Context, name string, cfg *config.PulumiConfig, images *image.Images, net *network.Network, machineConfigurationManager *core.MachineConfigurationManager, firewallWorker *hcloud.Firewall, hetznerProvider *hcloud.Provider, hooks *cli.TalosHooks, parent pulumi.Resource) ([]*NodePool, error) {
 	workerPools := []*NodePool{}
 
+	validator, err := core.NewMachineConfigurationValidator(cfg.Talos.ImageVersion, cfg.Talos.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := findServers(ctx, name, meta.WorkerNode, pulumi.Provider(hetznerProvider))
+	if err != nil {
+		return nil, err
+	}
+
 	for _, pool := range cfg.NodePools.NodePools {
 		if pool.Labels == nil {
 			pool.Labels = map[string]string{}
@@ -417,49 +1048,54 @@ func DeployWorkerPools(ctx *pulumi.Context, cfg *config.PulumiConfig, images *im
 			pool.Annotations = map[string]string{}
 		}
 
-		workerNodeConfigurationBootstrap, err := core.NewNodeConfiguration(&core.NodeConfigurationArgs{
-			ServerNodeType:        meta.WorkerNode,
-			Subnet:                cfg.Network.Subnet,
-			PodSubnets:            cfg.Network.PodSubnets,
-			DNSDomain:             cfg.Network.DNSDomain,
-			ServiceSubnet:         cfg.Network.ServiceSubnet,
-			NodeLabels:            pool.Labels,
-			NodeTaints:            pool.Taints,
-			NodeAnnotations:       pool.Annotations,
-			EnableLonghornSupport: cfg.Talos.EnableLonghorn,
-			LocalStorageFolders:   cfg.Talos.LocalStorageFolders,
-			Nameservers:           cfg.Network.Nameservers,
-			Registries:            cfg.Talos.Registries,
-			EnableKubeSpan:        cfg.Talos.EnableKubeSpan,
-			CNI:                   cfg.Talos.CNI,
-			DiskEncryption:        cfg.Talos.DiskEncryption,
-		})
+		poolDependsOn := []pulumi.Resource{firewallWorker}
+		var talosEndpoint pulumi.StringInput
+		if !pool.HasPublicIPv4() {
+			if pool.AutoScaler != nil {
+				return nil, fmt.Errorf("node pool %s: %w", pool.Name, ErrAutoScalerRequiresPublicIPv4)
+			}
+			if net.NATGateway == nil {
+				return nil, fmt.Errorf("node pool %s: %w", pool.Name, ErrNATGatewayMissing)
+			}
+			// the floating IP only comes alive after the bootstrap, which follows the configuration of all nodes
+			if machineConfigurationManager.ControlplaneLoadBalancer == nil {
+				return nil, fmt.Errorf("node pool %s: %w", pool.Name, ErrTalosEndpointMissing)
+			}
+			talosEndpoint, err = machineConfigurationManager.TalosEndpoint()
+			if err != nil {
+				return nil, err
+			}
+			poolDependsOn = append(poolDependsOn, net.NATGateway.Route, machineConfigurationManager.ControlplaneLoadBalancer.TalosService)
+		}
+
+		configurations, err := WorkerNodeConfigurations(cfg, &pool)
 		if err != nil {
 			return nil, err
 		}
 
-		workerNodeConfiguration, err := core.NewNodeConfiguration(&core.NodeConfigurationArgs{
-			ServerNodeType:        meta.WorkerNode,
-			Subnet:                cfg.Network.Subnet,
-			PodSubnets:            cfg.Network.PodSubnets,
-			DNSDomain:             cfg.Network.DNSDomain,
-			ServiceSubnet:         cfg.Network.ServiceSubnet,
-			NodeLabels:            pool.Labels,
-			NodeTaints:            pool.Taints,
-			NodeAnnotations:       pool.Annotations,
-			EnableLonghornSupport: cfg.Talos.EnableLonghorn,
-			LocalStorageFolders:   cfg.Talos.LocalStorageFolders,
-			Nameservers:           cfg.Network.Nameservers,
-			Registries:            cfg.Talos.Registries,
-			EnableKubeSpan:        cfg.Talos.EnableKubeSpan,
-			CNI:                   cfg.Talos.CNI,
-		})
+		err = validateNodeConfigurations(validator, meta.WorkerNode, configurations.Bootstrap, configurations.Applied)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("node pool %s: %w", pool.Name, err)
+		}
+
+		creation := &CreationTracking{
+			Hash:    configurations.CreationHash,
+			Policy:  cfg.Talos.CreationOnlyChanges,
+			Servers: servers,
+		}
+
+		var replacement *ReplacementStrategy
+		if pool.Replacement != nil {
+			replacement, err = newReplacementStrategy(ctx, name, cfg, &pool, images, creation, hooks, hetznerProvider)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		workerPool, err := NewNodePool(ctx, pool.Name, &NodePoolArgs{
+			ClusterName:                 name,
 			Count:                       pool.Count,
+			Decommission:                pool.Decommission,
 			ServerSize:                  pool.ServerSize,
 			Images:                      images,
 			Arch:                        pool.Arch,
@@ -468,13 +1104,25 @@ func DeployWorkerPools(ctx *pulumi.Context, cfg *config.PulumiConfig, images *im
 			ServerNodeType:              meta.WorkerNode,
 			Network:                     net,
 			MachineConfigurationManager: machineConfigurationManager,
-			ConfigPatchesBootstrap:      pulumi.ToStringArray(workerNodeConfigurationBootstrap),
-			ConfigPatches:               pulumi.ToStringArray(workerNodeConfiguration),
+			ConfigPatchesBootstrap:      configurations.BootstrapSecret(),
+			ConfigPatches:               pulumi.ToStringArray(configurations.Applied),
 			Firewall:                    firewallWorker,
 			Protect:                     pool.Protect,
+			UpgradeStrategy: UpgradeStrategy{
+				BatchSize:      pool.Upgrade.BatchSize,
+				MaxUnavailable: pool.Upgrade.MaxUnavailable,
+				Order:          pool.Upgrade.Order,
+			},
+			Replacement:   replacement,
+			Creation:      creation,
+			Volumes:       pool.Volumes,
+			PublicNetwork: pool.PublicNetwork,
+			TalosEndpoint: talosEndpoint,
+			Parent:        parent,
 		},
+			pulumi.Parent(parent),
 			pulumi.Provider(hetznerProvider),
-			pulumi.DependsOn([]pulumi.Resource{firewallWorker}),
+			pulumi.DependsOn(poolDependsOn),
 		)
 		if err != nil {
 			return nil, err
@@ -500,9 +1148,7 @@ func ApplyConfigPatchesToAllPools(ctx *pulumi.Context, cpPools []*NodePool, work
 
 	// Apply config patches to control plane pools
 	for _, cpPool := range cpPools {
-		configurationApply, err := cpPool.ApplyConfigPatches(ctx,
-			append(opts, pulumi.DependsOn(talosUpgradeQueue))...,
-		)
+		configurationApply, err := cpPool.ApplyConfigPatches(ctx, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -511,9 +1157,7 @@ func ApplyConfigPatchesToAllPools(ctx *pulumi.Context, cpPools []*NodePool, work
 
 	// Apply config patches to worker pools
 	for _, workerPool := range workerPools {
-		configurationApply, err := workerPool.ApplyConfigPatches(ctx,
-			append(opts, pulumi.DependsOn(talosUpgradeQueue))...,
-		)
+		configurationApply, err := workerPool.ApplyConfigPatches(ctx, opts...)
 		if err != nil {
 			return nil, err
 		}
@@ -528,34 +1172,74 @@ func ApplyConfigPatchesToAllPools(ctx *pulumi.Context, cpPools []*NodePool, work
 	return out, nil
 }
 
-// UpgradeTalosOnAllPools upgrades Talos on all node pools
-func UpgradeTalosOnAllPools(ctx *pulumi.Context, cpPools []*NodePool, workerPools []*NodePool, talosVersion string, images *image.Images, talosConfig pulumi.StringOutput, opts ...pulumi.ResourceOption) ([]pulumi.Resource, error) {
-	talosUpgradeQueue := []pulumi.Resource{}
+// UpgradeKubernetesOnAllPools creates the Kubernetes upgrade of the cluster.
+// When the Kubernetes version changes, the control plane pools are upgraded first, node by node,
+// then the worker pools, pool by pool. The configuration applies of all pools should depend on the returned upgrade,
+// so that they only run after the new version rolled through the cluster.
+func UpgradeKubernetesOnAllPools(ctx *pulumi.Context, name string, cpPools []*NodePool, workerPools []*NodePool, args *cli.KubernetesUpgradeArgs, opts ...pulumi.ResourceOption) (*cli.KubernetesUpgrade, error) {
+	upgradeArgs := *args
+	upgradeArgs.ControlPlaneNodes = []cli.KubernetesUpgradeNode{}
+	upgradeArgs.WorkerPools = []cli.KubernetesUpgradePool{}
 
-	// Upgrade control plane pools
 	for _, cpPool := range cpPools {
-		talosUpgradeQueuePool, err := cpPool.NewUpgradeTalos(ctx, &UpgradeTalosArgs{
-			Talosconfig:  talosConfig,
-			TalosVersion: talosVersion,
-			Images:       images,
-		}, append(opts, pulumi.DependsOn(talosUpgradeQueue))...)
+		nodes, err := cpPool.KubernetesUpgradeNodes(ctx)
 		if err != nil {
 			return nil, err
 		}
-		talosUpgradeQueue = append(talosUpgradeQueue, talosUpgradeQueuePool...)
+		upgradeArgs.ControlPlaneNodes = append(upgradeArgs.ControlPlaneNodes, nodes...)
 	}
 
-	// Upgrade worker pools
 	for _, workerPool := range workerPools {
-		talosUpgradeQueuePool, err := workerPool.NewUpgradeTalos(ctx, &UpgradeTalosArgs{
-			Talosconfig:  talosConfig,
-			TalosVersion: talosVersion,
-			Images:       images,
-		}, append(opts, pulumi.DependsOn(talosUpgradeQueue))...)
+		nodes, err := workerPool.KubernetesUpgradeNodes(ctx)
 		if err != nil {
 			return nil, err
 		}
-		talosUpgradeQueue = append(talosUpgradeQueue, talosUpgradeQueuePool...)
+		upgradeArgs.WorkerPools = append(upgradeArgs.WorkerPools, cli.KubernetesUpgradePool{
+			Name:  workerPool.NodePoolName,
+			Nodes: nodes,
+		})
+	}
+
+	return cli.NewKubernetesUpgrade(ctx, name, &upgradeArgs, opts...)
+}
+
+// UpgradeTalosOnAllPools upgrades Talos on all node pools.
+// The control plane pools are upgraded first, one after the other and node by node to keep the etcd quorum.
+// Then the worker pools are upgraded in their upgrade order, workerPoolParallelism pools at the same time.
+func UpgradeTalosOnAllPools(ctx *pulumi.Context, cpPools []*NodePool, workerPools []*NodePool, workerPoolParallelism int, talosVersion string, images *image.Images, hooks *cli.TalosHooks, opts ...pulumi.ResourceOption) ([]pulumi.Resource, error) {
+	talosUpgradeQueue := []pulumi.Resource{}
+	upgradeArgs := &UpgradeTalosArgs{
+		Hooks:        hooks,
+		TalosVersion: talosVersion,
+		Images:       images,
+	}
+
+	// Upgrade control plane pools
+	for _, group := range upgradeGroups(cpPools, 1) {
+		for _, cpPool := range group {
+			talosUpgradeQueuePool, err := cpPool.NewUpgradeTalos(ctx, upgradeArgs,
+				append(opts, pulumi.DependsOn(talosUpgradeQueue))...,
+			)
+			if err != nil {
+				return nil, err
+			}
+			talosUpgradeQueue = append(talosUpgradeQueue, talosUpgradeQueuePool...)
+		}
+	}
+
+	// Upgrade worker pools, the pools of a group wait for all previous groups
+	for _, group := range upgradeGroups(workerPools, workerPoolParallelism) {
+		groupQueue := []pulumi.Resource{}
+		for _, workerPool := range group {
+			talosUpgradeQueuePool, err := workerPool.NewUpgradeTalos(ctx, upgradeArgs,
+				append(opts, pulumi.DependsOn(talosUpgradeQueue))...,
+			)
+			if err != nil {
+				return nil, err
+			}
+			groupQueue = append(groupQueue, talosUpgradeQueuePool...)
+		}
+		talosUpgradeQueue = append(talosUpgradeQueue, groupQueue...)
 	}
 
 	return talosUpgradeQueue, nil
@@ -1,15 +1,23 @@
 package compute
 
 import (
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/lb"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/network"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/core"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
 	"github.com/exivity/pulumi-hcloud-upload-image/sdk/go/pulumi-hcloud-upload-image/hcloudimages"
 	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
 	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mocks int
@@ -18,6 +26,16 @@ func (mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.Propert
 	outputs := args.Inputs.Mappable()
 	if args.TypeToken == "hcloud:index/server:Server" {
 		outputs["ipv4Address"] = "10.0.0.1"
+		if networks, ok := outputs["networks"].([]interface{}); ok && len(networks) > 0 {
+			outputs["ipv4Address"] = ""
+			networks[0].(map[string]interface{})["ip"] = "10.128.0.5"
+		}
+	}
+	if args.TypeToken == "hcloud:index/serverNetwork:ServerNetwork" {
+		outputs["ip"] = "10.128.0.2"
+	}
+	if args.TypeToken == "hcloud:index/floatingIp:FloatingIp" {
+		outputs["ipAddress"] = "203.0.113.10"
 	}
 	if args.TypeToken == "hcloud-upload-image:index:UploadedImage" {
 		outputs["imageId"] = 12345
@@ -32,10 +50,20 @@ func (mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
 				map[string]interface{}{
 					"id":   123,
 					"name": "worker-pool-autoscaler-1",
+					"networks": []interface{}{
+						map[string]interface{}{"networkId": 456},
+					},
 				},
 			},
 		}), nil
 	}
+	if args.Token == "hcloud:index/getNetworks:getNetworks" {
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"networks": []interface{}{
+				map[string]interface{}{"id": 456},
+			},
+		}), nil
+	}
 	if args.Token == "talos:machine/getConfiguration:getConfiguration" {
 		return resource.NewPropertyMapFromMap(map[string]interface{}{
 			"machineConfiguration": "mock-configuration",
@@ -238,12 +266,11 @@ func TestNodePool_NewUpgradeTalos(t *testing.T) { //nolint:cyclop // test functi
 					Nodes:                       []Node{{Node: node, Network: network}},
 				},
 				args: &UpgradeTalosArgs{
-					Talosconfig:  pulumi.Sprintf("talosconfig"),
 					TalosVersion: "v1.2.3",
 					Images:       images,
 				},
 				wantErr:   false,
-				wantCount: 2,
+				wantCount: 1,
 			},
 			{
 				name: "WorkerNodeWithAutoScaler",
@@ -260,19 +287,15 @@ func TestNodePool_NewUpgradeTalos(t *testing.T) { //nolint:cyclop // test functi
 					},
 				},
 				args: &UpgradeTalosArgs{
-					Talosconfig:  pulumi.Sprintf("talosconfig"),
 					TalosVersion: "v1.2.3",
 					Images:       images,
 				},
 				wantErr:   false,
-				wantCount: 3,
+				wantCount: 2,
 			},
 		}
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				// Reset the queue
-				talosUpgradeQueue = []pulumi.Resource{}
-
 				got, gotErr := tt.nodePool.NewUpgradeTalos(ctx, tt.args)
 				if (gotErr != nil) != tt.wantErr {
 					t.Errorf("UpgradeTalos() error = %v, wantErr %v", gotErr, tt.wantErr)
@@ -290,3 +313,553 @@ func TestNodePool_NewUpgradeTalos(t *testing.T) { //nolint:cyclop // test functi
 		t.Fatalf("pulumi.RunErr failed: %v", err)
 	}
 }
+
+func TestNodePool_KubernetesUpgradeNodes(t *testing.T) {
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		// Setup MachineConfigurationManager
+		mcm, err := core.NewMachineConfigurationManager(ctx, "test-cluster", &core.MachineConfigurationManagerArgs{
+			SingleControlPlaneNodeIP: pulumi.String("1.2.3.4"),
+			TalosVersion:             "v1.11.3",
+			KubernetesVersion:        "1.34.0",
+		})
+		if err != nil {
+			return err
+		}
+
+		// Create a mock node
+		node, err := hcloud.NewServer(ctx, "test-node", &hcloud.ServerArgs{
+			ServerType: pulumi.String("cx11"),
+			Image:      pulumi.String("ubuntu-20.04"),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Create a mock network attachment
+		network, err := hcloud.NewServerNetwork(ctx, "test-network", &hcloud.ServerNetworkArgs{
+			ServerId:  pulumi.Int(123),
+			NetworkId: pulumi.Int(456),
+			Ip:        pulumi.String("10.0.1.1"),
+		})
+		if err != nil {
+			return err
+		}
+
+		tests := []struct {
+			name      string
+			nodePool  *NodePool
+			wantCount int
+		}{
+			{
+				name: "WorkerNode",
+				nodePool: &NodePool{
+					NodePoolName:                "worker-pool",
+					ServerNodeType:              meta.WorkerNode,
+					MachineConfigurationManager: mcm,
+					Nodes:                       []Node{{Node: node, Network: network}},
+				},
+				wantCount: 1,
+			},
+			{
+				name: "WorkerNodeWithAutoScaler",
+				nodePool: &NodePool{
+					NodePoolName:                "worker-pool-autoscaler",
+					ServerNodeType:              meta.WorkerNode,
+					MachineConfigurationManager: mcm,
+					Nodes:                       []Node{{Node: node, Network: network}},
+					AutoScalerNodes: []hcloud.GetServersServer{
+						{
+							Name:        "autoscaler-node-1",
+							Ipv4Address: "10.0.0.2",
+							Networks:    []hcloud.GetServersServerNetwork{{Ip: "10.0.1.2"}},
+						},
+						{
+							// not attached to the network yet
+							Name:        "autoscaler-node-2",
+							Ipv4Address: "10.0.0.3",
+						},
+					},
+				},
+				wantCount: 2,
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, gotErr := tt.nodePool.KubernetesUpgradeNodes(ctx)
+				if gotErr != nil {
+					t.Errorf("KubernetesUpgradeNodes() error = %v", gotErr)
+					return
+				}
+				if len(got) != tt.wantCount {
+					t.Errorf("KubernetesUpgradeNodes() expected %d nodes, got %d", tt.wantCount, len(got))
+				}
+			})
+		}
+		return nil
+	}, pulumi.WithMocks("project", "stack", mocks(0)))
+
+	if err != nil {
+		t.Fatalf("pulumi.RunErr failed: %v", err)
+	}
+}
+
+// namesMocks records the names of all registered resources
+type namesMocks struct {
+	mocks
+	mu    sync.Mutex
+	names []string
+}
+
+func (m *namesMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	m.names = append(m.names, args.Name)
+	m.mu.Unlock()
+	return m.mocks.NewResource(args)
+}
+
+func TestNodePool_ApplyConfigPatches_clusterNames(t *testing.T) {
+	recorder := &namesMocks{}
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		mcm, err := core.NewMachineConfigurationManager(ctx, "test-cluster", &core.MachineConfigurationManagerArgs{
+			SingleControlPlaneNodeIP: pulumi.String("1.2.3.4"),
+			TalosVersion:             "v1.0.0",
+			KubernetesVersion:        "v1.24.0",
+		})
+		if err != nil {
+			return err
+		}
+
+		node, err := hcloud.NewServer(ctx, "test-node", &hcloud.ServerArgs{
+			ServerType: pulumi.String("cx11"),
+			Image:      pulumi.String("ubuntu-20.04"),
+		})
+		if err != nil {
+			return err
+		}
+
+		// the same pool in two clusters of one program
+		for _, clusterName := range []string{"staging", "tooling"} {
+			pool := &NodePool{
+				ClusterName:                 clusterName,
+				NodePoolName:                "workers",
+				ServerNodeType:              meta.WorkerNode,
+				MachineConfigurationManager: mcm,
+				Nodes:                       []Node{{Node: node}},
+			}
+			if _, err := pool.ApplyConfigPatches(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, pulumi.WithMocks("project", "stack", recorder))
+	require.NoError(t, err)
+
+	assert.Contains(t, recorder.names, "staging-workers-0")
+	assert.Contains(t, recorder.names, "tooling-workers-0")
+}
+
+func Test_newNodeVolumes(t *testing.T) {
+	recorder := &namesMocks{}
+	poolName := "workers"
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		server, err := hcloud.NewServer(ctx, "test-node", &hcloud.ServerArgs{
+			ServerType: pulumi.String("cx22"),
+			Image:      pulumi.String("talos"),
+		})
+		if err != nil {
+			return err
+		}
+
+		return newNodeVolumes(ctx, &NodePoolArgs{
+			ClusterName:    "staging",
+			Region:         "fsn1",
+			ServerNodeType: meta.WorkerNode,
+			NodePoolName:   &poolName,
+			Volumes: []config.NodeVolumeConfig{
+				{Name: "Longhorn", Size: 100, Format: "xfs"},
+				{Name: "cache", Size: 20, Format: "ext4"},
+			},
+		}, "workers-0", server)
+	}, pulumi.WithMocks("project", "stack", recorder))
+	require.NoError(t, err)
+
+	// the volume and its attachment share the name
+	assert.Equal(t, []string{"test-node", "staging-workers-0-longhorn", "staging-workers-0-longhorn", "staging-workers-0-cache", "staging-workers-0-cache"}, recorder.names)
+}
+
+func Test_appendConfigPatch(t *testing.T) {
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		floatingIP, err := lb.NewControlplaneFloatingIP(ctx, "staging", &lb.ControlplaneFloatingIPArgs{HomeLocation: "fsn1"})
+		require.NoError(t, err)
+
+		mcm, err := core.NewMachineConfigurationManager(ctx, "staging", &core.MachineConfigurationManagerArgs{
+			ControlplaneFloatingIP: floatingIP,
+		})
+		require.NoError(t, err)
+		assert.True(t, mcm.HasClusterEndpoint())
+
+		clusterEndpoint, err := mcm.ClusterEndpoint()
+		require.NoError(t, err)
+
+		vipConfigPatch, ok := mcm.ControlplaneVIPConfigPatch("token")
+		require.True(t, ok)
+		wantPatch, err := core.NewControlPlaneVIPConfigPatch("203.0.113.10", "token")
+		require.NoError(t, err)
+
+		patches := appendConfigPatch(pulumi.ToStringArray([]string{"generated"}).ToStringArrayOutput(), vipConfigPatch)
+		pulumi.All(clusterEndpoint, patches).ApplyT(func(args []interface{}) error {
+			assert.Equal(t, "https://203.0.113.10:6443", args[0])
+			assert.Equal(t, []string{"generated", wantPatch}, args[1])
+			return nil
+		})
+		return nil
+	}, pulumi.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func Test_publicNets(t *testing.T) {
+	tests := []struct {
+		name          string
+		publicNetwork string
+		wantIPv4      bool
+		wantIPv6      bool
+	}{
+		{name: "default", publicNetwork: "", wantIPv4: true, wantIPv6: true},
+		{name: "dual", publicNetwork: config.PublicNetworkDual, wantIPv4: true, wantIPv6: true},
+		{name: "ipv6", publicNetwork: config.PublicNetworkIPv6, wantIPv4: false, wantIPv6: true},
+		{name: "none", publicNetwork: config.PublicNetworkNone, wantIPv4: false, wantIPv6: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, hcloud.ServerPublicNetArray{
+				&hcloud.ServerPublicNetArgs{
+					Ipv4Enabled: pulumi.Bool(tt.wantIPv4),
+					Ipv6Enabled: pulumi.Bool(tt.wantIPv6),
+				},
+			}, publicNets(tt.publicNetwork))
+		})
+	}
+}
+
+func TestNode_Address(t *testing.T) {
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		publicServer, err := hcloud.NewServer(ctx, "public", &hcloud.ServerArgs{ServerType: pulumi.String("cx23")})
+		require.NoError(t, err)
+		publicNetwork, err := hcloud.NewServerNetwork(ctx, "public", &hcloud.ServerNetworkArgs{ServerId: pulumi.Int(1), NetworkId: pulumi.Int(1)})
+		require.NoError(t, err)
+
+		privateServer, err := hcloud.NewServer(ctx, "private", &hcloud.ServerArgs{
+			ServerType: pulumi.String("cx23"),
+			Networks: hcloud.ServerNetworkTypeArray{
+				&hcloud.ServerNetworkTypeArgs{NetworkId: pulumi.Int(1)},
+			},
+		})
+		require.NoError(t, err)
+
+		public := Node{Node: publicServer, Network: publicNetwork}
+		private := Node{Node: privateServer, Private: true}
+
+		pulumi.All(public.Address(), public.PrivateIP(), private.Address(), private.PrivateIP()).ApplyT(func(v []interface{}) error {
+			assert.Equal(t, "10.0.0.1", v[0])
+			assert.Equal(t, "10.128.0.2", v[1])
+			assert.Equal(t, "10.128.0.5", v[2])
+			assert.Equal(t, "10.128.0.5", v[3])
+			return nil
+		})
+		return nil
+	}, pulumi.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func Test_nodeIndices(t *testing.T) {
+	tests := []struct {
+		name         string
+		count        int
+		decommission []int
+		want         []int
+	}{
+		{
+			name:  "consecutive indices",
+			count: 3,
+			want:  []int{0, 1, 2},
+		},
+		{
+			name:         "node removed from the middle",
+			count:        4,
+			decommission: []int{3},
+			want:         []int{0, 1, 2, 4},
+		},
+		{
+			name:         "node removed without replacement",
+			count:        2,
+			decommission: []int{1},
+			want:         []int{0, 2},
+		},
+		{
+			name:         "decommissioned index beyond the pool",
+			count:        2,
+			decommission: []int{7},
+			want:         []int{0, 1},
+		},
+		{
+			name:         "empty pool",
+			count:        0,
+			decommission: []int{0},
+			want:         []int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nodeIndices(tt.count, tt.decommission))
+		})
+	}
+}
+
+func TestBootstrapManifests(t *testing.T) {
+	inlineManifest := config.ClusterInlineManifest{Name: "example", Contents: "kind: Namespace"}
+	tests := []struct {
+		name      string
+		cni       *config.CNIConfig
+		charts    []config.InlineChartConfig
+		wantNames []string
+	}{
+		{name: "no cni configuration", wantNames: []string{"example"}},
+		{name: "flannel", cni: &config.CNIConfig{Name: "flannel"}, wantNames: []string{"example"}},
+		{
+			name:      "inline charts after the inline manifests",
+			charts:    []config.InlineChartConfig{{Name: "chart", Chart: "../../k8s/helm/testdata/example", Namespace: "kube-system"}},
+			wantNames: []string{"example", "chart"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.PulumiConfig{Talos: config.TalosConfig{
+				KubernetesVersion: "1.34.0",
+				CNI:               tt.cni,
+				ExtraManifests:    []string{"https://example.com/manifest.yaml"},
+				InlineManifests:   []config.ClusterInlineManifest{inlineManifest},
+				InlineCharts:      tt.charts,
+			}}
+
+			inlineManifests, extraManifests, err := BootstrapManifests(cfg)
+			require.NoError(t, err)
+			names := []string{}
+			for _, manifest := range inlineManifests {
+				names = append(names, manifest.Name)
+			}
+			assert.Equal(t, tt.wantNames, names)
+			assert.Equal(t, inlineManifest, inlineManifests[0])
+			assert.Equal(t, cfg.Talos.ExtraManifests, extraManifests)
+		})
+	}
+}
+
+func Test_validateNodeConfigurations(t *testing.T) {
+	validator, err := core.NewMachineConfigurationValidator("v1.11.3", "1.34.0")
+	require.NoError(t, err)
+
+	valid := []string{"machine:\n  sysctls:\n    net.core.somaxconn: \"65535\"\n"}
+	invalid := []string{"machine:\n  kubelett:\n    extraArgs: {}\n"}
+
+	assert.NoError(t, validateNodeConfigurations(validator, meta.WorkerNode, valid, valid))
+	// the configuration applied to existing nodes is validated as well
+	assert.ErrorIs(t, validateNodeConfigurations(validator, meta.WorkerNode, valid, invalid), core.ErrInvalidMachineConfiguration)
+}
+
+// projectMocks is a Hetzner project with the servers and networks of its clusters.
+// The lookups filter them by their label selector, the inputs of the created resources are recorded by type and name.
+// Like in Hetzner, the IDs of the created resources are numbers.
+type projectMocks struct {
+	mocks
+	servers  []map[string]interface{}
+	networks []map[string]interface{}
+	mu       sync.Mutex
+	inputs   map[string]resource.PropertyMap
+}
+
+func (m *projectMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	m.mu.Lock()
+	m.inputs[args.TypeToken+"::"+args.Name] = args.Inputs
+	id := strconv.Itoa(100 + len(m.inputs))
+	m.mu.Unlock()
+
+	_, outputs, err := m.mocks.NewResource(args)
+	return id, outputs, err
+}
+
+func (m *projectMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	switch args.Token {
+	case "hcloud:index/getServers:getServers":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"servers": selectLabels(m.servers, args.Args["withSelector"].StringValue()),
+		}), nil
+	case "hcloud:index/getNetworks:getNetworks":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{
+			"networks": selectLabels(m.networks, args.Args["withSelector"].StringValue()),
+		}), nil
+	}
+	return m.mocks.Call(args)
+}
+
+// selectLabels returns the resources whose labels meet all requirements of the selector, like "key=value" and "!key"
+func selectLabels(resources []map[string]interface{}, selector string) []interface{} {
+	out := []interface{}{}
+	for _, res := range resources {
+		labels, _ := res["labels"].(map[string]interface{})
+		match := true
+		for _, requirement := range strings.Split(selector, ",") {
+			if key, absent := strings.CutPrefix(requirement, "!"); absent {
+				_, ok := labels[key]
+				match = match && !ok
+				continue
+			}
+			key, value, _ := strings.Cut(requirement, "=")
+			match = match && labels[key] == value
+		}
+		if match {
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
+
+func TestTwoClustersInOneStack(t *testing.T) { //nolint:funlen // test function
+	workerLabels := func(clusterName string) map[string]interface{} {
+		labels := map[string]interface{}{
+			"project":            "project",
+			"stack":              "stack",
+			"type":               "worker",
+			meta.NodePoolLabel:   "workers",
+			meta.GenerationLabel: "old",
+		}
+		if clusterName != "" {
+			labels[meta.ClusterLabel] = clusterName
+		}
+		return labels
+	}
+	project := &projectMocks{
+		servers: []map[string]interface{}{
+			{"id": 1, "name": "staging-workers-0", "labels": workerLabels("staging")},
+			{"id": 2, "name": "tooling-workers-0", "labels": workerLabels("tooling")},
+			// the auto-scaler only labels its servers with the node pool, they are told apart by their network
+			{"id": 3, "name": "workers-2f1a", "labels": map[string]interface{}{meta.NodePoolLabel: "workers"},
+				"networks": []interface{}{map[string]interface{}{"networkId": 10}}},
+			{"id": 4, "name": "workers-9c3e", "labels": map[string]interface{}{meta.NodePoolLabel: "workers"},
+				"networks": []interface{}{map[string]interface{}{"networkId": 20}}},
+		},
+		networks: []map[string]interface{}{
+			{"id": 10, "labels": map[string]interface{}{"project": "project", "stack": "stack", meta.ClusterLabel: "staging"}},
+			{"id": 20, "labels": map[string]interface{}{"project": "project", "stack": "stack", meta.ClusterLabel: "tooling"}},
+		},
+		inputs: map[string]resource.PropertyMap{},
+	}
+	clusters := map[string]struct {
+		serverID   int
+		autoScaler string
+	}{
+		"staging": {serverID: 1, autoScaler: "workers-2f1a"},
+		"tooling": {serverID: 2, autoScaler: "workers-9c3e"},
+	}
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		x86Snapshot, err := hcloudimages.NewUploadedImage(ctx, "x86-image", &hcloudimages.UploadedImageArgs{
+			HcloudToken:  pulumi.String("token"),
+			Architecture: pulumi.String("x86"),
+			ImageUrl:     pulumi.String("http://example.com/image.raw.xz"),
+			ServerType:   pulumi.String("cx23"),
+			Location:     pulumi.String("fsn1"),
+		})
+		if err != nil {
+			return err
+		}
+		images := &image.Images{X86: &image.Image{Snapshot: x86Snapshot}, TalosImageID: "v1.0.0"}
+
+		for clusterName, want := range clusters {
+			servers, err := findServers(ctx, clusterName, meta.WorkerNode)
+			require.NoError(t, err)
+			require.Len(t, servers, 1)
+			assert.Equal(t, want.serverID, servers["workers-0"].Id)
+
+			outdated, err := findOutdatedServers(ctx, clusterName, "workers", "new")
+			require.NoError(t, err)
+			require.Len(t, outdated, 1)
+			assert.Equal(t, want.serverID, outdated[0].Id)
+
+			pool := &NodePool{ClusterName: clusterName, NodePoolName: "workers", ServerNodeType: meta.WorkerNode}
+			require.NoError(t, pool.FindNodePoolAutoScalerNodes(ctx))
+			require.Len(t, pool.AutoScalerNodes, 1)
+			assert.Equal(t, want.autoScaler, pool.AutoScalerNodes[0].Name)
+
+			net, err := network.NewNetwork(ctx, clusterName+"-talos-network", &network.NetworkArgs{
+				ClusterName: clusterName,
+				NetworkZone: "eu-central",
+				CIDR:        "10.0.0.0/8",
+				Subnet:      "10.128.1.0/24",
+			})
+			if err != nil {
+				return err
+			}
+			firewall, err := hcloud.NewFirewall(ctx, clusterName+"-fw-worker", &hcloud.FirewallArgs{})
+			if err != nil {
+				return err
+			}
+			mcm, err := core.NewMachineConfigurationManager(ctx, clusterName, &core.MachineConfigurationManagerArgs{
+				SingleControlPlaneNodeIP: pulumi.String("1.2.3.4"),
+				TalosVersion:             "v1.0.0",
+				KubernetesVersion:        "v1.24.0",
+			})
+			if err != nil {
+				return err
+			}
+			poolName := "workers"
+			_, err = NewNodePool(ctx, poolName, &NodePoolArgs{
+				ClusterName:                 clusterName,
+				Count:                       1,
+				ServerSize:                  "cx23",
+				Images:                      images,
+				Arch:                        image.ArchX86,
+				Region:                      "fsn1",
+				NodePoolName:                &poolName,
+				ServerNodeType:              meta.WorkerNode,
+				MachineConfigurationManager: mcm,
+				Network:                     net,
+				Firewall:                    firewall,
+			})
+			if err != nil {
+				return err
+			}
+
+			cpLb, err := lb.NewControlplane(ctx, clusterName+"-controlplane-lb", &lb.ControlplaneArgs{
+				ClusterName:      clusterName,
+				LoadBalancerType: "lb11",
+				Network:          net,
+			})
+			if err != nil {
+				return err
+			}
+			if err := cpLb.NewTarget(ctx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, pulumi.WithMocks("project", "stack", project))
+	require.NoError(t, err)
+
+	for clusterName := range clusters {
+		server := project.inputs["hcloud:index/server:Server::"+clusterName+"-workers-0"]
+		require.NotNil(t, server)
+		assert.Equal(t, clusterName+"-workers-0", server["name"].StringValue())
+		assert.Equal(t, clusterName, server["labels"].ObjectValue()[meta.ClusterLabel].StringValue())
+
+		loadBalancer := project.inputs["hcloud:index/loadBalancer:LoadBalancer::"+clusterName+"-controlplane-lb-controlplane"]
+		require.NotNil(t, loadBalancer)
+		assert.Equal(t, clusterName, loadBalancer["labels"].ObjectValue()[meta.ClusterLabel].StringValue())
+
+		target := project.inputs["hcloud:index/loadBalancerTarget:LoadBalancerTarget::"+clusterName+"-controlplane-lb-controlplane"]
+		require.NotNil(t, target)
+		assert.Equal(t, "type=controlplane,cluster="+clusterName+",project=project,stack=stack", target["labelSelector"].StringValue())
+	}
+}
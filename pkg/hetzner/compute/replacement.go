@@ -0,0 +1,216 @@
+package compute
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/cli"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ErrReplacementRequiresDrain indicates that a pool with rolling replacement is deployed without draining removed nodes
+var ErrReplacementRequiresDrain = errors.New("rolling replacement requires draining removed nodes, skip_drain must not be set")
+
+// generationLength is the number of hex characters of a node generation
+const generationLength = 6
+
+// ReplacementStrategy replaces the nodes of a pool with new servers when their specification changes,
+// instead of changing the servers in place. The generation of the specification is part of the server names.
+type ReplacementStrategy struct {
+	// MaxSurge is the number of new nodes which are created before outdated nodes are retired
+	MaxSurge int
+	// MaxUnavailable is the number of outdated nodes which are retired before their replacements are ready
+	MaxUnavailable int
+	// Hooks wait for the new nodes and retire the outdated nodes.
+	// Without hooks, all new nodes are created at once and the outdated servers are only deleted.
+	Hooks *cli.TalosHooks
+	// OutdatedServers are the servers of the pool with another generation, see findOutdatedServers
+	OutdatedServers []hcloud.GetServersServer
+}
+
+// newReplacementStrategy returns the replacement strategy of the worker pool with the outdated servers of the pool
+func newReplacementStrategy(ctx *pulumi.Context, clusterName string, cfg *config.PulumiConfig, pool *config.NodePoolConfig, images *image.Images, creation *CreationTracking, hooks *cli.TalosHooks, hetznerProvider *hcloud.Provider) (*ReplacementStrategy, error) {
+	if cfg.Talos.Decommission.SkipDrain {
+		return nil, fmt.Errorf("node pool %s: %w", pool.Name, ErrReplacementRequiresDrain)
+	}
+
+	strategy := &ReplacementStrategy{
+		MaxSurge:       1,
+		MaxUnavailable: pool.Replacement.MaxUnavailable,
+		Hooks:          hooks,
+	}
+	if pool.Replacement.MaxSurge != nil {
+		strategy.MaxSurge = *pool.Replacement.MaxSurge
+	}
+
+	outdated, err := findOutdatedServers(ctx, clusterName, pool.Name, nodeGeneration(pool.ServerSize, pool.Region, pool.Arch, images, creation.generationHash()), pulumi.Provider(hetznerProvider))
+	if err != nil {
+		return nil, err
+	}
+	strategy.OutdatedServers = outdated
+
+	return strategy, nil
+}
+
+// stepSize returns the number of nodes which are replaced in one step,
+// and how many outdated nodes of a step are retired before the new nodes of the step are ready.
+// Without surge and unavailability, one node is surged.
+func (s *ReplacementStrategy) stepSize() (size, unavailable int) {
+	if s.MaxSurge+s.MaxUnavailable <= 0 {
+		return 1, 0
+	}
+
+	return s.MaxSurge + s.MaxUnavailable, s.MaxUnavailable
+}
+
+// nodeGeneration returns a short hash of the specification of the servers of a pool.
+// Servers of another generation are replaced. The creation hash is only set with the creation-only change policy replace.
+func nodeGeneration(serverSize, region string, arch image.CPUArchitecture, images *image.Images, creationHash string) string {
+	fields := []string{serverSize, region, string(arch), images.TalosImageID, images.TalosVersion}
+	if creationHash != "" {
+		fields = append(fields, creationHash)
+	}
+	spec := strings.Join(fields, "/")
+	sum := sha256.Sum256([]byte(spec))
+
+	return hex.EncodeToString(sum[:])[:generationLength]
+}
+
+// findOutdatedServers returns the servers of the pool which were created by the cluster with another generation.
+// The servers created before the pool used rolling replacement have no generation at all.
+func findOutdatedServers(ctx *pulumi.Context, clusterName, nodePoolName, generation string, opts ...pulumi.InvokeOption) ([]hcloud.GetServersServer, error) {
+	servers, err := findClusterServers(ctx, clusterName, []string{fmt.Sprintf("%s=%s", meta.NodePoolLabel, nodePoolName)}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return outdatedServers(servers, generation), nil
+}
+
+// outdatedServers filters the servers of another generation, sorted by name
+func outdatedServers(servers []hcloud.GetServersServer, generation string) []hcloud.GetServersServer {
+	outdated := []hcloud.GetServersServer{}
+	for _, server := range servers {
+		if server.Labels[meta.GenerationLabel] != generation {
+			outdated = append(outdated, server)
+		}
+	}
+
+	sort.Slice(outdated, func(i, j int) bool {
+		return outdated[i].Name < outdated[j].Name
+	})
+
+	return outdated
+}
+
+// newNodeFunc creates the node with the index, after the given resources
+type newNodeFunc func(index int, dependsOn []pulumi.Resource) (Node, error)
+
+// replaceNodes creates the nodes with the given indices step by step and retires the outdated servers of the pool.
+// A step creates MaxSurge+MaxUnavailable new nodes, MaxUnavailable outdated nodes are retired first,
+// the other outdated nodes of the step once the new nodes of the step are ready. A step starts when the previous step is done.
+// New nodes beyond the number of outdated servers do not replace a node and are created at once.
+// The retired servers are deleted by Pulumi at the end of the update.
+func (s *ReplacementStrategy) replaceNodes(ctx *pulumi.Context, clusterName, name string, indices []int, generation string, newNode newNodeFunc, parent pulumi.Resource) ([]Node, error) {
+	size, unavailable := s.stepSize()
+	nodes := make([]Node, 0, len(indices))
+	previousStep := []pulumi.Resource{}
+
+	for step, outdated := range batches(s.OutdatedServers, size) {
+		retireFirst := min(unavailable, len(outdated))
+
+		retired, err := s.retireNodes(ctx, clusterName, outdated[:retireFirst], previousStep, parent)
+		if err != nil {
+			return nil, err
+		}
+
+		currentStep := append([]pulumi.Resource{}, retired...)
+		nodesDependOn := append(append([]pulumi.Resource{}, previousStep...), retired...)
+
+		for _, index := range stepIndices(indices, step, size) {
+			node, err := newNode(index, nodesDependOn)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+
+			readyDependsOn := []pulumi.Resource{}
+			if node.Network != nil {
+				readyDependsOn = append(readyDependsOn, node.Network)
+			}
+
+			ready, err := cli.NewWaitForNode(ctx, fmt.Sprintf("%s-%s", clusterName, serverName(name, index, generation)), &cli.WaitForNodeArgs{
+				Hooks:           s.Hooks,
+				NodeIpv4Address: node.Address(),
+				NodeInternalIP:  node.PrivateIP(),
+			}, pulumi.Parent(node.Node), pulumi.DependsOn(readyDependsOn))
+			if err != nil {
+				return nil, err
+			}
+			currentStep = append(currentStep, ready)
+		}
+
+		retired, err = s.retireNodes(ctx, clusterName, outdated[retireFirst:], currentStep, parent)
+		if err != nil {
+			return nil, err
+		}
+
+		previousStep = append(currentStep, retired...)
+	}
+
+	for _, index := range indices[min(len(nodes), len(indices)):] {
+		node, err := newNode(index, nil)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// retireNodes decommissions the outdated servers after the given resources
+func (s *ReplacementStrategy) retireNodes(ctx *pulumi.Context, clusterName string, servers []hcloud.GetServersServer, dependsOn []pulumi.Resource, parent pulumi.Resource) ([]pulumi.Resource, error) {
+	retired := []pulumi.Resource{}
+	for _, server := range servers {
+		args := &cli.RetireNodeArgs{
+			Hooks:           s.Hooks,
+			NodeIpv4Address: server.Ipv4Address,
+			NodeName:        server.Name,
+		}
+		if len(server.Networks) > 0 {
+			args.NodeInternalIP = server.Networks[0].Ip
+			// servers without public IPv4 are reached through the private network
+			if args.NodeIpv4Address == "" {
+				args.NodeIpv4Address = server.Networks[0].Ip
+			}
+		}
+
+		retire, err := cli.NewRetireNode(ctx, fmt.Sprintf("%s-%s", clusterName, nodeNameOfServer(clusterName, server.Name)), args,
+			pulumi.Parent(parent),
+			pulumi.DependsOn(dependsOn),
+		)
+		if err != nil {
+			return nil, err
+		}
+		retired = append(retired, retire)
+	}
+
+	return retired, nil
+}
+
+// stepIndices returns the indices of the new nodes of a replacement step
+func stepIndices(indices []int, step, size int) []int {
+	start := min(step*size, len(indices))
+	end := min(start+size, len(indices))
+
+	return indices[start:end]
+}
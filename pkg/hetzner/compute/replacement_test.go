@@ -0,0 +1,162 @@
+package compute
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/cli"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplacementStrategy_stepSize(t *testing.T) {
+	tests := []struct {
+		name            string
+		strategy        ReplacementStrategy
+		wantSize        int
+		wantUnavailable int
+	}{
+		{
+			name:     "surge one",
+			strategy: ReplacementStrategy{MaxSurge: 1},
+			wantSize: 1,
+		},
+		{
+			name:            "surge and unavailable",
+			strategy:        ReplacementStrategy{MaxSurge: 2, MaxUnavailable: 1},
+			wantSize:        3,
+			wantUnavailable: 1,
+		},
+		{
+			name:            "unavailable only",
+			strategy:        ReplacementStrategy{MaxUnavailable: 2},
+			wantSize:        2,
+			wantUnavailable: 2,
+		},
+		{
+			name:     "neither surge nor unavailable surges one",
+			strategy: ReplacementStrategy{},
+			wantSize: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, unavailable := tt.strategy.stepSize()
+			assert.Equal(t, tt.wantSize, size)
+			assert.Equal(t, tt.wantUnavailable, unavailable)
+		})
+	}
+}
+
+func Test_nodeGeneration(t *testing.T) {
+	images := &image.Images{TalosImageID: "abc", TalosVersion: "v1.11.3"}
+	generation := nodeGeneration("cx23", "fsn1", image.ArchX86, images, "")
+
+	assert.Len(t, generation, generationLength)
+	// the generation without creation hash is the one of pools created before the hash existed
+	assert.Equal(t, "f8db46", generation)
+	assert.Equal(t, generation, nodeGeneration("cx23", "fsn1", image.ArchX86, images, ""))
+	assert.NotEqual(t, generation, nodeGeneration("cx33", "fsn1", image.ArchX86, images, ""))
+	assert.NotEqual(t, generation, nodeGeneration("cx23", "nbg1", image.ArchX86, images, ""))
+	assert.NotEqual(t, generation, nodeGeneration("cx23", "fsn1", image.ArchX86, &image.Images{TalosImageID: "abc", TalosVersion: "v1.12.0"}, ""))
+	assert.NotEqual(t, generation, nodeGeneration("cx23", "fsn1", image.ArchX86, images, "0123456789ab"))
+}
+
+func Test_outdatedServers(t *testing.T) {
+	servers := []hcloud.GetServersServer{
+		{Name: "workers-1-aaaaaa", Labels: map[string]string{meta.GenerationLabel: "aaaaaa"}},
+		{Name: "workers-0-bbbbbb", Labels: map[string]string{meta.GenerationLabel: "bbbbbb"}},
+		{Name: "workers-0", Labels: map[string]string{}},
+		{Name: "workers-1-bbbbbb", Labels: map[string]string{meta.GenerationLabel: "bbbbbb"}},
+	}
+
+	outdated := outdatedServers(servers, "bbbbbb")
+
+	names := []string{}
+	for _, server := range outdated {
+		names = append(names, server.Name)
+	}
+	assert.Equal(t, []string{"workers-0", "workers-1-aaaaaa"}, names)
+}
+
+// dependencyMocks records the names of the dependencies of all registered resources
+type dependencyMocks struct {
+	mocks
+	mu           sync.Mutex
+	dependencies map[string][]string
+}
+
+func (m *dependencyMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	names := []string{}
+	if args.RegisterRPC != nil {
+		for _, urn := range args.RegisterRPC.GetDependencies() {
+			names = append(names, urn[strings.LastIndex(urn, "::")+2:])
+		}
+	}
+	sort.Strings(names)
+
+	m.mu.Lock()
+	m.dependencies[args.Name] = names
+	m.mu.Unlock()
+	return m.mocks.NewResource(args)
+}
+
+func TestReplacementStrategy_replaceNodes(t *testing.T) {
+	recorder := &dependencyMocks{dependencies: map[string][]string{}}
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		newNode := func(index int, dependsOn []pulumi.Resource) (Node, error) {
+			name := fmt.Sprintf("c-workers-%d-new", index)
+			server, err := hcloud.NewServer(ctx, name, &hcloud.ServerArgs{
+				ServerType: pulumi.String("cx23"),
+			}, pulumi.DependsOn(dependsOn))
+			if err != nil {
+				return Node{}, err
+			}
+			network, err := hcloud.NewServerNetwork(ctx, name+"-network", &hcloud.ServerNetworkArgs{
+				ServerId: pulumi.Int(index),
+			}, pulumi.Parent(server))
+			if err != nil {
+				return Node{}, err
+			}
+			return Node{Index: index, Generation: "new", Node: server, Network: network}, nil
+		}
+
+		strategy := &ReplacementStrategy{
+			MaxSurge:       1,
+			MaxUnavailable: 1,
+			Hooks:          &cli.TalosHooks{},
+			OutdatedServers: []hcloud.GetServersServer{
+				{Name: "workers-0", Ipv4Address: "1.2.3.4"},
+				{Name: "workers-1", Ipv4Address: "1.2.3.5"},
+				{Name: "workers-2", Ipv4Address: "1.2.3.6"},
+			},
+		}
+
+		nodes, err := strategy.replaceNodes(ctx, "c", "workers", []int{0, 1, 2, 3}, "new", newNode, nil)
+		require.NoError(t, err)
+		assert.Len(t, nodes, 4)
+		return nil
+	}, pulumi.WithMocks("project", "stack", recorder))
+	require.NoError(t, err)
+
+	deps := recorder.dependencies
+	// step 1: workers-0 is retired first, workers-1 once the new nodes 0 and 1 are ready
+	assert.Empty(t, deps["retire-talos-c-workers-0"])
+	assert.Equal(t, []string{"retire-talos-c-workers-0"}, deps["c-workers-0-new"])
+	assert.Equal(t, []string{"retire-talos-c-workers-0"}, deps["c-workers-1-new"])
+	assert.Equal(t, []string{"ready-talos-c-workers-0-new", "ready-talos-c-workers-1-new", "retire-talos-c-workers-0"}, deps["retire-talos-c-workers-1"])
+	// step 2 starts when step 1 is done
+	step1 := []string{"ready-talos-c-workers-0-new", "ready-talos-c-workers-1-new", "retire-talos-c-workers-0", "retire-talos-c-workers-1"}
+	assert.Equal(t, step1, deps["retire-talos-c-workers-2"])
+	assert.Equal(t, append(append([]string{}, step1...), "retire-talos-c-workers-2"), deps["c-workers-2-new"])
+	assert.Equal(t, deps["c-workers-2-new"], deps["c-workers-3-new"])
+}
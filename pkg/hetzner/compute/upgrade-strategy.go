@@ -0,0 +1,57 @@
+package compute
+
+import (
+	"sort"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+)
+
+// UpgradeStrategy controls how Talos upgrades roll through the nodes of a node pool
+type UpgradeStrategy struct {
+	// BatchSize is the number of nodes which are upgraded at the same time
+	BatchSize int
+	// MaxUnavailable caps the number of nodes which are unavailable at the same time, nil means no cap
+	MaxUnavailable *int
+	// Order sorts the pools for upgrades, lower orders are upgraded first
+	Order int
+}
+
+// batchSize returns the number of nodes of a pool with the given size which are upgraded at the same time.
+// Control plane nodes are always upgraded one by one to keep the etcd quorum,
+// other pools keep at least one node available.
+func (s UpgradeStrategy) batchSize(serverNodeType meta.ServerNodeType, nodes int) int {
+	if serverNodeType == meta.ControlPlaneNode {
+		return 1
+	}
+
+	size := s.BatchSize
+	if s.MaxUnavailable != nil && *s.MaxUnavailable < size {
+		size = *s.MaxUnavailable
+	}
+	size = min(size, nodes-1)
+
+	return max(size, 1)
+}
+
+// batches splits the items into consecutive batches of the given size
+func batches[T any](items []T, size int) [][]T {
+	out := [][]T{}
+	for start := 0; start < len(items); start += size {
+		end := min(start+size, len(items))
+		out = append(out, items[start:end])
+	}
+
+	return out
+}
+
+// upgradeGroups sorts the pools by their upgrade order and groups them into groups of pools
+// which are upgraded at the same time. Pools with the same order keep their configured order.
+func upgradeGroups(pools []*NodePool, parallelism int) [][]*NodePool {
+	sorted := make([]*NodePool, len(pools))
+	copy(sorted, pools)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].UpgradeStrategy.Order < sorted[j].UpgradeStrategy.Order
+	})
+
+	return batches(sorted, max(parallelism, 1))
+}
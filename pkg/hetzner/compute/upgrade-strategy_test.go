@@ -0,0 +1,119 @@
+package compute
+
+import (
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradeStrategy_batchSize(t *testing.T) {
+	two := 2
+
+	tests := []struct {
+		name           string
+		strategy       UpgradeStrategy
+		serverNodeType meta.ServerNodeType
+		nodes          int
+		want           int
+	}{
+		{
+			name:           "one by one",
+			strategy:       UpgradeStrategy{BatchSize: 1},
+			serverNodeType: meta.WorkerNode,
+			nodes:          10,
+			want:           1,
+		},
+		{
+			name:           "batch size",
+			strategy:       UpgradeStrategy{BatchSize: 4},
+			serverNodeType: meta.WorkerNode,
+			nodes:          10,
+			want:           4,
+		},
+		{
+			name:           "max unavailable caps the batch size",
+			strategy:       UpgradeStrategy{BatchSize: 4, MaxUnavailable: &two},
+			serverNodeType: meta.WorkerNode,
+			nodes:          10,
+			want:           2,
+		},
+		{
+			name:           "keeps one node available",
+			strategy:       UpgradeStrategy{BatchSize: 10},
+			serverNodeType: meta.WorkerNode,
+			nodes:          3,
+			want:           2,
+		},
+		{
+			name:           "single node",
+			strategy:       UpgradeStrategy{BatchSize: 10},
+			serverNodeType: meta.WorkerNode,
+			nodes:          1,
+			want:           1,
+		},
+		{
+			name:           "unset batch size",
+			strategy:       UpgradeStrategy{},
+			serverNodeType: meta.WorkerNode,
+			nodes:          3,
+			want:           1,
+		},
+		{
+			name:           "control plane is always one by one",
+			strategy:       UpgradeStrategy{BatchSize: 3, MaxUnavailable: &two},
+			serverNodeType: meta.ControlPlaneNode,
+			nodes:          5,
+			want:           1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.strategy.batchSize(tt.serverNodeType, tt.nodes))
+		})
+	}
+}
+
+func Test_batches(t *testing.T) {
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, batches([]int{1, 2, 3, 4, 5}, 2))
+	assert.Equal(t, [][]int{{1}, {2}}, batches([]int{1, 2}, 1))
+	assert.Empty(t, batches([]int{}, 3))
+}
+
+func Test_upgradeGroups(t *testing.T) {
+	a := &NodePool{NodePoolName: "a", UpgradeStrategy: UpgradeStrategy{Order: 1}}
+	b := &NodePool{NodePoolName: "b"}
+	c := &NodePool{NodePoolName: "c", UpgradeStrategy: UpgradeStrategy{Order: 1}}
+	d := &NodePool{NodePoolName: "d", UpgradeStrategy: UpgradeStrategy{Order: -1}}
+	pools := []*NodePool{a, b, c, d}
+
+	tests := []struct {
+		name        string
+		parallelism int
+		want        [][]*NodePool
+	}{
+		{
+			name:        "one pool after the other",
+			parallelism: 1,
+			want:        [][]*NodePool{{d}, {b}, {a}, {c}},
+		},
+		{
+			name:        "two pools at the same time",
+			parallelism: 2,
+			want:        [][]*NodePool{{d, b}, {a, c}},
+		},
+		{
+			name:        "all pools at the same time",
+			parallelism: 10,
+			want:        [][]*NodePool{{d, b, a, c}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, upgradeGroups(pools, tt.parallelism))
+		})
+	}
+
+	// the configured order is kept
+	assert.Equal(t, []*NodePool{a, b, c, d}, pools)
+}
@@ -0,0 +1,37 @@
+package lb
+
+import (
+	"fmt"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ControlplaneFloatingIPArgs are the arguments for the NewControlplaneFloatingIP function
+type ControlplaneFloatingIPArgs struct {
+	// HomeLocation is the location the floating IP is routed from, e.g. the region of the first control plane pool
+	HomeLocation string
+	// Protect the resource from accidental deletion
+	Protect bool
+}
+
+// NewControlplaneFloatingIP creates the floating IP of the Kubernetes API, a cheap alternative to the control plane load balancer.
+//
+// The floating IP is not assigned by Pulumi. The control planes share it as Talos VIP, the elected control plane
+// assigns it to its server through the Hetzner API and another control plane takes it over when the node fails.
+func NewControlplaneFloatingIP(ctx *pulumi.Context, name string, args *ControlplaneFloatingIPArgs, opts ...pulumi.ResourceOption) (*hcloud.FloatingIp, error) {
+	resourceName := fmt.Sprintf("%s-controlplane", name)
+
+	return hcloud.NewFloatingIp(ctx, resourceName, &hcloud.FloatingIpArgs{
+		Name:         pulumi.String(resourceName),
+		Type:         pulumi.String("ipv4"),
+		HomeLocation: pulumi.String(args.HomeLocation),
+		Description:  pulumi.String("Kubernetes API of the control planes"),
+		Labels:       meta.NewLabels(ctx, &meta.ServerLabelsArgs{ServerNodeType: meta.ControlPlaneNode}),
+	}, append(opts,
+		pulumi.Protect(args.Protect),
+		// the Talos VIP moves the floating IP between the control planes
+		pulumi.IgnoreChanges([]string{"serverId"}),
+	)...)
+}
@@ -14,10 +14,14 @@ import (
 const (
 	// ControlPlaneLoadBalancerPort is the port the control plane load balancer listens on
 	ControlPlaneLoadBalancerPort = 6443
+	// TalosAPIPort is the port of the Talos API, the load balancer forwards it to the control planes
+	TalosAPIPort = 50000
 )
 
 // ControlplaneArgs are the arguments for the NewControlplane function
 type ControlplaneArgs struct {
+	// ClusterName is the name of the cluster, the load balancer only targets the control plane nodes of the cluster
+	ClusterName string
 	// DisableLoadBalancer disables the creation of the load balancer
 	DisableLoadBalancer bool
 	// LoadBalancerType is the type of load balancer to create
@@ -40,10 +44,15 @@ type Controlplane struct {
 	LoadBalancer *hcloud.LoadBalancer
 	// Service is the Hetzner Cloud load balancer service
 	Service *hcloud.LoadBalancerService
-	// Target is the Hetzner Cloud load balancer target
+	// TalosService forwards the Talos API to the control planes, see NewTalosService
+	TalosService *hcloud.LoadBalancerService
+	// Target is the Hetzner Cloud load balancer target, see NewTarget
 	Target *hcloud.LoadBalancerTarget
 	// LoadBalancerNetwork is the Hetzner Cloud load balancer network
 	LoadBalancerNetwork *hcloud.LoadBalancerNetwork
+
+	resourceName string
+	clusterName  string
 }
 
 // NewControlplane creates a new control plane load balancer
@@ -58,7 +67,7 @@ func NewControlplane(ctx *pulumi.Context, name string, args *ControlplaneArgs, o
 	lbArgs := &hcloud.LoadBalancerArgs{
 		Name:             pulumi.String(resourceName),
 		LoadBalancerType: pulumi.String(args.LoadBalancerType),
-		Labels:           meta.NewLabels(ctx, &meta.ServerLabelsArgs{ServerNodeType: meta.ControlPlaneNode}),
+		Labels:           meta.NewLabels(ctx, &meta.ServerLabelsArgs{ClusterName: args.ClusterName, ServerNodeType: meta.ControlPlaneNode}),
 	}
 	if args.Location != nil {
 		lbArgs.Location = pulumi.StringPtrFromPtr(args.Location)
@@ -98,23 +107,52 @@ func NewControlplane(ctx *pulumi.Context, name string, args *ControlplaneArgs, o
 		return nil, err
 	}
 
-	target, err := hcloud.NewLoadBalancerTarget(ctx, resourceName, &hcloud.LoadBalancerTargetArgs{
+	return &Controlplane{
+		LoadBalancer:        loadBalancer,
+		Service:             service,
+		LoadBalancerNetwork: loadBalancerNetwork,
+		resourceName:        resourceName,
+		clusterName:         args.ClusterName,
+	}, nil
+}
+
+// NewTarget creates the target of the load balancer, the control plane nodes of the cluster selected by their labels.
+// It should depend on the control plane servers, so that servers created before the cluster label existed
+// carry the label before the selector requires it.
+func (c *Controlplane) NewTarget(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	target, err := hcloud.NewLoadBalancerTarget(ctx, c.resourceName, &hcloud.LoadBalancerTargetArgs{
 		Type:           pulumi.String("label_selector"),
-		LoadBalancerId: loadBalancer.ID().ApplyT(strconv.Atoi).(pulumi.IntOutput),
-		LabelSelector:  pulumi.Sprintf("type=controlplane,stack=%s,project=%s", ctx.Stack(), ctx.Project()),
+		LoadBalancerId: c.LoadBalancer.ID().ApplyT(strconv.Atoi).(pulumi.IntOutput),
+		LabelSelector:  pulumi.String(meta.ClusterSelector(ctx, c.clusterName, "type=controlplane")),
 		UsePrivateIp:   pulumi.Bool(true),
 	}, append(opts,
-		pulumi.Parent(loadBalancer),
-		pulumi.DependsOn([]pulumi.Resource{service, loadBalancerNetwork}),
+		pulumi.Parent(c.LoadBalancer),
+		pulumi.DependsOn([]pulumi.Resource{c.Service, c.LoadBalancerNetwork}),
 	)...)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	c.Target = target
 
-	return &Controlplane{
-		LoadBalancer:        loadBalancer,
-		Service:             service,
-		Target:              target,
-		LoadBalancerNetwork: loadBalancerNetwork,
-	}, nil
+	return nil
+}
+
+// NewTalosService creates the service which forwards the Talos API to the control planes, see core.MachineConfigurationManager.TalosEndpoint.
+// It is protected by the client certificates of the Talos API, the firewall rules of the Talos API do not apply to it.
+func (c *Controlplane) NewTalosService(ctx *pulumi.Context, opts ...pulumi.ResourceOption) error {
+	service, err := hcloud.NewLoadBalancerService(ctx, fmt.Sprintf("%s-talos", c.resourceName), &hcloud.LoadBalancerServiceArgs{
+		LoadBalancerId:  c.LoadBalancer.ID(),
+		Protocol:        pulumi.String("tcp"),
+		ListenPort:      pulumi.Int(TalosAPIPort),
+		DestinationPort: pulumi.Int(TalosAPIPort),
+	}, append(opts,
+		pulumi.Parent(c.LoadBalancer),
+		pulumi.DependsOn([]pulumi.Resource{c.LoadBalancer}),
+	)...)
+	if err != nil {
+		return err
+	}
+	c.TalosService = service
+
+	return nil
 }
@@ -1,6 +1,9 @@
 package meta
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
@@ -17,10 +20,18 @@ const (
 	NoneNode ServerNodeType = ""
 	// NodePoolLabel is the label used to identify the node pool
 	NodePoolLabel = "hcloud/node-group"
+	// GenerationLabel is the label used to identify the server specification of a node, see ServerLabelsArgs.Generation
+	GenerationLabel = "hcloud-k8s/generation"
+	// CreationHashLabel is the label used to identify the creation-only configuration a server was created with
+	CreationHashLabel = "hcloud-k8s/creation"
+	// ClusterLabel is the label used to identify the cluster of a resource, a stack can deploy several clusters
+	ClusterLabel = "cluster"
 )
 
 // LabelsArgs are the arguments for the Labels function
 type ServerLabelsArgs struct {
+	// ClusterName is the name of the cluster the resource belongs to
+	ClusterName string
 	// ServerNodeType is the type of the server node
 	ServerNodeType ServerNodeType
 	// Region is the region of the server
@@ -29,6 +40,10 @@ type ServerLabelsArgs struct {
 	Arch *image.CPUArchitecture
 	// NodePoolName is the name of the node pool
 	NodePoolName *string
+	// Generation identifies the server specification of nodes which are replaced instead of changed in place
+	Generation *string
+	// CreationHash identifies the creation-only configuration of the server
+	CreationHash *string
 }
 
 // NewLabels generates the labels for a hetzner resource like Server and LoadBalancer
@@ -38,6 +53,10 @@ func NewLabels(ctx *pulumi.Context, args *ServerLabelsArgs) pulumi.StringMap {
 		"project": pulumi.String(ctx.Project()),
 	}
 
+	if args.ClusterName != "" {
+		labels[ClusterLabel] = pulumi.String(args.ClusterName)
+	}
+
 	if args.ServerNodeType != "" {
 		labels["type"] = pulumi.String(string(args.ServerNodeType))
 	}
@@ -51,6 +70,33 @@ func NewLabels(ctx *pulumi.Context, args *ServerLabelsArgs) pulumi.StringMap {
 	if args.Arch != nil {
 		labels["arch"] = pulumi.String(*args.Arch)
 	}
+	if args.Generation != nil {
+		labels[GenerationLabel] = pulumi.String(*args.Generation)
+	}
+	if args.CreationHash != nil {
+		labels[CreationHashLabel] = pulumi.String(*args.CreationHash)
+	}
 
 	return labels
 }
+
+// ClusterSelector returns the label selector of the resources of the cluster in the stack.
+// The requirements, e.g. "type=worker", are added to the selector.
+func ClusterSelector(ctx *pulumi.Context, clusterName string, requirements ...string) string {
+	return selector(ctx, fmt.Sprintf("%s=%s", ClusterLabel, clusterName), requirements)
+}
+
+// LegacyClusterSelector returns the label selector of the resources of the stack which were created before
+// they were labeled with their cluster. They get the label with their next update.
+// The requirements, e.g. "type=worker", are added to the selector.
+func LegacyClusterSelector(ctx *pulumi.Context, requirements ...string) string {
+	return selector(ctx, "!"+ClusterLabel, requirements)
+}
+
+// selector joins the cluster requirement, the requirements and the project and stack of the context
+func selector(ctx *pulumi.Context, cluster string, requirements []string) string {
+	all := append([]string{}, requirements...)
+	all = append(all, cluster, fmt.Sprintf("project=%s", ctx.Project()), fmt.Sprintf("stack=%s", ctx.Stack()))
+
+	return strings.Join(all, ",")
+}
@@ -85,6 +85,23 @@ func TestNewLabels(t *testing.T) {
 				NodePoolLabel: pulumi.String("npool"),
 			},
 		},
+		{
+			name: "cluster",
+			args: args{
+				project: "p",
+				stack:   "s",
+				args: &ServerLabelsArgs{
+					ClusterName:    "p-s",
+					ServerNodeType: ControlPlaneNode,
+				},
+			},
+			want: pulumi.StringMap{
+				"project":    pulumi.String("p"),
+				"stack":      pulumi.String("s"),
+				"type":       pulumi.String("controlplane"),
+				ClusterLabel: pulumi.String("p-s"),
+			},
+		},
 		{
 			name: "region and arch only",
 			args: args{
@@ -116,6 +133,16 @@ func TestNewLabels(t *testing.T) {
 	}
 }
 
+func TestClusterSelector(t *testing.T) {
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		assert.Equal(t, "type=worker,cluster=a,project=p,stack=s", ClusterSelector(ctx, "a", "type=worker"))
+		assert.Equal(t, "cluster=b,project=p,stack=s", ClusterSelector(ctx, "b"))
+		assert.Equal(t, "type=worker,!cluster,project=p,stack=s", LegacyClusterSelector(ctx, "type=worker"))
+		return nil
+	}, pulumi.WithMocks("p", "s", mocks(0)))
+	assert.NoError(t, err)
+}
+
 // helper functions for test args
 func ptrString(s string) *string { return &s }
 func ptrArch(a string) *image.CPUArchitecture {
@@ -0,0 +1,26 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// LegacyName aliases a resource to the name it had before resource names were prefixed with the cluster name,
+// so existing stacks keep the resource instead of replacing it.
+func LegacyName(name string) pulumi.ResourceOption {
+	return pulumi.Aliases([]pulumi.Alias{{Name: pulumi.String(name)}})
+}
+
+// LegacyURN returns the URN a resource had before the cluster became a component resource.
+// The types are the types of its former parents, outermost first, followed by its own type.
+func LegacyURN(ctx *pulumi.Context, name string, types ...string) pulumi.URN {
+	return pulumi.URN(fmt.Sprintf("urn:pulumi:%s::%s::%s::%s", ctx.Stack(), ctx.Project(), strings.Join(types, "$"), name))
+}
+
+// LegacyAlias aliases a resource which moved into the cluster component to its former URN, see LegacyURN.
+// Children keep their parent and inherit the alias, so only the moved resource itself needs it.
+func LegacyAlias(ctx *pulumi.Context, name string, types ...string) pulumi.ResourceOption {
+	return pulumi.Aliases([]pulumi.Alias{{URN: LegacyURN(ctx, name, types...)}})
+}
@@ -0,0 +1,40 @@
+package meta
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+func TestLegacyURN(t *testing.T) {
+	tests := []struct {
+		name         string
+		resourceName string
+		types        []string
+		want         pulumi.URN
+	}{
+		{
+			name:         "top level resource",
+			resourceName: "fw-worker",
+			types:        []string{"hcloud:index/firewall:Firewall"},
+			want:         "urn:pulumi:stack::project::hcloud:index/firewall:Firewall::fw-worker",
+		},
+		{
+			name:         "resource with parents",
+			resourceName: "talos-network",
+			types:        []string{"pulumi:providers:hcloud", "hcloud:index/network:Network"},
+			want:         "urn:pulumi:stack::project::pulumi:providers:hcloud$hcloud:index/network:Network::talos-network",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+				assert.Equal(t, tt.want, LegacyURN(ctx, tt.resourceName, tt.types...))
+				return nil
+			}, pulumi.WithMocks("project", "stack", mocks(0)))
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// ErrInvalidCIDR is returned when the IP range of the network is not an IPv4 CIDR
+var ErrInvalidCIDR = errors.New("invalid network CIDR")
+
+// defaultRoute is the destination of the route to the internet
+const defaultRoute = "0.0.0.0/0"
+
+// natGatewayUserData is the cloud-init configuration of the NAT gateway.
+// It enables forwarding and masquerades the traffic of the network which leaves it.
+const natGatewayUserData = `#cloud-config
+write_files:
+  - path: /etc/sysctl.d/90-nat-gateway.conf
+    content: |
+      net.ipv4.ip_forward = 1
+  - path: /etc/nftables.conf
+    content: |
+      #!/usr/sbin/nft -f
+      flush ruleset
+      table ip nat {
+        chain postrouting {
+          type nat hook postrouting priority srcnat; policy accept;
+          ip saddr %[1]s ip daddr != %[1]s masquerade
+        }
+      }
+runcmd:
+  - sysctl --system
+  - systemctl enable --now nftables
+`
+
+type NATGatewayArgs struct {
+	// ClusterName is the name of the cluster, it is the value of the cluster label of the gateway
+	ClusterName string
+	// Network is the network whose traffic to the internet is routed through the gateway
+	Network *Network
+	// CIDR is the IP range of the network, like 10.128.0.0/9
+	CIDR string
+	// ServerSize is the server type of the gateway
+	ServerSize string
+	// Image is the Hetzner image of the gateway, like "debian-12"
+	Image string
+	// Region is the region of the gateway
+	Region string
+	// Protect the resources from accidental deletion
+	Protect bool
+}
+
+// NATGateway is a server which masquerades the traffic of the network to the internet
+type NATGateway struct {
+	Server        *hcloud.Server
+	ServerNetwork *hcloud.ServerNetwork
+	Firewall      *hcloud.Firewall
+	// Route routes the traffic of the network to the internet through the gateway
+	Route *hcloud.NetworkRoute
+}
+
+// NewNATGateway creates the NAT gateway of the network and routes the traffic to the internet through it.
+// The firewall of the gateway has no inbound rules, the gateway is only reached through the network.
+func NewNATGateway(ctx *pulumi.Context, name string, args *NATGatewayArgs, opts ...pulumi.ResourceOption) (*NATGateway, error) {
+	if _, err := Gateway(args.CIDR); err != nil {
+		return nil, err
+	}
+
+	labels := meta.NewLabels(ctx, &meta.ServerLabelsArgs{ClusterName: args.ClusterName, ServerNodeType: meta.NoneNode})
+	resourceOpts := func(extra ...pulumi.ResourceOption) []pulumi.ResourceOption {
+		out := append([]pulumi.ResourceOption{}, opts...)
+		return append(append(out, pulumi.Protect(args.Protect)), extra...)
+	}
+
+	firewall, err := hcloud.NewFirewall(ctx, name, &hcloud.FirewallArgs{
+		Name:   pulumi.String(name),
+		Labels: labels,
+	}, resourceOpts()...)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := hcloud.NewServer(ctx, name, &hcloud.ServerArgs{
+		Name:       pulumi.String(name),
+		Image:      pulumi.String(args.Image),
+		ServerType: pulumi.String(args.ServerSize),
+		Location:   pulumi.String(args.Region),
+		Labels:     labels,
+		PublicNets: hcloud.ServerPublicNetArray{
+			&hcloud.ServerPublicNetArgs{
+				Ipv4Enabled: pulumi.Bool(true),
+				Ipv6Enabled: pulumi.Bool(true),
+			},
+		},
+		UserData: pulumi.String(fmt.Sprintf(natGatewayUserData, args.CIDR)),
+		FirewallIds: pulumi.IntArray{
+			firewall.ID().ApplyT(func(id pulumi.ID) int {
+				idInt, _ := strconv.Atoi(string(id))
+				return idInt
+			}).(pulumi.IntOutput),
+		},
+		RebuildProtection: pulumi.Bool(args.Protect),
+		DeleteProtection:  pulumi.Bool(args.Protect),
+	}, resourceOpts(pulumi.IgnoreChanges([]string{"userData", "image"}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	networkID := args.Network.Network.ID().ApplyT(func(id pulumi.ID) int {
+		idInt, _ := strconv.Atoi(string(id))
+		return idInt
+	}).(pulumi.IntOutput)
+
+	serverNetwork, err := hcloud.NewServerNetwork(ctx, name, &hcloud.ServerNetworkArgs{
+		ServerId: server.ID().ApplyT(func(id pulumi.ID) int {
+			idInt, _ := strconv.Atoi(string(id))
+			return idInt
+		}).(pulumi.IntOutput),
+		NetworkId: networkID,
+	}, resourceOpts(pulumi.Parent(server), pulumi.DependsOn([]pulumi.Resource{args.Network.NetworkSubnet}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	route, err := hcloud.NewNetworkRoute(ctx, name, &hcloud.NetworkRouteArgs{
+		NetworkId:   networkID,
+		Destination: pulumi.String(defaultRoute),
+		Gateway:     serverNetwork.Ip,
+	}, resourceOpts(pulumi.Parent(serverNetwork))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NATGateway{
+		Server:        server,
+		ServerNetwork: serverNetwork,
+		Firewall:      firewall,
+		Route:         route,
+	}, nil
+}
+
+// Gateway returns the gateway of the network with the IP range, the first IP of the range.
+// Servers of the network reach the other servers and the routes of the network through it.
+func Gateway(cidr string) (string, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidCIDR, err)
+	}
+	if !prefix.Addr().Is4() {
+		return "", fmt.Errorf("%w: %s is not an IPv4 range", ErrInvalidCIDR, cidr)
+	}
+
+	return prefix.Masked().Addr().Next().String(), nil
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGateway(t *testing.T) {
+	tests := []struct {
+		name    string
+		cidr    string
+		want    string
+		wantErr error
+	}{
+		{name: "default network", cidr: "10.128.0.0/9", want: "10.128.0.1"},
+		{name: "unmasked network", cidr: "10.0.5.0/16", want: "10.0.0.1"},
+		{name: "IPv6 network", cidr: "fd00::/8", wantErr: ErrInvalidCIDR},
+		{name: "invalid network", cidr: "10.0.0.0", wantErr: ErrInvalidCIDR},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Gateway(tt.cidr)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// labelsMocks records the labels of all registered resources by type and name
+type labelsMocks struct {
+	mu     sync.Mutex
+	labels map[string]map[string]string
+}
+
+func (m *labelsMocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	if labels, ok := args.Inputs["labels"]; ok {
+		recorded := map[string]string{}
+		for key, value := range labels.ObjectValue() {
+			recorded[string(key)] = value.StringValue()
+		}
+		m.mu.Lock()
+		m.labels[args.TypeToken+"::"+args.Name] = recorded
+		m.mu.Unlock()
+	}
+	return args.Name + "_id", args.Inputs, nil
+}
+
+func (m *labelsMocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+func TestNewNATGateway_clusterLabel(t *testing.T) {
+	recorder := &labelsMocks{labels: map[string]map[string]string{}}
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		net, err := NewNetwork(ctx, "staging-talos-network", &NetworkArgs{
+			ClusterName: "staging",
+			NetworkZone: "eu-central",
+			CIDR:        "10.128.0.0/9",
+			Subnet:      "10.128.1.0/24",
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = NewNATGateway(ctx, "staging-nat-gateway", &NATGatewayArgs{
+			ClusterName: "staging",
+			Network:     net,
+			CIDR:        "10.128.0.0/9",
+			ServerSize:  "cx23",
+			Image:       "debian-12",
+			Region:      "fsn1",
+		})
+		return err
+	}, pulumi.WithMocks("project", "stack", recorder))
+	require.NoError(t, err)
+
+	for _, name := range []string{"hcloud:index/server:Server::staging-nat-gateway", "hcloud:index/firewall:Firewall::staging-nat-gateway"} {
+		assert.Equal(t, "staging", recorder.labels[name][meta.ClusterLabel], name)
+	}
+}
@@ -9,6 +9,8 @@ import (
 )
 
 type NetworkArgs struct {
+	// ClusterName is the name of the cluster, the auto-scaler nodes of the cluster are found by its network
+	ClusterName string
 	// NetworkZone is the network zone for the network, like "eu-central"
 	NetworkZone string
 	// CIDR is the IP range for the network, like 10.0.0.0/8
@@ -20,13 +22,15 @@ type NetworkArgs struct {
 type Network struct {
 	Network       *hcloud.Network
 	NetworkSubnet *hcloud.NetworkSubnet
+	// NATGateway is the internet egress of the nodes without public IPv4, nil if no node needs it
+	NATGateway *NATGateway
 }
 
 func NewNetwork(ctx *pulumi.Context, name string, args *NetworkArgs, opts ...pulumi.ResourceOption) (*Network, error) {
 	network, err := hcloud.NewNetwork(ctx, name, &hcloud.NetworkArgs{
 		Name:    pulumi.String(name),
 		IpRange: pulumi.String(args.CIDR),
-		Labels:  meta.NewLabels(ctx, &meta.ServerLabelsArgs{ServerNodeType: meta.NoneNode}),
+		Labels:  meta.NewLabels(ctx, &meta.ServerLabelsArgs{ClusterName: args.ClusterName, ServerNodeType: meta.NoneNode}),
 	}, opts...)
 	if err != nil {
 		return nil, err
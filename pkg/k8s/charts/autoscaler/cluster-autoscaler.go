@@ -1,6 +1,8 @@
 package autoscaler
 
 import (
+	"fmt"
+
 	"dario.cat/mergo"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
@@ -42,6 +44,10 @@ type ClusterAutoscalerArgs struct {
 	EnableKubeSpan bool
 	// CNI is the CNI configuration for the cluster.
 	CNI *config.CNIConfig
+	// Proxy is the kube-proxy configuration for the cluster.
+	Proxy *config.ProxyConfig
+	// ConfigPatches are the cluster-wide Talos config patches, the patches of the pools are applied after them.
+	ConfigPatches []string
 }
 
 type ClusterAutoscaler struct {
@@ -70,6 +76,8 @@ type AutoscalerConfigurationArgs struct {
 	Firewall                    *hcloud.Firewall
 	EnableKubeSpan              bool
 	CNI                         *config.CNIConfig
+	Proxy                       *config.ProxyConfig
+	ConfigPatches               []string
 }
 
 // AutoscalerConfiguration holds the deployed autoscaler configuration resources
@@ -81,9 +89,34 @@ type AutoscalerConfiguration struct {
 	AutoscalingGroups       pulumi.Array
 }
 
+// NodeConfiguration returns the config patches of the nodes the autoscaler creates for a node pool
+func NodeConfiguration(args *AutoscalerConfigurationArgs, pool *config.NodePoolConfig) ([]string, error) {
+	return core.NewNodeConfiguration(&core.NodeConfigurationArgs{
+		ServerNodeType:        meta.WorkerNode,
+		Subnet:                args.Subnet,
+		PodSubnets:            args.PodSubnets,
+		DNSDomain:             args.DNSDomain,
+		ServiceSubnet:         args.ServiceSubnet,
+		NodeLabels:            pool.Labels,
+		NodeTaints:            pool.Taints,
+		NodeAnnotations:       pool.Annotations,
+		EnableLonghornSupport: args.EnableLonghorn,
+		LocalStorageFolders:   args.LocalStorageFolders,
+		Registries:            args.Registries,
+		EnableKubeSpan:        args.EnableKubeSpan,
+		Nameservers:           args.Nameservers,
+		CNI:                   args.CNI,
+		Proxy:                 args.Proxy,
+		ConfigPatches:         append(append([]string{}, args.ConfigPatches...), pool.ConfigPatches...),
+		Ephemeral:             pool.Ephemeral,
+		ImageCache:            pool.ImageCache,
+		Swap:                  pool.Swap,
+	})
+}
+
 // DeployAutoscalerConfiguration deploys the autoscaler configuration (secrets and node configs)
 // This can be used independently of whether the Helm chart is deployed or not
-func DeployAutoscalerConfiguration(ctx *pulumi.Context, args *AutoscalerConfigurationArgs, opts ...pulumi.ResourceOption) (*AutoscalerConfiguration, error) { //nolint:cyclop,funlen
+func DeployAutoscalerConfiguration(ctx *pulumi.Context, name string, args *AutoscalerConfigurationArgs, opts ...pulumi.ResourceOption) (*AutoscalerConfiguration, error) { //nolint:cyclop,funlen
 	imgARM, err := args.Images.GetImageByArch(image.ArchARM)
 	if err != nil {
 		return nil, err
@@ -96,22 +129,7 @@ func DeployAutoscalerConfiguration(ctx *pulumi.Context, args *AutoscalerConfigur
 	nodeConfigs := map[string]HCloudNodeConfig{}
 	autoscalingGroups := pulumi.Array{}
 	for _, pool := range args.NodePools {
-		workerNodeConfiguration, err := core.NewNodeConfiguration(&core.NodeConfigurationArgs{
-			ServerNodeType:        meta.WorkerNode,
-			Subnet:                args.Subnet,
-			PodSubnets:            args.PodSubnets,
-			DNSDomain:             args.DNSDomain,
-			ServiceSubnet:         args.ServiceSubnet,
-			NodeLabels:            pool.Labels,
-			NodeTaints:            pool.Taints,
-			NodeAnnotations:       pool.Annotations,
-			EnableLonghornSupport: args.EnableLonghorn,
-			LocalStorageFolders:   args.LocalStorageFolders,
-			Registries:            args.Registries,
-			EnableKubeSpan:        args.EnableKubeSpan,
-			Nameservers:           args.Nameservers,
-			CNI:                   args.CNI,
-		})
+		workerNodeConfiguration, err := NodeConfiguration(args, &pool)
 		if err != nil {
 			return nil, err
 		}
@@ -169,7 +187,7 @@ func DeployAutoscalerConfiguration(ctx *pulumi.Context, args *AutoscalerConfigur
 	clusterConfigJSON := clusterConfig.ToJSON()
 	clusterConfigJSONHash := hashJSON(clusterConfigJSON)
 
-	autoscalerSecret, err := corev1.NewSecret(ctx, "hcloud-autoscaler", &corev1.SecretArgs{
+	autoscalerSecret, err := corev1.NewSecret(ctx, fmt.Sprintf("%s-hcloud-autoscaler", name), &corev1.SecretArgs{
 		Metadata: &metav1.ObjectMetaArgs{
 			Name:      pulumi.String("hcloud-autoscaler"),
 			Namespace: pulumi.String("kube-system"),
@@ -179,12 +197,12 @@ func DeployAutoscalerConfiguration(ctx *pulumi.Context, args *AutoscalerConfigur
 			"HCLOUD_NETWORK":  args.Network.Network.ID(),
 			"HCLOUD_FIREWALL": args.Firewall.ID(),
 		},
-	}, opts...)
+	}, append(opts, meta.LegacyName("hcloud-autoscaler"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	autoscalerClusterConfig, err := corev1.NewSecret(ctx, "hcloud-autoscaler-cluster-config", &corev1.SecretArgs{
+	autoscalerClusterConfig, err := corev1.NewSecret(ctx, fmt.Sprintf("%s-hcloud-autoscaler-cluster-config", name), &corev1.SecretArgs{
 		Metadata: &metav1.ObjectMetaArgs{
 			Name:      pulumi.String("hcloud-autoscaler-cluster-config"),
 			Namespace: pulumi.String("kube-system"),
@@ -192,7 +210,7 @@ func DeployAutoscalerConfiguration(ctx *pulumi.Context, args *AutoscalerConfigur
 		StringData: pulumi.StringMap{
 			"HCLOUD_CLUSTER_CONFIG": clusterConfigJSON,
 		},
-	}, opts...)
+	}, append(opts, meta.LegacyName("hcloud-autoscaler-cluster-config"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -206,9 +224,9 @@ func DeployAutoscalerConfiguration(ctx *pulumi.Context, args *AutoscalerConfigur
 	}, nil
 }
 
-func NewClusterAutoscaler(ctx *pulumi.Context, args *ClusterAutoscalerArgs, opts ...pulumi.ResourceOption) (*ClusterAutoscaler, error) {
+func NewClusterAutoscaler(ctx *pulumi.Context, name string, args *ClusterAutoscalerArgs, opts ...pulumi.ResourceOption) (*ClusterAutoscaler, error) {
 	// Deploy autoscaler configuration (secrets and node configs)
-	autoscalerConfig, err := DeployAutoscalerConfiguration(ctx, &AutoscalerConfigurationArgs{
+	autoscalerConfig, err := DeployAutoscalerConfiguration(ctx, name, &AutoscalerConfigurationArgs{
 		Images:                      args.Images,
 		MachineConfigurationManager: args.MachineConfigurationManager,
 		NodePools:                   args.NodePools,
@@ -225,6 +243,8 @@ func NewClusterAutoscaler(ctx *pulumi.Context, args *ClusterAutoscalerArgs, opts
 		Firewall:                    args.Firewall,
 		EnableKubeSpan:              args.EnableKubeSpan,
 		CNI:                         args.CNI,
+		Proxy:                       args.Proxy,
+		ConfigPatches:               args.ConfigPatches,
 	}, opts...)
 	if err != nil {
 		return nil, err
@@ -278,7 +298,7 @@ func NewClusterAutoscaler(ctx *pulumi.Context, args *ClusterAutoscalerArgs, opts
 		return nil, err
 	}
 
-	clusterAutoscaler, err := helmv4.NewChart(ctx, "cluster-autoscaler", &helmv4.ChartArgs{
+	clusterAutoscaler, err := helmv4.NewChart(ctx, fmt.Sprintf("%s-cluster-autoscaler", name), &helmv4.ChartArgs{
 		Chart:     pulumi.String("cluster-autoscaler"),
 		Namespace: pulumi.String("kube-system"),
 		RepositoryOpts: &helmv4.RepositoryOptsArgs{
@@ -287,6 +307,7 @@ func NewClusterAutoscaler(ctx *pulumi.Context, args *ClusterAutoscalerArgs, opts
 		Version: pulumi.StringPtrFromPtr(args.Version),
 		Values:  values,
 	}, append(opts,
+		meta.LegacyName("cluster-autoscaler"),
 		pulumi.Parent(autoscalerConfig.AutoscalerSecret),
 		pulumi.DependsOn([]pulumi.Resource{
 			autoscalerConfig.AutoscalerSecret,
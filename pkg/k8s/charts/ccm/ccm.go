@@ -1,7 +1,10 @@
 package ccm
 
 import (
+	"fmt"
+
 	"dario.cat/mergo"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/network"
 	helmv4 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v4"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
@@ -24,7 +27,7 @@ type CloudControlManager struct {
 	Chart *helmv4.Chart
 }
 
-func NewCloudControlManager(ctx *pulumi.Context, args *CloudControlManagerArgs, opts ...pulumi.ResourceOption) (*CloudControlManager, error) {
+func NewCloudControlManager(ctx *pulumi.Context, name string, args *CloudControlManagerArgs, opts ...pulumi.ResourceOption) (*CloudControlManager, error) {
 	// hcloudLoadBalancersDisablePrivateIngress := !args.EnablePrivateIngress
 
 	preDefineValues := pulumi.Map{
@@ -52,7 +55,7 @@ func NewCloudControlManager(ctx *pulumi.Context, args *CloudControlManagerArgs,
 		return nil, err
 	}
 
-	ccmChart, err := helmv4.NewChart(ctx, "hcloud-cloud-controller-manager", &helmv4.ChartArgs{
+	ccmChart, err := helmv4.NewChart(ctx, fmt.Sprintf("%s-hcloud-cloud-controller-manager", name), &helmv4.ChartArgs{
 		Chart:     pulumi.String("hcloud-cloud-controller-manager"),
 		Namespace: pulumi.String("kube-system"),
 		RepositoryOpts: &helmv4.RepositoryOptsArgs{
@@ -60,7 +63,7 @@ func NewCloudControlManager(ctx *pulumi.Context, args *CloudControlManagerArgs,
 		},
 		Version: pulumi.StringPtrFromPtr(args.Version),
 		Values:  values,
-	}, opts...)
+	}, append(opts, meta.LegacyName("hcloud-cloud-controller-manager"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,136 @@
+package cilium
+
+import (
+	"fmt"
+
+	"dario.cat/mergo"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/helm"
+)
+
+const (
+	// chartRepo is the repository of the Cilium chart
+	chartRepo = "https://helm.cilium.io"
+	// chartName is the name of the Cilium chart and its release
+	chartName = "cilium"
+	// namespace is the namespace Cilium is installed in
+	namespace = "kube-system"
+	// kubePrismPort is the port of KubePrism, the Kubernetes API load balancer of Talos on every node.
+	// Without kube-proxy, Cilium can not reach the API server through the kubernetes service.
+	kubePrismPort = 7445
+	// gatewayAPIStandardURL is the URL of the standard Gateway API CRDs of a release
+	gatewayAPIStandardURL = "https://github.com/kubernetes-sigs/gateway-api/releases/download/%s/standard-install.yaml"
+	// gatewayAPITLSRouteURL is the URL of the experimental TLSRoute CRD, which Cilium requires for its Gateway API support
+	gatewayAPITLSRouteURL = "https://raw.githubusercontent.com/kubernetes-sigs/gateway-api/%s/config/crd/experimental/gateway.networking.k8s.io_tlsroutes.yaml"
+)
+
+// BootstrapManifestsArgs are the arguments for the NewBootstrapManifests function
+type BootstrapManifestsArgs struct {
+	// Config is the Cilium configuration
+	Config config.CiliumConfig
+	// PodSubnets is the pod subnets of the cluster, which are routed natively
+	PodSubnets string
+	// KubernetesVersion is the Kubernetes version of the cluster
+	KubernetesVersion string
+	// CacheDir is the directory of the downloaded charts, defaults to the Helm repository cache
+	CacheDir string
+}
+
+// BootstrapManifests are the manifests which install Cilium when the cluster is bootstrapped
+type BootstrapManifests struct {
+	// InlineManifests contain the rendered Cilium chart
+	InlineManifests []config.ClusterInlineManifest
+	// ExtraManifests are the URLs of the Gateway API CRDs, if the Gateway API is enabled
+	ExtraManifests []string
+}
+
+// NewBootstrapManifests renders the Cilium chart into inline manifests for the Talos control plane configuration.
+// Cilium replaces kube-proxy and routes pods natively over the Hetzner private network.
+func NewBootstrapManifests(args *BootstrapManifestsArgs) (*BootstrapManifests, error) {
+	chartValues, err := values(args)
+	if err != nil {
+		return nil, err
+	}
+
+	apiVersions := []string{}
+	if args.Config.GatewayAPI {
+		apiVersions = append(apiVersions, "gateway.networking.k8s.io/v1", "gateway.networking.k8s.io/v1alpha2")
+	}
+
+	manifest, err := helm.NewInlineManifest(&helm.InlineManifestArgs{
+		RenderArgs: helm.RenderArgs{
+			Chart:             chartName,
+			Repo:              chartRepo,
+			Version:           args.Config.Version,
+			ReleaseName:       chartName,
+			Namespace:         namespace,
+			Values:            chartValues,
+			KubernetesVersion: args.KubernetesVersion,
+			APIVersions:       apiVersions,
+			CacheDir:          args.CacheDir,
+		},
+		Name: chartName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &BootstrapManifests{
+		InlineManifests: []config.ClusterInlineManifest{manifest},
+		ExtraManifests:  gatewayAPIManifests(args.Config),
+	}, nil
+}
+
+// values returns the chart values for Cilium on Talos, merged with the values of the configuration
+func values(args *BootstrapManifestsArgs) (map[string]interface{}, error) {
+	chartValues := map[string]interface{}{
+		"ipam": map[string]interface{}{
+			// the pod CIDRs are allocated by the controller manager and routed by the Hetzner CCM
+			"mode": "kubernetes",
+		},
+		"routingMode":           "native",
+		"ipv4NativeRoutingCIDR": args.PodSubnets,
+		"securityContext": map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"ciliumAgent":      []string{"CHOWN", "KILL", "NET_ADMIN", "NET_RAW", "IPC_LOCK", "SYS_ADMIN", "SYS_RESOURCE", "DAC_OVERRIDE", "FOWNER", "SETGID", "SETUID"},
+				"cleanCiliumState": []string{"NET_ADMIN", "SYS_ADMIN", "SYS_RESOURCE"},
+			},
+		},
+		// Talos mounts the cgroup filesystem itself
+		"cgroup": map[string]interface{}{
+			"autoMount": map[string]interface{}{
+				"enabled": false,
+			},
+			"hostRoot": "/sys/fs/cgroup",
+		},
+		"gatewayAPI": map[string]interface{}{
+			"enabled": args.Config.GatewayAPI,
+		},
+	}
+
+	if args.Config.Values != nil {
+		err := mergo.Merge(&chartValues, args.Config.Values, mergo.WithOverride)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge cilium values: %w", err)
+		}
+	}
+
+	// kube-proxy is disabled with Cilium, so Cilium must replace it and reach the API server through KubePrism
+	chartValues["kubeProxyReplacement"] = true
+	chartValues["k8sServiceHost"] = "localhost"
+	chartValues["k8sServicePort"] = kubePrismPort
+
+	return chartValues, nil
+}
+
+// gatewayAPIManifests returns the URLs of the Gateway API CRDs, if the Gateway API is enabled
+func gatewayAPIManifests(cfg config.CiliumConfig) []string {
+	if !cfg.GatewayAPI {
+		return nil
+	}
+
+	return []string{
+		fmt.Sprintf(gatewayAPIStandardURL, cfg.GatewayAPIVersion),
+		fmt.Sprintf(gatewayAPITLSRouteURL, cfg.GatewayAPIVersion),
+	}
+}
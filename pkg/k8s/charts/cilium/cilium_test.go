@@ -0,0 +1,87 @@
+package cilium
+
+import (
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_values(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   *BootstrapManifestsArgs
+		verify func(t *testing.T, got map[string]interface{})
+	}{
+		{
+			name: "native routing of the pod subnets",
+			args: &BootstrapManifestsArgs{PodSubnets: "172.20.0.0/16"},
+			verify: func(t *testing.T, got map[string]interface{}) {
+				assert.Equal(t, "native", got["routingMode"])
+				assert.Equal(t, "172.20.0.0/16", got["ipv4NativeRoutingCIDR"])
+				assert.Equal(t, true, got["kubeProxyReplacement"])
+				assert.Equal(t, kubePrismPort, got["k8sServicePort"])
+				assert.Equal(t, map[string]interface{}{"enabled": false}, got["gatewayAPI"])
+			},
+		},
+		{
+			name: "gateway api",
+			args: &BootstrapManifestsArgs{Config: config.CiliumConfig{GatewayAPI: true}},
+			verify: func(t *testing.T, got map[string]interface{}) {
+				assert.Equal(t, map[string]interface{}{"enabled": true}, got["gatewayAPI"])
+			},
+		},
+		{
+			name: "configured values are merged, configured values take precedence",
+			args: &BootstrapManifestsArgs{
+				PodSubnets: "172.20.0.0/16",
+				Config: config.CiliumConfig{
+					Values: map[string]interface{}{
+						"routingMode": "tunnel",
+						"ipam":        map[string]interface{}{"mode": "cluster-pool", "operator": map[string]interface{}{"clusterPoolIPv4MaskSize": 24}},
+						"hubble":      map[string]interface{}{"enabled": true},
+					},
+				},
+			},
+			verify: func(t *testing.T, got map[string]interface{}) {
+				assert.Equal(t, "tunnel", got["routingMode"])
+				assert.Equal(t, map[string]interface{}{"mode": "cluster-pool", "operator": map[string]interface{}{"clusterPoolIPv4MaskSize": 24}}, got["ipam"])
+				assert.Equal(t, map[string]interface{}{"enabled": true}, got["hubble"])
+				assert.Equal(t, "172.20.0.0/16", got["ipv4NativeRoutingCIDR"])
+			},
+		},
+		{
+			name: "kube-proxy replacement is required",
+			args: &BootstrapManifestsArgs{
+				Config: config.CiliumConfig{
+					Values: map[string]interface{}{
+						"kubeProxyReplacement": false,
+						"k8sServiceHost":       "10.0.0.1",
+						"k8sServicePort":       6443,
+					},
+				},
+			},
+			verify: func(t *testing.T, got map[string]interface{}) {
+				assert.Equal(t, true, got["kubeProxyReplacement"])
+				assert.Equal(t, "localhost", got["k8sServiceHost"])
+				assert.Equal(t, kubePrismPort, got["k8sServicePort"])
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := values(tt.args)
+			require.NoError(t, err)
+			tt.verify(t, got)
+		})
+	}
+}
+
+func Test_gatewayAPIManifests(t *testing.T) {
+	assert.Nil(t, gatewayAPIManifests(config.CiliumConfig{GatewayAPIVersion: "v1.3.0"}))
+	assert.Equal(t, []string{
+		"https://github.com/kubernetes-sigs/gateway-api/releases/download/v1.3.0/standard-install.yaml",
+		"https://raw.githubusercontent.com/kubernetes-sigs/gateway-api/v1.3.0/config/crd/experimental/gateway.networking.k8s.io_tlsroutes.yaml",
+	}, gatewayAPIManifests(config.CiliumConfig{GatewayAPI: true, GatewayAPIVersion: "v1.3.0"}))
+}
@@ -1,7 +1,10 @@
 package csi
 
 import (
+	"fmt"
+
 	"dario.cat/mergo"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	helmv4 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v4"
 	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
@@ -27,8 +30,8 @@ type CSI struct {
 	Chart *helmv4.Chart
 }
 
-func NewCSI(ctx *pulumi.Context, args *CSIArgs, opts ...pulumi.ResourceOption) (*CSI, error) {
-	encryptionSecret, err := corev1.NewSecret(ctx, "encryption-secret", &corev1.SecretArgs{
+func NewCSI(ctx *pulumi.Context, name string, args *CSIArgs, opts ...pulumi.ResourceOption) (*CSI, error) {
+	encryptionSecret, err := corev1.NewSecret(ctx, fmt.Sprintf("%s-encryption-secret", name), &corev1.SecretArgs{
 		Metadata: &metav1.ObjectMetaArgs{
 			Name:      pulumi.String("encryption-secret"),
 			Namespace: pulumi.String("kube-system"),
@@ -36,7 +39,7 @@ func NewCSI(ctx *pulumi.Context, args *CSIArgs, opts ...pulumi.ResourceOption) (
 		StringData: pulumi.StringMap{
 			"encryption-passphrase": pulumi.String(args.EncryptedSecret),
 		},
-	}, opts...)
+	}, append(opts, meta.LegacyName("encryption-secret"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +68,7 @@ func NewCSI(ctx *pulumi.Context, args *CSIArgs, opts ...pulumi.ResourceOption) (
 		return nil, err
 	}
 
-	ccmChart, err := helmv4.NewChart(ctx, "hcloud-csi", &helmv4.ChartArgs{
+	ccmChart, err := helmv4.NewChart(ctx, fmt.Sprintf("%s-hcloud-csi", name), &helmv4.ChartArgs{
 		Chart:     pulumi.String("hcloud-csi"),
 		Namespace: pulumi.String("kube-system"),
 		RepositoryOpts: &helmv4.RepositoryOptsArgs{
@@ -73,7 +76,7 @@ func NewCSI(ctx *pulumi.Context, args *CSIArgs, opts ...pulumi.ResourceOption) (
 		},
 		Version: pulumi.StringPtrFromPtr(args.Version),
 		Values:  values,
-	}, opts...)
+	}, append(opts, meta.LegacyName("hcloud-csi"))...)
 	if err != nil {
 		return nil, err
 	}
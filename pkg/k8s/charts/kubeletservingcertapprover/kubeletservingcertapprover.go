@@ -2,7 +2,9 @@ package kubeletservingcertapprover
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/yaml"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
@@ -18,11 +20,22 @@ type KubeletServingCertApprover struct {
 	Resource *yaml.ConfigFile
 }
 
-func New(ctx *pulumi.Context, args *Args, opts ...pulumi.ResourceOption) (*KubeletServingCertApprover, error) {
-	r, err := yaml.NewConfigFile(ctx, "kubelet-serving-cert-approver",
+func New(ctx *pulumi.Context, name string, args *Args, opts ...pulumi.ResourceOption) (*KubeletServingCertApprover, error) {
+	r, err := yaml.NewConfigFile(ctx, fmt.Sprintf("%s-kubelet-serving-cert-approver", name),
 		&yaml.ConfigFileArgs{
-			File: fmt.Sprintf("https://raw.githubusercontent.com/alex1989hu/kubelet-serving-cert-approver/%s/deploy/standalone-install.yaml", args.Version),
-		}, opts...)
+			File:           fmt.Sprintf("https://raw.githubusercontent.com/alex1989hu/kubelet-serving-cert-approver/%s/deploy/standalone-install.yaml", args.Version),
+			ResourcePrefix: name,
+		}, append(opts,
+			// the file and its resources were created without the prefix before
+			pulumi.Transformations([]pulumi.ResourceTransformation{
+				func(args *pulumi.ResourceTransformationArgs) *pulumi.ResourceTransformationResult {
+					return &pulumi.ResourceTransformationResult{
+						Props: args.Props,
+						Opts:  append(args.Opts, meta.LegacyName(strings.TrimPrefix(args.Name, name+"-"))),
+					}
+				},
+			}),
+		)...)
 	if err != nil {
 		return nil, err
 	}
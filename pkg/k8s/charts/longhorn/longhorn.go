@@ -1,7 +1,10 @@
 package longhorn
 
 import (
+	"fmt"
+
 	"dario.cat/mergo"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	helmv4 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v4"
 	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
@@ -22,8 +25,8 @@ type Longhorn struct {
 	Chart     *helmv4.Chart
 }
 
-func NewLonghorn(ctx *pulumi.Context, args *LonghornArgs, opts ...pulumi.ResourceOption) (*Longhorn, error) {
-	longhornNS, err := corev1.NewNamespace(ctx, "longhorn-system", &corev1.NamespaceArgs{
+func NewLonghorn(ctx *pulumi.Context, name string, args *LonghornArgs, opts ...pulumi.ResourceOption) (*Longhorn, error) {
+	longhornNS, err := corev1.NewNamespace(ctx, fmt.Sprintf("%s-longhorn-system", name), &corev1.NamespaceArgs{
 		Metadata: &metav1.ObjectMetaArgs{
 			Name: pulumi.String("longhorn-system"),
 			Labels: pulumi.StringMap{
@@ -32,7 +35,7 @@ func NewLonghorn(ctx *pulumi.Context, args *LonghornArgs, opts ...pulumi.Resourc
 				"pod-security.kubernetes.io/warn":    pulumi.String("privileged"),
 			},
 		},
-	}, opts...)
+	}, append(opts, meta.LegacyName("longhorn-system"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +56,7 @@ func NewLonghorn(ctx *pulumi.Context, args *LonghornArgs, opts ...pulumi.Resourc
 		return nil, err
 	}
 
-	longhorn, err := helmv4.NewChart(ctx, "longhorn", &helmv4.ChartArgs{
+	longhorn, err := helmv4.NewChart(ctx, fmt.Sprintf("%s-longhorn", name), &helmv4.ChartArgs{
 		Chart:     pulumi.String("longhorn"),
 		Namespace: longhornNS.Metadata.Name(),
 		RepositoryOpts: &helmv4.RepositoryOptsArgs{
@@ -62,6 +65,7 @@ func NewLonghorn(ctx *pulumi.Context, args *LonghornArgs, opts ...pulumi.Resourc
 		Version: pulumi.StringPtrFromPtr(args.Version),
 		Values:  values,
 	}, append(opts,
+		meta.LegacyName("longhorn"),
 		pulumi.Parent(longhornNS),
 	)...)
 	if err != nil {
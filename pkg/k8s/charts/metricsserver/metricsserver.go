@@ -1,7 +1,10 @@
 package metricsserver
 
 import (
+	"fmt"
+
 	"dario.cat/mergo"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	helmv4 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/helm/v4"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
@@ -19,7 +22,7 @@ type MetricServer struct {
 	Chart *helmv4.Chart
 }
 
-func New(ctx *pulumi.Context, args *Args, opts ...pulumi.ResourceOption) (*MetricServer, error) {
+func New(ctx *pulumi.Context, name string, args *Args, opts ...pulumi.ResourceOption) (*MetricServer, error) {
 	preDefineValues := pulumi.Map{}
 
 	values := pulumi.Map{}
@@ -32,7 +35,7 @@ func New(ctx *pulumi.Context, args *Args, opts ...pulumi.ResourceOption) (*Metri
 		return nil, err
 	}
 
-	ccmChart, err := helmv4.NewChart(ctx, "metrics-server", &helmv4.ChartArgs{
+	ccmChart, err := helmv4.NewChart(ctx, fmt.Sprintf("%s-metrics-server", name), &helmv4.ChartArgs{
 		Chart:     pulumi.String("metrics-server"),
 		Namespace: pulumi.String("kube-system"),
 		RepositoryOpts: &helmv4.RepositoryOptsArgs{
@@ -40,7 +43,7 @@ func New(ctx *pulumi.Context, args *Args, opts ...pulumi.ResourceOption) (*Metri
 		},
 		Version: pulumi.StringPtrFromPtr(args.Version),
 		Values:  values,
-	}, opts...)
+	}, append(opts, meta.LegacyName("metrics-server"))...)
 	if err != nil {
 		return nil, err
 	}
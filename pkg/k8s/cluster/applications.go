@@ -1,7 +1,10 @@
 package cluster
 
 import (
+	"fmt"
+
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/network"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/charts/autoscaler"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/charts/ccm"
@@ -15,14 +18,14 @@ import (
 	"github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes"
 	corev1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/core/v1"
 	metav1 "github.com/pulumi/pulumi-kubernetes/sdk/v4/go/kubernetes/meta/v1"
-	"github.com/pulumiverse/pulumi-talos/sdk/go/talos/cluster"
-
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumiverse/pulumi-talos/sdk/go/talos/cluster"
 )
 
 type ApplicationsArgs struct {
 	Cfg                         *config.PulumiConfig
 	Kubeconfig                  *cluster.Kubeconfig
+	Readiness                   *core.ClusterReadiness
 	Network                     *network.Network
 	Images                      *image.Images
 	MachineConfigurationManager *core.MachineConfigurationManager
@@ -45,10 +48,24 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 	out := &Applications{}
 	var err error
 
-	out.Provider, err = kubernetes.NewProvider(ctx, "k8s", &kubernetes.ProviderArgs{
-		Kubeconfig:        args.Kubeconfig.KubeconfigRaw,
+	providerOpts := append([]pulumi.ResourceOption{}, opts...)
+	// the provider is only used once the cluster is healthy
+	if args.Readiness.Gate != nil {
+		providerOpts = append(providerOpts, pulumi.DependsOn([]pulumi.Resource{args.Readiness.Gate}))
+	}
+
+	out.Provider, err = kubernetes.NewProvider(ctx, fmt.Sprintf("%s-k8s", name), &kubernetes.ProviderArgs{
+		Kubeconfig:        args.Readiness.Kubeconfig,
 		ClusterIdentifier: pulumi.StringPtr("hcloud-talos-k8s"),
-	}, pulumi.Parent(args.Kubeconfig))
+	}, append(providerOpts,
+		// the provider was created below the kubeconfig before the cluster became a component resource
+		meta.LegacyAlias(ctx, "k8s",
+			"talos:machine/secrets:Secrets",
+			"talos:machine/bootstrap:Bootstrap",
+			"talos:cluster/kubeconfig:Kubeconfig",
+			"pulumi:providers:kubernetes",
+		),
+	)...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +81,7 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 	)
 
 	if args.Cfg.Kubernetes.HCloudToken != "" {
-		out.HcloudSecret, err = corev1.NewSecret(ctx, "hcloud-secret", &corev1.SecretArgs{
+		out.HcloudSecret, err = corev1.NewSecret(ctx, fmt.Sprintf("%s-hcloud-secret", name), &corev1.SecretArgs{
 			Metadata: &metav1.ObjectMetaArgs{
 				Name:      pulumi.String("hcloud"),
 				Namespace: pulumi.String("kube-system"),
@@ -74,7 +91,7 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 				"network": args.Network.Network.ID(),
 			},
 		},
-			opts...,
+			append(opts, meta.LegacyName("hcloud-secret"))...,
 		)
 		if err != nil {
 			return nil, err
@@ -83,7 +100,7 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 	}
 
 	if args.Cfg.Kubernetes.HetznerCCM != nil && args.Cfg.Kubernetes.HetznerCCM.Enabled {
-		out.CloudControlManager, err = ccm.NewCloudControlManager(ctx, &ccm.CloudControlManagerArgs{
+		out.CloudControlManager, err = ccm.NewCloudControlManager(ctx, name, &ccm.CloudControlManagerArgs{
 			Network:    args.Network,
 			Values:     args.Cfg.Kubernetes.HetznerCCM.Values,
 			Version:    args.Cfg.Kubernetes.HetznerCCM.Version,
@@ -97,7 +114,7 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 	}
 
 	if args.Cfg.Kubernetes.CSI != nil && args.Cfg.Kubernetes.CSI.Enabled {
-		out.CSI, err = csi.NewCSI(ctx, &csi.CSIArgs{
+		out.CSI, err = csi.NewCSI(ctx, name, &csi.CSIArgs{
 			Values:                args.Cfg.Kubernetes.CSI.Values,
 			Version:               args.Cfg.Kubernetes.CSI.Version,
 			EncryptedSecret:       args.Cfg.Kubernetes.CSI.EncryptedSecret,
@@ -113,12 +130,12 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 
 	// Deploy autoscaler configuration if any node pool has autoscaling enabled
 	// This configuration is needed even if the Helm chart is not deployed
-	if err := deployAutoscaler(ctx, out, args, opts); err != nil {
+	if err := deployAutoscaler(ctx, name, out, args, opts); err != nil {
 		return nil, err
 	}
 
 	if args.Cfg.Kubernetes.KubeletServingCertApprover != nil && args.Cfg.Kubernetes.KubeletServingCertApprover.Enabled {
-		out.KubeletServingCertApprover, err = kubeletservingcertapprover.New(ctx, &kubeletservingcertapprover.Args{
+		out.KubeletServingCertApprover, err = kubeletservingcertapprover.New(ctx, name, &kubeletservingcertapprover.Args{
 			Version: args.Cfg.Kubernetes.KubeletServingCertApprover.Version,
 		},
 			opts...,
@@ -129,7 +146,7 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 	}
 
 	if args.Cfg.Kubernetes.KubernetesMetricsServer != nil && args.Cfg.Kubernetes.KubernetesMetricsServer.Enabled {
-		out.MetricServer, err = metricsserver.New(ctx, &metricsserver.Args{
+		out.MetricServer, err = metricsserver.New(ctx, name, &metricsserver.Args{
 			Values:  args.Cfg.Kubernetes.KubernetesMetricsServer.Values,
 			Version: args.Cfg.Kubernetes.KubernetesMetricsServer.Version,
 		},
@@ -141,7 +158,7 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 	}
 
 	if args.Cfg.Kubernetes.Longhorn != nil && args.Cfg.Kubernetes.Longhorn.Enabled {
-		out.Longhorn, err = longhorn.NewLonghorn(ctx, &longhorn.LonghornArgs{
+		out.Longhorn, err = longhorn.NewLonghorn(ctx, name, &longhorn.LonghornArgs{
 			Values:  args.Cfg.Kubernetes.Longhorn.Values,
 			Version: args.Cfg.Kubernetes.Longhorn.Version,
 		},
@@ -158,7 +175,7 @@ func NewApplications(ctx *pulumi.Context, name string, args *ApplicationsArgs, o
 // deployAutoscaler handles deployment of cluster autoscaler and its configuration.
 // If autoscaling is configured (or ForceDeployAutoScalerConfig is set), it deploys
 // either the full Helm chart (if enabled) or just the configuration (if chart is disabled).
-func deployAutoscaler(ctx *pulumi.Context, out *Applications, args *ApplicationsArgs, opts []pulumi.ResourceOption) error {
+func deployAutoscaler(ctx *pulumi.Context, name string, out *Applications, args *ApplicationsArgs, opts []pulumi.ResourceOption) error {
 	// Check if any node pool has autoscaling configured
 	hasAutoScaling := false
 	for _, pool := range args.Cfg.NodePools.NodePools {
@@ -174,27 +191,10 @@ func deployAutoscaler(ctx *pulumi.Context, out *Applications, args *Applications
 	}
 
 	var err error
-	autoscalerArgs := &autoscaler.AutoscalerConfigurationArgs{
-		Images:                      args.Images,
-		MachineConfigurationManager: args.MachineConfigurationManager,
-		NodePools:                   args.Cfg.NodePools.NodePools,
-		Subnet:                      args.Cfg.Network.Subnet,
-		PodSubnets:                  args.Cfg.Network.PodSubnets,
-		DNSDomain:                   args.Cfg.Network.DNSDomain,
-		ServiceSubnet:               args.Cfg.Network.ServiceSubnet,
-		EnableLonghorn:              args.Cfg.Talos.EnableLonghorn,
-		LocalStorageFolders:         args.Cfg.Talos.LocalStorageFolders,
-		Registries:                  args.Cfg.Talos.Registries,
-		Network:                     args.Network,
-		Nameservers:                 args.Cfg.Network.Nameservers,
-		HcloudToken:                 args.Cfg.Kubernetes.HCloudToken,
-		Firewall:                    args.FirewallWorker,
-		EnableKubeSpan:              args.Cfg.Talos.EnableKubeSpan,
-		CNI:                         args.Cfg.Talos.CNI,
-	}
+	autoscalerArgs := NewAutoscalerConfigurationArgs(args)
 
 	if args.Cfg.Kubernetes.ClusterAutoScaler != nil && args.Cfg.Kubernetes.ClusterAutoScaler.Enabled {
-		out.ClusterAutoscaler, err = autoscaler.NewClusterAutoscaler(ctx, &autoscaler.ClusterAutoscalerArgs{
+		out.ClusterAutoscaler, err = autoscaler.NewClusterAutoscaler(ctx, name, &autoscaler.ClusterAutoscalerArgs{
 			Values:                      args.Cfg.Kubernetes.ClusterAutoScaler.Values,
 			Version:                     args.Cfg.Kubernetes.ClusterAutoScaler.Version,
 			Images:                      autoscalerArgs.Images,
@@ -213,6 +213,8 @@ func deployAutoscaler(ctx *pulumi.Context, out *Applications, args *Applications
 			Firewall:                    autoscalerArgs.Firewall,
 			EnableKubeSpan:              autoscalerArgs.EnableKubeSpan,
 			CNI:                         autoscalerArgs.CNI,
+			Proxy:                       autoscalerArgs.Proxy,
+			ConfigPatches:               autoscalerArgs.ConfigPatches,
 		},
 			opts...,
 		)
@@ -221,6 +223,30 @@ func deployAutoscaler(ctx *pulumi.Context, out *Applications, args *Applications
 
 	// If the Helm chart is not enabled but autoscaling is configured,
 	// deploy only the configuration (secrets and node configs)
-	out.AutoscalerConfiguration, err = autoscaler.DeployAutoscalerConfiguration(ctx, autoscalerArgs, opts...)
+	out.AutoscalerConfiguration, err = autoscaler.DeployAutoscalerConfiguration(ctx, name, autoscalerArgs, opts...)
 	return err
 }
+
+// NewAutoscalerConfigurationArgs returns the arguments of the autoscaler configuration for the applications
+func NewAutoscalerConfigurationArgs(args *ApplicationsArgs) *autoscaler.AutoscalerConfigurationArgs {
+	return &autoscaler.AutoscalerConfigurationArgs{
+		Images:                      args.Images,
+		MachineConfigurationManager: args.MachineConfigurationManager,
+		NodePools:                   args.Cfg.NodePools.NodePools,
+		Subnet:                      args.Cfg.Network.Subnet,
+		PodSubnets:                  args.Cfg.Network.PodSubnets,
+		DNSDomain:                   args.Cfg.Network.DNSDomain,
+		ServiceSubnet:               args.Cfg.Network.ServiceSubnet,
+		EnableLonghorn:              args.Cfg.Talos.EnableLonghorn,
+		LocalStorageFolders:         args.Cfg.Talos.LocalStorageFolders,
+		Registries:                  args.Cfg.Talos.Registries,
+		Network:                     args.Network,
+		Nameservers:                 args.Cfg.Network.Nameservers,
+		HcloudToken:                 args.Cfg.Kubernetes.HCloudToken,
+		Firewall:                    args.FirewallWorker,
+		EnableKubeSpan:              args.Cfg.Talos.EnableKubeSpan,
+		CNI:                         args.Cfg.Talos.CNI,
+		Proxy:                       args.Cfg.Talos.Proxy,
+		ConfigPatches:               args.Cfg.Talos.ConfigPatches,
+	}
+}
@@ -0,0 +1,243 @@
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidConfig is returned when the client configuration is incomplete or can not be parsed
+	ErrInvalidConfig = errors.New("invalid kubernetes client configuration")
+	// ErrAPIServerNotReady is returned when the Kubernetes API server does not report ready
+	ErrAPIServerNotReady = errors.New("kubernetes API server is not ready")
+	// ErrNodeNotReady is returned when a node did not become ready with the expected kubelet version in time
+	ErrNodeNotReady = errors.New("node is not ready")
+	// ErrUnexpectedResponse is returned when the Kubernetes API answers with an unexpected status
+	ErrUnexpectedResponse = errors.New("unexpected kubernetes API response")
+)
+
+// requestTimeout is the timeout of a single request against the Kubernetes API server
+const requestTimeout = 10 * time.Second
+
+// Config holds the endpoint and the credentials of the Kubernetes API server.
+// The certificates are PEM encoded.
+type Config struct {
+	// Host is the URL of the Kubernetes API server, e.g. "https://1.2.3.4:6443"
+	Host string
+	// CACertificate is the Kubernetes CA certificate
+	CACertificate []byte
+	// ClientCertificate is the client certificate, optional
+	ClientCertificate []byte
+	// ClientKey is the client private key, optional
+	ClientKey []byte
+}
+
+// Node is the health relevant state of a Kubernetes node.
+type Node struct {
+	// Name of the node
+	Name string
+	// InternalIP is the internal address the node is registered with
+	InternalIP string
+	// KubeletVersion is the version reported by the kubelet, e.g. "v1.34.0"
+	KubeletVersion string
+	// Ready is true if the node reports the Ready condition
+	Ready bool
+}
+
+// Client checks the health of a Kubernetes cluster through the API server.
+// It only implements the few requests needed to gate upgrades and to drain and remove nodes.
+type Client struct {
+	host string
+	http *http.Client
+}
+
+// NewClient creates a health client for the given configuration
+func NewClient(cfg *Config) (*Client, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("%w: no host", ErrInvalidConfig)
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(cfg.CACertificate) {
+		return nil, fmt.Errorf("%w: no CA certificate found", ErrInvalidConfig)
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:    rootCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(cfg.ClientCertificate) > 0 {
+		cert, err := tls.X509KeyPair(cfg.ClientCertificate, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &Client{
+		host: strings.TrimSuffix(cfg.Host, "/"),
+		http: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+			Timeout:   requestTimeout,
+		},
+	}, nil
+}
+
+// Ready checks that the API server reports ready
+func (c *Client) Ready(ctx context.Context) error {
+	resp, err := c.get(ctx, "/readyz")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrAPIServerNotReady, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s responded with %s", ErrAPIServerNotReady, c.host, resp.Status)
+	}
+
+	return nil
+}
+
+// WaitUntilReady polls the API server until it reports ready or the context is done
+func (c *Client) WaitUntilReady(ctx context.Context, interval time.Duration) error {
+	for {
+		err := c.Ready(ctx)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Nodes returns all nodes of the cluster
+func (c *Client) Nodes(ctx context.Context) ([]Node, error) {
+	resp, err := c.get(ctx, "/api/v1/nodes")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: listing nodes responded with %s", ErrUnexpectedResponse, resp.Status)
+	}
+
+	list := &nodeList{}
+	if err := json.NewDecoder(resp.Body).Decode(list); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+
+	nodes := make([]Node, 0, len(list.Items))
+	for _, item := range list.Items {
+		nodes = append(nodes, item.toNode())
+	}
+
+	return nodes, nil
+}
+
+// WaitForNode polls the nodes until the node with the internal IP is ready and runs the expected kubelet version,
+// or the context is done. An empty kubelet version accepts any version. Errors while the API server restarts are expected and ignored.
+func (c *Client) WaitForNode(ctx context.Context, internalIP, kubeletVersion string, interval time.Duration) error {
+	var lastErr error
+	for {
+		lastErr = c.checkNode(ctx, internalIP, kubeletVersion)
+		if lastErr == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(ErrNodeNotReady, lastErr)
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (c *Client) checkNode(ctx context.Context, internalIP, kubeletVersion string) error {
+	nodes, err := c.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		if node.InternalIP != internalIP {
+			continue
+		}
+		if kubeletVersion != "" && node.KubeletVersion != kubeletVersion {
+			return fmt.Errorf("%w: %s runs kubelet %s, expected %s", ErrNodeNotReady, node.Name, node.KubeletVersion, kubeletVersion)
+		}
+		if !node.Ready {
+			return fmt.Errorf("%w: %s reports not ready", ErrNodeNotReady, node.Name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: no node registered with IP %s", ErrNodeNotReady, internalIP)
+}
+
+func (c *Client) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.http.Do(req)
+}
+
+// nodeList is the subset of a Kubernetes NodeList used by the client
+type nodeList struct {
+	Items []nodeListItem `json:"items"`
+}
+
+// nodeListItem is the subset of a Kubernetes Node used by the client
+type nodeListItem struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Status struct {
+		Addresses  []nodeAddress   `json:"addresses"`
+		Conditions []nodeCondition `json:"conditions"`
+		NodeInfo   struct {
+			KubeletVersion string `json:"kubeletVersion"`
+		} `json:"nodeInfo"`
+	} `json:"status"`
+}
+
+type nodeAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+type nodeCondition struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+func (item *nodeListItem) toNode() Node {
+	node := Node{
+		Name:           item.Metadata.Name,
+		KubeletVersion: item.Status.NodeInfo.KubeletVersion,
+	}
+	for _, address := range item.Status.Addresses {
+		if address.Type == "InternalIP" {
+			node.InternalIP = address.Address
+		}
+	}
+	for _, condition := range item.Status.Conditions {
+		if condition.Type == "Ready" {
+			node.Ready = condition.Status == "True"
+		}
+	}
+	return node
+}
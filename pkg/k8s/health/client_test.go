@@ -0,0 +1,134 @@
+package health_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health/healthtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*healthtest.Server, *health.Client) {
+	t.Helper()
+
+	server, err := healthtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	client, err := health.NewClient(server.Config)
+	require.NoError(t, err)
+
+	return server, client
+}
+
+func TestClient_Ready(t *testing.T) {
+	server, client := newTestClient(t)
+
+	assert.NoError(t, client.Ready(context.Background()))
+
+	server.SetReady(false)
+	assert.ErrorIs(t, client.Ready(context.Background()), health.ErrAPIServerNotReady)
+}
+
+func TestClient_WaitUntilReady_timeout(t *testing.T) {
+	server, client := newTestClient(t)
+	server.SetReady(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, client.WaitUntilReady(ctx, 10*time.Millisecond), health.ErrAPIServerNotReady)
+}
+
+func TestClient_Nodes(t *testing.T) {
+	server, client := newTestClient(t)
+	server.SetNodes(
+		health.Node{Name: "controlplane-0", InternalIP: "10.0.1.1", KubeletVersion: "v1.34.0", Ready: true},
+		health.Node{Name: "worker-0", InternalIP: "10.0.1.2", KubeletVersion: "v1.33.5"},
+	)
+
+	nodes, err := client.Nodes(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []health.Node{
+		{Name: "controlplane-0", InternalIP: "10.0.1.1", KubeletVersion: "v1.34.0", Ready: true},
+		{Name: "worker-0", InternalIP: "10.0.1.2", KubeletVersion: "v1.33.5"},
+	}, nodes)
+}
+
+func TestClient_WaitForNode(t *testing.T) {
+	tests := []struct {
+		name           string
+		node           health.Node
+		kubeletVersion string
+		wantErr        bool
+	}{
+		{
+			name:           "ready with expected version",
+			node:           health.Node{Name: "worker-0", InternalIP: "10.0.1.2", KubeletVersion: "v1.34.0", Ready: true},
+			kubeletVersion: "v1.34.0",
+		},
+		{
+			name:           "old kubelet version",
+			node:           health.Node{Name: "worker-0", InternalIP: "10.0.1.2", KubeletVersion: "v1.33.5", Ready: true},
+			kubeletVersion: "v1.34.0",
+			wantErr:        true,
+		},
+		{
+			name: "ready with any version",
+			node: health.Node{Name: "worker-0", InternalIP: "10.0.1.2", KubeletVersion: "v1.33.5", Ready: true},
+		},
+		{
+			name:           "not ready",
+			node:           health.Node{Name: "worker-0", InternalIP: "10.0.1.2", KubeletVersion: "v1.34.0"},
+			kubeletVersion: "v1.34.0",
+			wantErr:        true,
+		},
+		{
+			name:           "not registered",
+			node:           health.Node{Name: "worker-1", InternalIP: "10.0.1.3", KubeletVersion: "v1.34.0", Ready: true},
+			kubeletVersion: "v1.34.0",
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			server.SetNodes(tt.node)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			err := client.WaitForNode(ctx, "10.0.1.2", tt.kubeletVersion, 10*time.Millisecond)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, health.ErrNodeNotReady)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewClient_invalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *health.Config
+	}{
+		{
+			name: "no host",
+			cfg:  &health.Config{},
+		},
+		{
+			name: "no CA certificate",
+			cfg:  &health.Config{Host: "https://127.0.0.1:6443"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := health.NewClient(tt.cfg)
+			assert.ErrorIs(t, err, health.ErrInvalidConfig)
+		})
+	}
+}
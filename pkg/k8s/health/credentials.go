@@ -0,0 +1,75 @@
+package health
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// adminCertificateLifetime is the lifetime of the generated admin certificates, they are only used during a deployment
+const adminCertificateLifetime = time.Hour
+
+// NewAdminCredentials issues a short-lived admin client certificate signed by the Kubernetes CA.
+// The certificate is in the system:masters group, like the admin kubeconfig generated by Talos.
+// It allows to talk to the API server before the kubeconfig resource of the cluster is available.
+// The CA certificate and key and the returned certificate and key are PEM encoded.
+func NewAdminCredentials(caCertificate, caKey []byte) (certificate, key []byte, err error) {
+	ca, err := tls.X509KeyPair(caCertificate, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: CA: %w", ErrInvalidConfig, err)
+	}
+	caCert, err := x509.ParseCertificate(ca.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: CA: %w", ErrInvalidConfig, err)
+	}
+	caSigner, ok := ca.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: CA key can not sign", ErrInvalidConfig)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)) //nolint:mnd // 128 bit serial number
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   "pulumi-hcloud-k8s",
+			Organization: []string{"system:masters"},
+		},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(adminCertificateLifetime),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &privateKey.PublicKey, caSigner)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certificate = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	key = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certificate, key, nil
+}
@@ -0,0 +1,43 @@
+package health_test
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health/healthtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAdminCredentials(t *testing.T) {
+	server, err := healthtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	certificate, key, err := health.NewAdminCredentials(server.Config.CACertificate, server.CAKey)
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(certificate)
+	require.NotNil(t, block)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"system:masters"}, cert.Subject.Organization)
+
+	// the API server only accepts client certificates signed by its CA
+	client, err := health.NewClient(&health.Config{
+		Host:              server.Config.Host,
+		CACertificate:     server.Config.CACertificate,
+		ClientCertificate: certificate,
+		ClientKey:         key,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, client.Ready(context.Background()))
+}
+
+func TestNewAdminCredentials_invalidCA(t *testing.T) {
+	_, _, err := health.NewAdminCredentials([]byte("not a certificate"), []byte("not a key"))
+	assert.ErrorIs(t, err, health.ErrInvalidConfig)
+}
@@ -0,0 +1,238 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// ErrEvictionBlocked is returned when the API server refuses an eviction, usually because of a PodDisruptionBudget
+	ErrEvictionBlocked = errors.New("pod eviction blocked by a disruption budget")
+	// ErrDrainTimeout is returned when pods are still running on a node when the drain times out
+	ErrDrainTimeout = errors.New("node drain timed out")
+)
+
+// Pod is the drain relevant state of a Kubernetes pod.
+type Pod struct {
+	// Namespace of the pod
+	Namespace string
+	// Name of the pod
+	Name string
+	// NodeName is the name of the node the pod is scheduled to
+	NodeName string
+	// DaemonSet is true if the pod is owned by a DaemonSet, such pods are not evicted
+	DaemonSet bool
+	// Mirror is true for static pods of the kubelet, such pods are not evicted
+	Mirror bool
+	// Finished is true if the pod succeeded or failed
+	Finished bool
+	// Terminating is true if the pod is being deleted
+	Terminating bool
+}
+
+// blocksDrain reports whether the pod must be gone before the node is drained
+func (p Pod) blocksDrain() bool {
+	return !p.DaemonSet && !p.Mirror && !p.Finished
+}
+
+// Cordon marks the node as unschedulable
+func (c *Client) Cordon(ctx context.Context, nodeName string) error {
+	resp, err := c.do(ctx, http.MethodPatch, "/api/v1/nodes/"+url.PathEscape(nodeName), "application/merge-patch+json",
+		map[string]any{"spec": map[string]any{"unschedulable": true}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: cordoning node %s responded with %s", ErrUnexpectedResponse, nodeName, resp.Status)
+	}
+
+	return nil
+}
+
+// Pods returns all pods scheduled to the node
+func (c *Client) Pods(ctx context.Context, nodeName string) ([]Pod, error) {
+	resp, err := c.get(ctx, "/api/v1/pods?fieldSelector="+url.QueryEscape("spec.nodeName="+nodeName))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: listing pods responded with %s", ErrUnexpectedResponse, resp.Status)
+	}
+
+	list := &podList{}
+	if err := json.NewDecoder(resp.Body).Decode(list); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+
+	pods := make([]Pod, 0, len(list.Items))
+	for _, item := range list.Items {
+		pods = append(pods, item.toPod())
+	}
+
+	return pods, nil
+}
+
+// Evict evicts the pod through the eviction API, which honours PodDisruptionBudgets.
+// It returns ErrEvictionBlocked if a budget does not allow the eviction right now. Pods which are gone are ignored.
+func (c *Client) Evict(ctx context.Context, namespace, name string) error {
+	resp, err := c.do(ctx, http.MethodPost,
+		fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/eviction", url.PathEscape(namespace), url.PathEscape(name)), "application/json",
+		map[string]any{
+			"apiVersion": "policy/v1",
+			"kind":       "Eviction",
+			"metadata":   map[string]any{"name": name, "namespace": namespace},
+		})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNotFound:
+		return nil
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %s/%s", ErrEvictionBlocked, namespace, name)
+	default:
+		return fmt.Errorf("%w: evicting pod %s/%s responded with %s", ErrUnexpectedResponse, namespace, name, resp.Status)
+	}
+}
+
+// Drain cordons the node and evicts its pods, like `kubectl drain --ignore-daemonsets`.
+// Evictions blocked by a disruption budget are retried until the context is done,
+// then ErrDrainTimeout is returned. Pods of DaemonSets and static pods stay on the node.
+func (c *Client) Drain(ctx context.Context, nodeName string, interval time.Duration) error {
+	if err := c.Cordon(ctx, nodeName); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for {
+		pods, err := c.Pods(ctx, nodeName)
+		if err != nil {
+			return err
+		}
+
+		remaining := 0
+		for _, pod := range pods {
+			if !pod.blocksDrain() {
+				continue
+			}
+			remaining++
+			if pod.Terminating {
+				continue
+			}
+
+			err := c.Evict(ctx, pod.Namespace, pod.Name)
+			switch {
+			case errors.Is(err, ErrEvictionBlocked):
+				lastErr = err
+			case err != nil:
+				return err
+			}
+		}
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(fmt.Errorf("%w: %d pods left on %s", ErrDrainTimeout, remaining, nodeName), lastErr)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// DeleteNode deletes the node object, nodes which are gone are ignored
+func (c *Client) DeleteNode(ctx context.Context, nodeName string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/api/v1/nodes/"+url.PathEscape(nodeName), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("%w: deleting node %s responded with %s", ErrUnexpectedResponse, nodeName, resp.Status)
+	}
+}
+
+// do sends a request with an optional JSON body
+func (c *Client) do(ctx context.Context, method, path, contentType string, body any) (*http.Response, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return c.http.Do(req)
+}
+
+// podList is the subset of a Kubernetes PodList used by the client
+type podList struct {
+	Items []podListItem `json:"items"`
+}
+
+// podListItem is the subset of a Kubernetes Pod used by the client
+type podListItem struct {
+	Metadata struct {
+		Name              string            `json:"name"`
+		Namespace         string            `json:"namespace"`
+		Annotations       map[string]string `json:"annotations,omitempty"`
+		DeletionTimestamp *string           `json:"deletionTimestamp,omitempty"`
+		OwnerReferences   []ownerReference  `json:"ownerReferences,omitempty"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+type ownerReference struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// mirrorPodAnnotation is set by the kubelet on the API objects of static pods
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+func (item *podListItem) toPod() Pod {
+	pod := Pod{
+		Namespace:   item.Metadata.Namespace,
+		Name:        item.Metadata.Name,
+		NodeName:    item.Spec.NodeName,
+		Finished:    item.Status.Phase == "Succeeded" || item.Status.Phase == "Failed",
+		Terminating: item.Metadata.DeletionTimestamp != nil,
+	}
+	_, pod.Mirror = item.Metadata.Annotations[mirrorPodAnnotation]
+	for _, owner := range item.Metadata.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			pod.DaemonSet = true
+		}
+	}
+	return pod
+}
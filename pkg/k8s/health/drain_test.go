@@ -0,0 +1,99 @@
+package health_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Pods(t *testing.T) {
+	server, client := newTestClient(t)
+	server.SetPods(
+		health.Pod{Namespace: "default", Name: "app", NodeName: "worker-0"},
+		health.Pod{Namespace: "kube-system", Name: "kube-proxy", NodeName: "worker-0", DaemonSet: true},
+		health.Pod{Namespace: "default", Name: "other", NodeName: "worker-1"},
+	)
+
+	pods, err := client.Pods(context.Background(), "worker-0")
+	require.NoError(t, err)
+	assert.Equal(t, []health.Pod{
+		{Namespace: "default", Name: "app", NodeName: "worker-0"},
+		{Namespace: "kube-system", Name: "kube-proxy", NodeName: "worker-0", DaemonSet: true},
+	}, pods)
+}
+
+func TestClient_Evict_blocked(t *testing.T) {
+	server, client := newTestClient(t)
+	server.SetPods(health.Pod{Namespace: "default", Name: "app", NodeName: "worker-0"})
+	server.BlockEviction("default", "app", 1)
+
+	assert.ErrorIs(t, client.Evict(context.Background(), "default", "app"), health.ErrEvictionBlocked)
+	assert.NoError(t, client.Evict(context.Background(), "default", "app"))
+	assert.Equal(t, []string{"default/app"}, server.Evictions())
+}
+
+func TestClient_Drain(t *testing.T) {
+	tests := []struct {
+		name          string
+		blocked       int
+		timeout       time.Duration
+		wantErr       error
+		wantEvictions []string
+	}{
+		{
+			name:          "evicts all pods except daemon sets and static pods",
+			timeout:       time.Second,
+			wantEvictions: []string{"default/app", "default/job"},
+		},
+		{
+			name:          "retries evictions blocked by a disruption budget",
+			blocked:       2,
+			timeout:       time.Second,
+			wantEvictions: []string{"default/job", "default/app"},
+		},
+		{
+			name:          "times out on a disruption budget",
+			blocked:       1000,
+			timeout:       50 * time.Millisecond,
+			wantErr:       health.ErrDrainTimeout,
+			wantEvictions: []string{"default/job"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestClient(t)
+			server.SetPods(
+				health.Pod{Namespace: "default", Name: "app", NodeName: "worker-0"},
+				health.Pod{Namespace: "default", Name: "job", NodeName: "worker-0"},
+				health.Pod{Namespace: "default", Name: "done", NodeName: "worker-0", Finished: true},
+				health.Pod{Namespace: "kube-system", Name: "kube-proxy", NodeName: "worker-0", DaemonSet: true},
+				health.Pod{Namespace: "kube-system", Name: "kube-apiserver", NodeName: "worker-0", Mirror: true},
+			)
+			server.BlockEviction("default", "app", tt.blocked)
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			err := client.Drain(ctx, "worker-0", 10*time.Millisecond)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.ErrorIs(t, err, health.ErrEvictionBlocked)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, []string{"worker-0"}, server.Cordoned())
+			assert.Equal(t, tt.wantEvictions, server.Evictions())
+		})
+	}
+}
+
+func TestClient_DeleteNode(t *testing.T) {
+	server, client := newTestClient(t)
+
+	require.NoError(t, client.DeleteNode(context.Background(), "worker-0"))
+	assert.Equal(t, []string{"worker-0"}, server.DeletedNodes())
+}
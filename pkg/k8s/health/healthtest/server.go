@@ -0,0 +1,285 @@
+// Package healthtest provides an in-process Kubernetes API server for tests.
+package healthtest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/internal/testcert"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+)
+
+// mirrorPodAnnotation is set by the kubelet on the API objects of static pods
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// object is a JSON object of the Kubernetes API
+type object map[string]any
+
+// Server is an in-process Kubernetes API server for tests.
+// It serves the readyz, node, pod and eviction endpoints used by the Client.
+// Evicted pods are removed immediately, unless their eviction is blocked.
+// Client certificates are required and must be signed by the CA of the server.
+type Server struct {
+	// Config holds the host, the CA certificate and a client certificate accepted by the server
+	Config *health.Config
+	// CAKey is the PEM encoded key of the CA, to issue further client certificates
+	CAKey []byte
+
+	server *httptest.Server
+
+	mu               sync.Mutex
+	ready            bool
+	nodes            func() []health.Node
+	pods             []health.Pod
+	blockedEvictions map[string]int
+	cordoned         []string
+	evictions        []string
+	deletedNodes     []string
+}
+
+// NewServer starts a Server which reports ready and has no nodes
+func NewServer() (*Server, error) {
+	ca, err := testcert.NewCA("kubernetes")
+	if err != nil {
+		return nil, err
+	}
+	serverCertificate, err := ca.IssueServer()
+	if err != nil {
+		return nil, err
+	}
+	clientCertificate, err := ca.IssueClient()
+	if err != nil {
+		return nil, err
+	}
+
+	serverCert, err := tls.X509KeyPair(serverCertificate.CertificatePEM, serverCertificate.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Certificate)
+
+	s := &Server{
+		CAKey:            ca.KeyPEM,
+		ready:            true,
+		nodes:            func() []health.Node { return nil },
+		blockedEvictions: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/api/v1/nodes", s.handleNodes)
+	mux.HandleFunc("/api/v1/nodes/", s.handleNode)
+	mux.HandleFunc("/api/v1/pods", s.handlePods)
+	mux.HandleFunc("/api/v1/namespaces/", s.handleEviction)
+	s.server = httptest.NewUnstartedServer(mux)
+	s.server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+	s.server.StartTLS()
+
+	s.Config = &health.Config{
+		Host:              s.server.URL,
+		CACertificate:     ca.CertificatePEM,
+		ClientCertificate: clientCertificate.CertificatePEM,
+		ClientKey:         clientCertificate.KeyPEM,
+	}
+
+	return s, nil
+}
+
+// SetReady sets whether the readyz endpoint reports ready
+func (s *Server) SetReady(ready bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = ready
+}
+
+// SetNodes sets the nodes returned by the server
+func (s *Server) SetNodes(nodes ...health.Node) {
+	s.SetNodeSource(func() []health.Node { return nodes })
+}
+
+// SetNodeSource sets a function which is called on every node list request,
+// so tests can change the nodes in reaction to other fakes.
+func (s *Server) SetNodeSource(nodes func() []health.Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes = nodes
+}
+
+// SetPods sets the pods returned by the server
+func (s *Server) SetPods(pods ...health.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pods = pods
+}
+
+// BlockEviction makes the next evictions of the pod fail as if a PodDisruptionBudget refused them
+func (s *Server) BlockEviction(namespace, name string, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blockedEvictions[namespace+"/"+name] = times
+}
+
+// Cordoned returns the names of the cordoned nodes
+func (s *Server) Cordoned() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.cordoned...)
+}
+
+// Evictions returns the evicted pods as "namespace/name"
+func (s *Server) Evictions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.evictions...)
+}
+
+// DeletedNodes returns the names of the deleted nodes
+func (s *Server) DeletedNodes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.deletedNodes...)
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ready {
+		http.Error(w, "[-]etcd failed", http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write([]byte("ok"))
+}
+
+func (s *Server) handleNodes(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	source := s.nodes
+	s.mu.Unlock()
+	nodes := source()
+
+	items := []object{}
+	for _, node := range nodes {
+		status := "False"
+		if node.Ready {
+			status = "True"
+		}
+
+		items = append(items, object{
+			"metadata": object{"name": node.Name},
+			"status": object{
+				"addresses":  []object{{"type": "InternalIP", "address": node.InternalIP}},
+				"conditions": []object{{"type": "Ready", "status": status}},
+				"nodeInfo":   object{"kubeletVersion": node.KubeletVersion},
+			},
+		})
+	}
+	list := object{"items": items}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) handleNode(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/nodes/")
+	switch r.Method {
+	case http.MethodPatch:
+		s.cordoned = append(s.cordoned, name)
+	case http.MethodDelete:
+		s.deletedNodes = append(s.deletedNodes, name)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_, _ = w.Write([]byte("{}"))
+}
+
+func (s *Server) handlePods(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodeName := strings.TrimPrefix(r.URL.Query().Get("fieldSelector"), "spec.nodeName=")
+
+	items := []object{}
+	for _, pod := range s.pods {
+		if pod.NodeName != nodeName {
+			continue
+		}
+
+		metadata := object{"name": pod.Name, "namespace": pod.Namespace}
+		if pod.Mirror {
+			metadata["annotations"] = object{mirrorPodAnnotation: "mirror"}
+		}
+		if pod.DaemonSet {
+			metadata["ownerReferences"] = []object{{"kind": "DaemonSet", "name": pod.Name}}
+		}
+		if pod.Terminating {
+			metadata["deletionTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+		}
+
+		phase := "Running"
+		if pod.Finished {
+			phase = "Succeeded"
+		}
+
+		items = append(items, object{
+			"metadata": metadata,
+			"spec":     object{"nodeName": pod.NodeName},
+			"status":   object{"phase": phase},
+		})
+	}
+	list := object{"items": items}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (s *Server) handleEviction(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// /api/v1/namespaces/{namespace}/pods/{name}/eviction
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+	if r.Method != http.MethodPost || len(parts) != 4 || parts[1] != "pods" || parts[3] != "eviction" {
+		http.NotFound(w, r)
+		return
+	}
+	key := parts[0] + "/" + parts[2]
+
+	if s.blockedEvictions[key] > 0 {
+		s.blockedEvictions[key]--
+		http.Error(w, "Cannot evict pod as it would violate the pod's disruption budget.", http.StatusTooManyRequests)
+		return
+	}
+
+	pods := []health.Pod{}
+	for _, pod := range s.pods {
+		if pod.Namespace+"/"+pod.Name != key {
+			pods = append(pods, pod)
+		}
+	}
+	s.pods = pods
+	s.evictions = append(s.evictions, key)
+
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte("{}"))
+}
@@ -0,0 +1,61 @@
+package helm
+
+import (
+	"fmt"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+)
+
+// InlineManifestArgs are the arguments for the NewInlineManifest function
+type InlineManifestArgs struct {
+	RenderArgs
+	// Name is the name of the inline manifest
+	Name string
+	// CreateNamespace adds the namespace of the release to the manifest
+	CreateNamespace bool
+}
+
+// NewInlineManifest renders the chart into an inline manifest of the Talos configuration,
+// which Talos applies when the cluster is bootstrapped.
+func NewInlineManifest(args *InlineManifestArgs) (config.ClusterInlineManifest, error) {
+	manifest, err := Render(&args.RenderArgs)
+	if err != nil {
+		return config.ClusterInlineManifest{}, err
+	}
+
+	if args.CreateNamespace && args.Namespace != "" {
+		manifest = fmt.Sprintf("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: %s\n---\n%s", args.Namespace, manifest)
+	}
+
+	return config.ClusterInlineManifest{
+		Name:     args.Name,
+		Contents: manifest,
+	}, nil
+}
+
+// NewInlineManifestsFromConfig renders the inline charts of the configuration for the Kubernetes version
+func NewInlineManifestsFromConfig(charts []config.InlineChartConfig, kubernetesVersion, cacheDir string) ([]config.ClusterInlineManifest, error) {
+	manifests := make([]config.ClusterInlineManifest, 0, len(charts))
+	for _, chart := range charts {
+		manifest, err := NewInlineManifest(&InlineManifestArgs{
+			RenderArgs: RenderArgs{
+				Chart:             chart.Chart,
+				Repo:              chart.Repo,
+				Version:           chart.Version,
+				ReleaseName:       chart.Name,
+				Namespace:         chart.Namespace,
+				Values:            chart.Values,
+				KubernetesVersion: kubernetesVersion,
+				CacheDir:          cacheDir,
+			},
+			Name:            chart.Name,
+			CreateNamespace: chart.CreateNamespace,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("inline chart %s: %w", chart.Name, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	return manifests, nil
+}
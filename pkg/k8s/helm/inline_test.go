@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestNewInlineManifest(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          *InlineManifestArgs
+		wantNamespace bool
+	}{
+		{
+			name: "release namespace exists",
+			args: &InlineManifestArgs{
+				RenderArgs: RenderArgs{Chart: "testdata/example", Namespace: "kube-system", KubernetesVersion: "1.34.0"},
+				Name:       "example",
+			},
+		},
+		{
+			name: "namespace is created",
+			args: &InlineManifestArgs{
+				RenderArgs:      RenderArgs{Chart: "testdata/example", Namespace: "argocd", KubernetesVersion: "1.34.0"},
+				Name:            "example",
+				CreateNamespace: true,
+			},
+			wantNamespace: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewInlineManifest(tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, "example", got.Name)
+			assert.Contains(t, got.Contents, "message: hello")
+			if tt.wantNamespace {
+				assert.Contains(t, got.Contents, "kind: Namespace\nmetadata:\n  name: argocd\n---\n")
+			} else {
+				assert.NotContains(t, got.Contents, "kind: Namespace")
+			}
+		})
+	}
+}
+
+func TestRender_cachedChart(t *testing.T) {
+	cacheDir := t.TempDir()
+	chrt, err := loader.Load("testdata/example")
+	require.NoError(t, err)
+	_, err = chartutil.Save(chrt, cacheDir)
+	require.NoError(t, err)
+
+	// the repository can not be reached, the chart of the version is taken from the cache
+	got, err := Render(&RenderArgs{
+		Chart:             "example",
+		Repo:              "https://charts.invalid",
+		Version:           "0.1.0",
+		KubernetesVersion: "1.34.0",
+		CacheDir:          cacheDir,
+	})
+	require.NoError(t, err)
+	assert.Contains(t, got, "message: hello")
+
+	_, err = Render(&RenderArgs{
+		Chart:             "example",
+		Repo:              "https://charts.invalid",
+		Version:           "0.2.0",
+		KubernetesVersion: "1.34.0",
+		CacheDir:          cacheDir,
+	})
+	assert.Error(t, err)
+}
+
+func TestNewInlineManifestsFromConfig(t *testing.T) {
+	got, err := NewInlineManifestsFromConfig([]config.InlineChartConfig{
+		{Name: "first", Chart: "testdata/example", Namespace: "kube-system"},
+		{Name: "second", Chart: "testdata/example", Namespace: "monitoring", CreateNamespace: true, Values: map[string]interface{}{"message": "world"}},
+	}, "1.34.0", "")
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "first", got[0].Name)
+	assert.Contains(t, got[0].Contents, "name: first\n  namespace: kube-system")
+	assert.Equal(t, "second", got[1].Name)
+	assert.Contains(t, got[1].Contents, "message: world")
+	assert.Contains(t, got[1].Contents, "kind: Namespace")
+
+	_, err = NewInlineManifestsFromConfig([]config.InlineChartConfig{
+		{Name: "missing", Chart: "./testdata/missing"},
+	}, "1.34.0", "")
+	assert.ErrorContains(t, err, "inline chart missing")
+}
@@ -0,0 +1,137 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// ErrChartRequired indicates that a chart is rendered without a chart name or path
+var ErrChartRequired = errors.New("chart is required")
+
+// RenderArgs are the arguments for the Render function
+type RenderArgs struct {
+	// Chart is the name of the chart in the repository or the path of a local chart
+	Chart string
+	// Repo is the URL of the chart repository, empty for a local chart
+	Repo string
+	// Version of the chart, the latest version is used if empty
+	Version string
+	// ReleaseName is the name of the release, defaults to the name of the chart
+	ReleaseName string
+	// Namespace is the namespace of the release
+	Namespace string
+	// Values are the values of the release
+	Values map[string]interface{}
+	// KubernetesVersion is the Kubernetes version the chart is rendered for, e.g. "1.34.0"
+	KubernetesVersion string
+	// APIVersions are additional API versions available in the cluster, e.g. "gateway.networking.k8s.io/v1"
+	APIVersions []string
+	// CacheDir is the directory of the downloaded charts, defaults to the Helm repository cache
+	CacheDir string
+}
+
+// Render renders the chart like `helm template` without access to a cluster, CRDs and hooks included.
+// Charts of a repository are downloaded into the cache directory once,
+// a cached chart of the requested version is rendered without network access.
+func Render(args *RenderArgs) (string, error) {
+	if args.Chart == "" {
+		return "", ErrChartRequired
+	}
+
+	install := action.NewInstall(&action.Configuration{
+		Log: func(string, ...interface{}) {},
+	})
+	install.DryRun = true
+	install.DryRunOption = "client"
+	install.ClientOnly = true
+	install.Replace = true
+	install.IncludeCRDs = true
+	install.ReleaseName = args.ReleaseName
+	install.Namespace = args.Namespace
+	install.RepoURL = args.Repo
+	install.Version = args.Version
+	install.APIVersions = chartutil.VersionSet(args.APIVersions)
+
+	if args.KubernetesVersion != "" {
+		kubeVersion, err := chartutil.ParseKubeVersion(args.KubernetesVersion)
+		if err != nil {
+			return "", fmt.Errorf("invalid kubernetes version %s: %w", args.KubernetesVersion, err)
+		}
+		install.KubeVersion = kubeVersion
+	}
+
+	chartPath, err := locateChart(install, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to locate chart %s: %w", args.Chart, err)
+	}
+
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load chart %s: %w", args.Chart, err)
+	}
+
+	if install.ReleaseName == "" {
+		install.ReleaseName = chrt.Metadata.Name
+	}
+
+	rel, err := install.Run(chrt, args.Values)
+	if err != nil {
+		return "", fmt.Errorf("failed to render chart %s: %w", args.Chart, err)
+	}
+
+	return manifests(rel), nil
+}
+
+// locateChart returns the path of a local chart, of the cached chart of the requested version,
+// or downloads the chart into the cache directory
+func locateChart(install *action.Install, args *RenderArgs) (string, error) {
+	settings := cli.New()
+	if args.CacheDir != "" {
+		settings.RepositoryCache = args.CacheDir
+	}
+
+	if args.Repo != "" && args.Version != "" {
+		// the downloader stores the archives of the chart versions by their file names in the repository
+		cached := filepath.Join(settings.RepositoryCache, fmt.Sprintf("%s-%s.tgz", args.Chart, args.Version))
+		if _, err := os.Stat(cached); err == nil {
+			return cached, nil
+		}
+	}
+
+	return install.LocateChart(args.Chart, settings)
+}
+
+// manifests joins the manifests and the hooks of the release, test hooks are skipped
+func manifests(rel *release.Release) string {
+	var out strings.Builder
+	out.WriteString(strings.TrimSpace(rel.Manifest))
+	out.WriteString("\n")
+
+	for _, hook := range rel.Hooks {
+		if isTestHook(hook) {
+			continue
+		}
+		fmt.Fprintf(&out, "---\n# Source: %s\n%s\n", hook.Path, strings.TrimSpace(hook.Manifest))
+	}
+
+	return out.String()
+}
+
+// isTestHook returns true if the hook is only run by `helm test`
+func isTestHook(hook *release.Hook) bool {
+	for _, event := range hook.Events {
+		if event == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        *RenderArgs
+		contains    []string
+		notContains []string
+		wantErr     bool
+	}{
+		{
+			name: "local chart with values",
+			args: &RenderArgs{
+				Chart:             "testdata/example",
+				ReleaseName:       "demo",
+				Namespace:         "kube-system",
+				Values:            map[string]interface{}{"message": "world"},
+				KubernetesVersion: "1.34.0",
+			},
+			contains: []string{
+				"name: examples.example.com",
+				"name: demo\n  namespace: kube-system",
+				"message: world",
+				"name: demo-install",
+			},
+			notContains: []string{"demo-test", "gateway:"},
+		},
+		{
+			name: "release name defaults to the chart",
+			args: &RenderArgs{
+				Chart:             "testdata/example",
+				KubernetesVersion: "1.34.0",
+			},
+			contains: []string{"name: example\n", "message: hello"},
+		},
+		{
+			name: "additional api versions",
+			args: &RenderArgs{
+				Chart:             "testdata/example",
+				ReleaseName:       "demo",
+				KubernetesVersion: "1.34.0",
+				APIVersions:       []string{"gateway.networking.k8s.io/v1"},
+			},
+			contains: []string{`gateway: "true"`},
+		},
+		{
+			name: "unsupported kubernetes version",
+			args: &RenderArgs{
+				Chart:             "testdata/example",
+				ReleaseName:       "demo",
+				KubernetesVersion: "1.29.0",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "missing chart",
+			args:    &RenderArgs{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			for _, want := range tt.contains {
+				assert.Contains(t, got, want)
+			}
+			for _, notWant := range tt.notContains {
+				assert.NotContains(t, got, notWant)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package render
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// fileMode is the mode of the rendered files, they are readable by the owner only like a talosconfig
+const fileMode = 0o600
+
+// ReadFiles reads the machine configurations of a previous render in the directory.
+// A directory which does not exist is an empty render.
+func ReadFiles(dir string) (Files, error) {
+	files := Files{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(path, ".yaml") {
+			return nil
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[name] = string(contents)
+
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return Files{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// Write writes the machine configurations to the directory and removes the ones of pools which do not exist anymore
+func (f Files) Write(dir string) error {
+	previous, err := ReadFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for name := range previous {
+		if _, ok := f[name]; ok {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, contents := range f {
+		path := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0o700)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(path, []byte(contents), fileMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Diff returns the unified diff from the previous machine configurations to these, it is empty without changes
+func (f Files) Diff(previous Files) (string, error) {
+	names := map[string]struct{}{}
+	for name := range previous {
+		names[name] = struct{}{}
+	}
+	for name := range f {
+		names[name] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diff strings.Builder
+	for _, name := range sorted {
+		fileDiff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        lines(previous[name]),
+			B:        lines(f[name]),
+			FromFile: "a/" + name,
+			ToFile:   "b/" + name,
+			Context:  3,
+		})
+		if err != nil {
+			return "", err
+		}
+		diff.WriteString(fileDiff)
+	}
+
+	return diff.String(), nil
+}
+
+// lines splits the contents of a file into its lines, keeping the line endings
+func lines(contents string) []string {
+	split := strings.SplitAfter(contents, "\n")
+	if split[len(split)-1] == "" {
+		split = split[:len(split)-1]
+	}
+
+	return split
+}
@@ -0,0 +1,197 @@
+package render
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/compute"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/charts/autoscaler"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/cluster"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/core"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrInvalidStackConfigFile is returned when the stack config file is not named Pulumi.<stack>.yaml
+	ErrInvalidStackConfigFile = errors.New("stack config file must be named Pulumi.<stack>.yaml")
+)
+
+const (
+	// project is the Pulumi project of the rendered stacks, the configuration does not depend on it
+	project = "render"
+	// escHetznerConfigKey is the Hetzner configuration, which stacks usually get from their ESC environment
+	escHetznerConfigKey = "hcloud-k8s-esc:hetzner"
+)
+
+// Files are the rendered machine configurations by their path in the output directory
+type Files map[string]string
+
+// mocks is the resource monitor of the rendering context, which never creates a resource
+type mocks int
+
+func (mocks) NewResource(args pulumi.MockResourceArgs) (string, resource.PropertyMap, error) {
+	return args.Name + "_id", args.Inputs, nil
+}
+
+func (mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
+	return args.Args, nil
+}
+
+// LoadStackConfig loads the configuration of a stack config file with the validations of a deployment.
+// Secure values can not be decrypted offline and are replaced by core.RedactedValue.
+// The Hetzner token is not part of a machine configuration, a placeholder stands in for the token of the ESC environment.
+func LoadStackConfig(path string) (*config.PulumiConfig, error) {
+	stack, found := strings.CutPrefix(filepath.Base(path), "Pulumi.")
+	stack, isYAML := strings.CutSuffix(stack, ".yaml")
+	if !found || !isYAML || stack == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStackConfigFile, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	stackConfig := struct {
+		Config map[string]interface{} `yaml:"config"`
+	}{}
+	err = yaml.Unmarshal(data, &stackConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	values := map[string]string{
+		escHetznerConfigKey: fmt.Sprintf(`{"token":%q}`, core.RedactedValue),
+	}
+	for key, value := range stackConfig.Config {
+		value = redactSecureValues(value)
+		if str, ok := value.(string); ok {
+			values[key] = str
+			continue
+		}
+
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode config %s: %w", key, err)
+		}
+		values[key] = string(encoded)
+	}
+
+	ctx, err := pulumi.NewContext(context.Background(), pulumi.RunInfo{
+		Project: project,
+		Stack:   stack,
+		Config:  values,
+		Mocks:   mocks(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return config.LoadConfig(ctx)
+}
+
+// redactSecureValues replaces the encrypted secure values of a config value by core.RedactedValue
+func redactSecureValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, ok := v["secure"]; ok && len(v) == 1 {
+			return core.RedactedValue
+		}
+		for key, item := range v {
+			v[key] = redactSecureValues(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactSecureValues(item)
+		}
+	}
+
+	return value
+}
+
+// MachineConfigurations renders the validated machine configurations of all control plane, worker and autoscaler pools.
+// Every pool has the configuration its nodes are created with (<pool>.bootstrap.yaml) and the one applied to them (<pool>.yaml).
+func MachineConfigurations(cfg *config.PulumiConfig) (Files, error) {
+	validator, err := core.NewMachineConfigurationValidator(cfg.Talos.ImageVersion, cfg.Talos.KubernetesVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	inlineManifests, extraManifests, err := compute.BootstrapManifests(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	files := Files{}
+	for _, pool := range cfg.ControlPlane.NodePools {
+		name := compute.ControlPlanePoolName(&pool)
+		configurations, err := compute.ControlPlaneNodeConfigurations(cfg, &pool, inlineManifests, extraManifests)
+		if err != nil {
+			return nil, err
+		}
+
+		err = files.add(validator, meta.ControlPlaneNode, filepath.Join("controlplane", name), configurations.Bootstrap, configurations.Applied)
+		if err != nil {
+			return nil, fmt.Errorf("control plane pool %s: %w", name, err)
+		}
+	}
+
+	for _, pool := range cfg.NodePools.NodePools {
+		configurations, err := compute.WorkerNodeConfigurations(cfg, &pool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = files.add(validator, meta.WorkerNode, filepath.Join("worker", pool.Name), configurations.Bootstrap, configurations.Applied)
+		if err != nil {
+			return nil, fmt.Errorf("node pool %s: %w", pool.Name, err)
+		}
+	}
+
+	autoscalerArgs := cluster.NewAutoscalerConfigurationArgs(&cluster.ApplicationsArgs{Cfg: cfg})
+	for _, pool := range cfg.NodePools.NodePools {
+		if pool.AutoScaler == nil {
+			continue
+		}
+
+		configuration, err := autoscaler.NodeConfiguration(autoscalerArgs, &pool)
+		if err != nil {
+			return nil, err
+		}
+
+		// the autoscaler creates the nodes with their final configuration
+		err = files.add(validator, meta.WorkerNode, filepath.Join("autoscaler", pool.Name), configuration)
+		if err != nil {
+			return nil, fmt.Errorf("autoscaler pool %s: %w", pool.Name, err)
+		}
+	}
+
+	return files, nil
+}
+
+// add renders the configurations of a pool, the bootstrap configuration is only added if the pool has one
+func (f Files) add(validator *core.MachineConfigurationValidator, nodeType meta.ServerNodeType, name string, configurations ...[]string) error {
+	names := []string{name + ".yaml"}
+	if len(configurations) > 1 {
+		names = []string{name + ".bootstrap.yaml", name + ".yaml"}
+	}
+
+	for i, configuration := range configurations {
+		rendered, err := validator.Render(nodeType, configuration)
+		if err != nil {
+			return err
+		}
+		f[names[i]] = rendered
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadStackConfig(t *testing.T) {
+	cfg, err := LoadStackConfig("testdata/Pulumi.test.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.11.3", cfg.Talos.ImageVersion)
+	assert.Len(t, cfg.NodePools.NodePools, 1)
+	assert.Equal(t, core.RedactedValue, cfg.Kubernetes.HCloudToken)
+	assert.Equal(t, core.RedactedValue, cfg.Hetzner.Token)
+
+	_, err = LoadStackConfig("testdata/stack.yaml")
+	assert.ErrorIs(t, err, ErrInvalidStackConfigFile)
+}
+
+func TestMachineConfigurations(t *testing.T) {
+	cfg, err := LoadStackConfig("testdata/Pulumi.test.yaml")
+	require.NoError(t, err)
+
+	files, err := MachineConfigurations(cfg)
+	require.NoError(t, err)
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{
+		"controlplane/controlplane-hel1-cx23.bootstrap.yaml",
+		"controlplane/controlplane-hel1-cx23.yaml",
+		"worker/worker.bootstrap.yaml",
+		"worker/worker.yaml",
+		"autoscaler/worker.yaml",
+	}, names)
+	assert.Contains(t, files["worker/worker.yaml"], "net.core.somaxconn: \"65535\"")
+	assert.Contains(t, files["controlplane/controlplane-hel1-cx23.yaml"], "type: controlplane")
+	assert.Contains(t, files["autoscaler/worker.yaml"], "kind: SwapVolumeConfig")
+	assert.Contains(t, files["autoscaler/worker.yaml"], "swapBehavior: LimitedSwap")
+
+	cfg.Talos.ConfigPatches = []string{"machine:\n  kubelett: {}\n"}
+	_, err = MachineConfigurations(cfg)
+	assert.ErrorIs(t, err, core.ErrInvalidMachineConfiguration)
+	assert.ErrorContains(t, err, "control plane pool controlplane-hel1-cx23")
+}
+
+func TestFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "render")
+
+	previous, err := ReadFiles(dir)
+	require.NoError(t, err)
+	assert.Empty(t, previous)
+
+	err = Files{"worker/old.yaml": "old\n", "worker/worker.yaml": "a\nb\n"}.Write(dir)
+	require.NoError(t, err)
+
+	files := Files{"worker/worker.yaml": "a\nc\n"}
+	err = files.Write(dir)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "worker", "old.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	previous, err = ReadFiles(dir)
+	require.NoError(t, err)
+	assert.Equal(t, files, previous)
+
+	diff, err := files.Diff(previous)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	diff, err = Files{"worker/worker.yaml": "a\nb\n", "worker/new.yaml": "new\n"}.Diff(previous)
+	require.NoError(t, err)
+	assert.Equal(t, "--- a/worker/new.yaml\n+++ b/worker/new.yaml\n@@ -0,0 +1 @@\n+new\n"+
+		"--- a/worker/worker.yaml\n+++ b/worker/worker.yaml\n@@ -1,2 +1,2 @@\n a\n-c\n+b\n", diff)
+}
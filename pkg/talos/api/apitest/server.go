@@ -0,0 +1,336 @@
+// Package apitest provides an in-process Talos API server for tests.
+package apitest
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+
+	cosi "github.com/cosi-project/runtime/api/v1alpha1"
+	"github.com/exivity/pulumi-hcloud-k8s/internal/testcert"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api"
+	"github.com/siderolabs/talos/pkg/machinery/api/common"
+	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	configpb "github.com/siderolabs/talos/pkg/machinery/api/resource/config"
+	configresource "github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Server is an in-process Talos API server for tests.
+// It serves the Version, Upgrade, Reset, ApplyConfiguration and EtcdLeaveCluster calls over mutual TLS and records all requests.
+// The running machine configuration of a node is served as MachineConfig resource of the COSI state API.
+// An upgrade immediately switches the node to the version tag of the installer image,
+// an applied configuration immediately becomes the running configuration of the node.
+type Server struct {
+	machine.UnimplementedMachineServiceServer
+
+	// ClientConfig holds the endpoint and the credentials accepted by the server
+	ClientConfig *api.ClientConfig
+
+	server *grpc.Server
+
+	mu             sync.Mutex
+	defaultVersion string
+	versions       map[string]string
+	configurations map[string]string
+	rebootRequired map[string]bool
+	failures       map[string]error
+	upgrades       []UpgradeRequest
+	resets         []ResetRequest
+	applies        []ApplyRequest
+	etcdLeaves     []string
+}
+
+// UpgradeRequest is an upgrade request received by the Server
+type UpgradeRequest struct {
+	Node     string
+	Image    string
+	Preserve bool
+}
+
+// ResetRequest is a reset request received by the Server
+type ResetRequest struct {
+	Node     string
+	Graceful bool
+}
+
+// ApplyRequest is a configuration apply request received by the Server
+type ApplyRequest struct {
+	Node          string
+	Configuration string
+	Mode          api.ApplyMode
+}
+
+// NewServer starts a Server on a random local port.
+// All nodes initially run the given Talos version.
+func NewServer(version string) (*Server, error) {
+	ca, err := testcert.NewCA("talos")
+	if err != nil {
+		return nil, err
+	}
+	serverCertificate, err := ca.IssueServer()
+	if err != nil {
+		return nil, err
+	}
+	clientCertificate, err := ca.IssueClient()
+	if err != nil {
+		return nil, err
+	}
+
+	serverCert, err := tls.X509KeyPair(serverCertificate.CertificatePEM, serverCertificate.KeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Certificate)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ClientConfig: &api.ClientConfig{
+			Endpoints:         []string{listener.Addr().String()},
+			CACertificate:     base64.StdEncoding.EncodeToString(ca.CertificatePEM),
+			ClientCertificate: base64.StdEncoding.EncodeToString(clientCertificate.CertificatePEM),
+			ClientKey:         base64.StdEncoding.EncodeToString(clientCertificate.KeyPEM),
+		},
+		defaultVersion: version,
+		versions:       map[string]string{},
+		configurations: map[string]string{},
+		rebootRequired: map[string]bool{},
+		failures:       map[string]error{},
+	}
+
+	s.server = grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientCAs:    clientCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		})),
+	)
+	machine.RegisterMachineServiceServer(s.server, s)
+	cosi.RegisterStateServer(s.server, &stateServer{server: s})
+
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+
+	return s, nil
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.server.Stop()
+}
+
+// SetVersion sets the Talos version running on the node
+func (s *Server) SetVersion(node, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[node] = version
+}
+
+// SetMachineConfiguration sets the machine configuration the node is running with
+func (s *Server) SetMachineConfiguration(node, configuration string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configurations[node] = configuration
+}
+
+// SetRebootRequired makes configuration applies to the node require a reboot,
+// applies with ApplyModeNoReboot are rejected like Talos does it
+func (s *Server) SetRebootRequired(node string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rebootRequired[node] = true
+}
+
+// SetFailure makes all requests for the node fail with the given error.
+// Use a gRPC status error to simulate a specific status code.
+func (s *Server) SetFailure(node string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[node] = err
+}
+
+// Upgrades returns all upgrade requests received by the server
+func (s *Server) Upgrades() []UpgradeRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]UpgradeRequest{}, s.upgrades...)
+}
+
+// Applies returns all configuration apply requests received by the server
+func (s *Server) Applies() []ApplyRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ApplyRequest{}, s.applies...)
+}
+
+// Resets returns all reset requests received by the server
+func (s *Server) Resets() []ResetRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ResetRequest{}, s.resets...)
+}
+
+// EtcdLeaves returns the nodes which left the etcd cluster
+func (s *Server) EtcdLeaves() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.etcdLeaves...)
+}
+
+// Version returns the Talos version of the node
+func (s *Server) Version(ctx context.Context, _ *emptypb.Empty) (*machine.VersionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node := targetNode(ctx)
+	if err := s.failures[node]; err != nil {
+		return nil, err
+	}
+
+	tag, ok := s.versions[node]
+	if !ok {
+		tag = s.defaultVersion
+	}
+
+	return &machine.VersionResponse{
+		Messages: []*machine.Version{{
+			Metadata: &common.Metadata{Hostname: node},
+			Version:  &machine.VersionInfo{Tag: tag, Arch: "amd64"},
+		}},
+	}, nil
+}
+
+// Upgrade records the upgrade and switches the node to the version tag of the installer image
+func (s *Server) Upgrade(ctx context.Context, req *machine.UpgradeRequest) (*machine.UpgradeResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node := targetNode(ctx)
+	if err := s.failures[node]; err != nil {
+		return nil, err
+	}
+
+	s.upgrades = append(s.upgrades, UpgradeRequest{Node: node, Image: req.GetImage(), Preserve: req.GetPreserve()})
+	if i := strings.LastIndex(req.GetImage(), ":"); i >= 0 {
+		s.versions[node] = req.GetImage()[i+1:]
+	}
+
+	return &machine.UpgradeResponse{Messages: []*machine.Upgrade{{Metadata: &common.Metadata{Hostname: node}}}}, nil
+}
+
+// Reset records the reset
+func (s *Server) Reset(ctx context.Context, req *machine.ResetRequest) (*machine.ResetResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node := targetNode(ctx)
+	if err := s.failures[node]; err != nil {
+		return nil, err
+	}
+
+	s.resets = append(s.resets, ResetRequest{Node: node, Graceful: req.GetGraceful()})
+
+	return &machine.ResetResponse{Messages: []*machine.Reset{{Metadata: &common.Metadata{Hostname: node}}}}, nil
+}
+
+// ApplyConfiguration records the configuration apply
+func (s *Server) ApplyConfiguration(ctx context.Context, req *machine.ApplyConfigurationRequest) (*machine.ApplyConfigurationResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node := targetNode(ctx)
+	if err := s.failures[node]; err != nil {
+		return nil, err
+	}
+
+	if s.rebootRequired[node] && req.GetMode() == api.ApplyModeNoReboot {
+		return nil, status.Error(codes.FailedPrecondition, "apply configuration: configuration change requires a reboot")
+	}
+
+	s.applies = append(s.applies, ApplyRequest{Node: node, Configuration: string(req.GetData()), Mode: req.GetMode()})
+	s.configurations[node] = string(req.GetData())
+
+	return &machine.ApplyConfigurationResponse{Messages: []*machine.ApplyConfiguration{{Metadata: &common.Metadata{Hostname: node}}}}, nil
+}
+
+// EtcdLeaveCluster records that the node left etcd
+func (s *Server) EtcdLeaveCluster(ctx context.Context, _ *machine.EtcdLeaveClusterRequest) (*machine.EtcdLeaveClusterResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	node := targetNode(ctx)
+	if err := s.failures[node]; err != nil {
+		return nil, err
+	}
+
+	s.etcdLeaves = append(s.etcdLeaves, node)
+
+	return &machine.EtcdLeaveClusterResponse{Messages: []*machine.EtcdLeaveCluster{{Metadata: &common.Metadata{Hostname: node}}}}, nil
+}
+
+// stateServer serves the running machine configurations of the Server.
+// It is a separate type because the state and machine services both have a List method.
+type stateServer struct {
+	cosi.UnimplementedStateServer
+
+	server *Server
+}
+
+// Get returns the MachineConfig resource of the node
+func (s *stateServer) Get(ctx context.Context, req *cosi.GetRequest) (*cosi.GetResponse, error) {
+	s.server.mu.Lock()
+	defer s.server.mu.Unlock()
+
+	node := targetNode(ctx)
+	if err := s.server.failures[node]; err != nil {
+		return nil, err
+	}
+
+	configuration, ok := s.server.configurations[node]
+	if req.GetType() != configresource.MachineConfigType || req.GetId() != configresource.ActiveID || !ok {
+		return nil, status.Errorf(codes.NotFound, "resource %s %s doesn't exist", req.GetType(), req.GetId())
+	}
+
+	spec, err := proto.Marshal(&configpb.MachineConfigSpec{YamlMarshalled: []byte(configuration)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cosi.GetResponse{
+		Resource: &cosi.Resource{
+			Metadata: &cosi.Metadata{Namespace: req.GetNamespace(), Type: req.GetType(), Id: req.GetId()},
+			Spec:     &cosi.Spec{ProtoSpec: spec},
+		},
+	}, nil
+}
+
+// targetNode returns the node a request is proxied to, as set by the client in the "node" metadata
+func targetNode(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if nodes := md.Get("node"); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return ""
+}
+
+// Unavailable returns a gRPC error which simulates an unreachable node
+func Unavailable() error {
+	return status.Error(codes.Unavailable, "connection refused")
+}
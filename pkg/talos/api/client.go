@@ -0,0 +1,354 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	cosi "github.com/cosi-project/runtime/api/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/api/common"
+	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	configpb "github.com/siderolabs/talos/pkg/machinery/api/resource/config"
+	configresource "github.com/siderolabs/talos/pkg/machinery/resources/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// DefaultPort is the port of the Talos API (apid)
+const DefaultPort = "50000"
+
+// ApplyMode is the mode of a configuration apply
+type ApplyMode = machine.ApplyConfigurationRequest_Mode
+
+const (
+	// ApplyModeReboot applies the configuration and reboots the node
+	ApplyModeReboot = machine.ApplyConfigurationRequest_REBOOT
+	// ApplyModeAuto applies the configuration without reboot if possible
+	ApplyModeAuto = machine.ApplyConfigurationRequest_AUTO
+	// ApplyModeNoReboot applies the configuration without reboot, it fails if a reboot is required
+	ApplyModeNoReboot = machine.ApplyConfigurationRequest_NO_REBOOT
+)
+
+var (
+	// ErrInvalidClientConfig is returned when the Talos client configuration is incomplete or can not be parsed
+	ErrInvalidClientConfig = errors.New("invalid Talos client configuration")
+	// ErrNodeUnavailable is returned when the Talos API of a node can not be reached
+	ErrNodeUnavailable = errors.New("talos API unavailable")
+	// ErrPermissionDenied is returned when the client certificate is rejected by the Talos API
+	ErrPermissionDenied = errors.New("talos API permission denied")
+	// ErrNodeFailed is returned when a node reports an error for a request
+	ErrNodeFailed = errors.New("node reported an error")
+	// ErrEmptyResponse is returned when the Talos API answered without any message
+	ErrEmptyResponse = errors.New("empty Talos API response")
+	// ErrVersionMismatch is returned when a node did not reach the expected Talos version in time
+	ErrVersionMismatch = errors.New("node is not running the expected Talos version")
+)
+
+// NodeError is returned by all operations of the Client.
+// It records the node and the operation which failed and wraps one of the errors of this package.
+type NodeError struct {
+	// Operation is the Talos API operation, e.g. "upgrade"
+	Operation string
+	// Node is the address of the target node
+	Node string
+	// Code is the gRPC status code, codes.OK if the request itself succeeded
+	Code codes.Code
+	// Err is the cause of the failure
+	Err error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("talos %s on node %s failed: %s", e.Operation, e.Node, e.Err)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// ClientConfig holds the credentials and endpoints of a Talos client.
+// The certificates are base64 encoded PEM, as found in a talosconfig.
+type ClientConfig struct {
+	// Endpoints are the Talos API endpoints, usually the control plane nodes. Requests are proxied to the target node.
+	Endpoints []string
+	// CACertificate is the Talos CA certificate
+	CACertificate string
+	// ClientCertificate is the client certificate
+	ClientCertificate string
+	// ClientKey is the client private key
+	ClientKey string
+}
+
+// Client talks to the Talos machinery API.
+// Credentials are only held in memory, nothing is written to disk.
+type Client struct {
+	conns []*grpc.ClientConn
+}
+
+// responseMessage is a per node message of a Talos API response
+type responseMessage interface {
+	GetMetadata() *common.Metadata
+}
+
+// NewClient creates a Talos API client for the given configuration.
+// Connections are established lazily on the first request.
+func NewClient(cfg *ClientConfig) (*Client, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, fmt.Errorf("%w: no endpoints", ErrInvalidClientConfig)
+	}
+
+	tlsConfig, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{}
+	for _, endpoint := range cfg.Endpoints {
+		conn, err := grpc.NewClient(endpointAddress(endpoint),
+			grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		)
+		if err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("%w: %w", ErrInvalidClientConfig, err)
+		}
+		client.conns = append(client.conns, conn)
+	}
+
+	return client, nil
+}
+
+// Close closes all connections of the client
+func (c *Client) Close() error {
+	var errs []error
+	for _, conn := range c.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Version returns the Talos version running on the node
+func (c *Client) Version(ctx context.Context, node string) (*machine.VersionInfo, error) {
+	var resp *machine.VersionResponse
+	err := c.invoke(ctx, node, "version", func(ctx context.Context, client machine.MachineServiceClient) (err error) {
+		resp, err = client.Version(ctx, &emptypb.Empty{})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.GetMessages()) == 0 {
+		return nil, &NodeError{Operation: "version", Node: node, Err: ErrEmptyResponse}
+	}
+	if err := checkMessages("version", node, resp.GetMessages()); err != nil {
+		return nil, err
+	}
+
+	return resp.GetMessages()[0].GetVersion(), nil
+}
+
+// Upgrade starts the upgrade of the node to the given installer image.
+// With preserve set, the ephemeral data of the node is kept during the upgrade.
+// The node reboots after the call returns, use WaitForVersion to wait for the upgrade to finish.
+func (c *Client) Upgrade(ctx context.Context, node, image string, preserve bool) error {
+	var resp *machine.UpgradeResponse
+	err := c.invoke(ctx, node, "upgrade", func(ctx context.Context, client machine.MachineServiceClient) (err error) {
+		resp, err = client.Upgrade(ctx, &machine.UpgradeRequest{Image: image, Preserve: preserve})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return checkMessages("upgrade", node, resp.GetMessages())
+}
+
+// Reset wipes the node and shuts it down.
+// With graceful set, the node leaves etcd and cordons and drains itself before the reset.
+func (c *Client) Reset(ctx context.Context, node string, graceful bool) error {
+	var resp *machine.ResetResponse
+	err := c.invoke(ctx, node, "reset", func(ctx context.Context, client machine.MachineServiceClient) (err error) {
+		resp, err = client.Reset(ctx, &machine.ResetRequest{Graceful: graceful})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return checkMessages("reset", node, resp.GetMessages())
+}
+
+// EtcdLeaveCluster removes the control plane node from the etcd cluster and stops etcd on it
+func (c *Client) EtcdLeaveCluster(ctx context.Context, node string) error {
+	var resp *machine.EtcdLeaveClusterResponse
+	err := c.invoke(ctx, node, "etcd leave", func(ctx context.Context, client machine.MachineServiceClient) (err error) {
+		resp, err = client.EtcdLeaveCluster(ctx, &machine.EtcdLeaveClusterRequest{})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return checkMessages("etcd leave", node, resp.GetMessages())
+}
+
+// ApplyConfiguration applies the machine configuration to the node
+func (c *Client) ApplyConfiguration(ctx context.Context, node string, configuration []byte, mode ApplyMode) error {
+	var resp *machine.ApplyConfigurationResponse
+	err := c.invoke(ctx, node, "apply configuration", func(ctx context.Context, client machine.MachineServiceClient) (err error) {
+		resp, err = client.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{Data: configuration, Mode: mode})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return checkMessages("apply configuration", node, resp.GetMessages())
+}
+
+// MachineConfiguration returns the machine configuration the node is running with, as YAML.
+// It is read from the MachineConfig resource of the node, like `talosctl get machineconfig` does it.
+func (c *Client) MachineConfiguration(ctx context.Context, node string) ([]byte, error) {
+	var resp *cosi.GetResponse
+	err := c.invokeConn(ctx, node, "get machine configuration", func(ctx context.Context, conn grpc.ClientConnInterface) (err error) {
+		resp, err = cosi.NewStateClient(conn).Get(ctx, &cosi.GetRequest{
+			Namespace: configresource.NamespaceName,
+			Type:      configresource.MachineConfigType,
+			Id:        configresource.ActiveID,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &configpb.MachineConfigSpec{}
+	if err := proto.Unmarshal(resp.GetResource().GetSpec().GetProtoSpec(), spec); err != nil {
+		return nil, &NodeError{Operation: "get machine configuration", Node: node, Err: fmt.Errorf("%w: %w", ErrNodeFailed, err)}
+	}
+	if len(spec.GetYamlMarshalled()) == 0 {
+		return nil, &NodeError{Operation: "get machine configuration", Node: node, Err: ErrEmptyResponse}
+	}
+
+	return spec.GetYamlMarshalled(), nil
+}
+
+// WaitForVersion polls the node until it runs the expected Talos version or the context is done.
+// Errors while the node is rebooting are expected and ignored.
+func (c *Client) WaitForVersion(ctx context.Context, node, tag string, interval time.Duration) error {
+	var lastErr error
+	for {
+		v, err := c.Version(ctx, node)
+		switch {
+		case err == nil && v.Tag == tag:
+			return nil
+		case err == nil:
+			lastErr = fmt.Errorf("%w: running %s, expected %s", ErrVersionMismatch, v.Tag, tag)
+		default:
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			return &NodeError{Operation: "wait for version", Node: node, Code: codes.DeadlineExceeded, Err: errors.Join(ErrVersionMismatch, lastErr)}
+		case <-time.After(interval):
+		}
+	}
+}
+
+// invoke sends the machine service request to the node through the first endpoint which is reachable
+func (c *Client) invoke(ctx context.Context, node, operation string, call func(context.Context, machine.MachineServiceClient) error) error {
+	return c.invokeConn(ctx, node, operation, func(ctx context.Context, conn grpc.ClientConnInterface) error {
+		return call(ctx, machine.NewMachineServiceClient(conn))
+	})
+}
+
+// invokeConn sends the request to the node through the first endpoint which is reachable
+func (c *Client) invokeConn(ctx context.Context, node, operation string, call func(context.Context, grpc.ClientConnInterface) error) error {
+	ctx = metadata.AppendToOutgoingContext(ctx, "node", node)
+
+	var err error
+	for _, conn := range c.conns {
+		err = call(ctx, conn)
+		if err == nil {
+			return nil
+		}
+		if status.Code(err) != codes.Unavailable {
+			break
+		}
+	}
+
+	return toNodeError(operation, node, err)
+}
+
+// toNodeError converts a gRPC error into a NodeError wrapping the matching error of this package
+func toNodeError(operation, node string, err error) *NodeError {
+	st, _ := status.FromError(err)
+
+	var cause error
+	switch st.Code() { //nolint:exhaustive // all other codes are reported as node failure
+	case codes.Unavailable, codes.DeadlineExceeded:
+		cause = fmt.Errorf("%w: %s", ErrNodeUnavailable, st.Message())
+	case codes.PermissionDenied, codes.Unauthenticated:
+		cause = fmt.Errorf("%w: %s", ErrPermissionDenied, st.Message())
+	default:
+		cause = fmt.Errorf("%w: %s", ErrNodeFailed, st.Message())
+	}
+
+	return &NodeError{Operation: operation, Node: node, Code: st.Code(), Err: cause}
+}
+
+// checkMessages returns an error if any node reported an error in its response metadata
+func checkMessages[T responseMessage](operation, node string, messages []T) error {
+	for _, msg := range messages {
+		if nodeErr := msg.GetMetadata().GetError(); nodeErr != "" {
+			return &NodeError{Operation: operation, Node: node, Err: fmt.Errorf("%w: %s", ErrNodeFailed, nodeErr)}
+		}
+	}
+	return nil
+}
+
+// tlsConfig builds the mutual TLS configuration of the client
+func (cfg *ClientConfig) tlsConfig() (*tls.Config, error) {
+	caPEM, err := base64.StdEncoding.DecodeString(cfg.CACertificate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: CA certificate: %w", ErrInvalidClientConfig, err)
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(cfg.ClientCertificate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: client certificate: %w", ErrInvalidClientConfig, err)
+	}
+	keyPEM, err := base64.StdEncoding.DecodeString(cfg.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: client key: %w", ErrInvalidClientConfig, err)
+	}
+
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("%w: no CA certificate found", ErrInvalidClientConfig)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidClientConfig, err)
+	}
+
+	return &tls.Config{
+		RootCAs:      rootCAs,
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// endpointAddress adds the default Talos API port to an endpoint without port
+func endpointAddress(endpoint string) string {
+	if _, _, err := net.SplitHostPort(endpoint); err == nil {
+		return endpoint
+	}
+	return net.JoinHostPort(endpoint, DefaultPort)
+}
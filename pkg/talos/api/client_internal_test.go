@@ -0,0 +1,13 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_endpointAddress(t *testing.T) {
+	assert.Equal(t, "1.2.3.4:50000", endpointAddress("1.2.3.4"))
+	assert.Equal(t, "1.2.3.4:1234", endpointAddress("1.2.3.4:1234"))
+	assert.Equal(t, "[2001:db8::1]:50000", endpointAddress("2001:db8::1"))
+}
@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api/apitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestClient(t *testing.T, version string) (*apitest.Server, *api.Client) {
+	t.Helper()
+
+	server, err := apitest.NewServer(version)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	client, err := api.NewClient(server.ClientConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+
+	return server, client
+}
+
+func TestClient_Version(t *testing.T) {
+	server, client := newTestClient(t, "v1.10.0")
+	server.SetVersion("10.0.1.2", "v1.11.3")
+
+	got, err := client.Version(context.Background(), "10.0.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.10.0", got.Tag)
+	assert.Equal(t, "amd64", got.Arch)
+
+	got, err = client.Version(context.Background(), "10.0.1.2")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.11.3", got.Tag)
+}
+
+func TestClient_Upgrade(t *testing.T) {
+	server, client := newTestClient(t, "v1.10.0")
+
+	err := client.Upgrade(context.Background(), "10.0.1.1", "factory.talos.dev/installer/abc:v1.11.3", true)
+	require.NoError(t, err)
+
+	assert.Equal(t, []apitest.UpgradeRequest{
+		{Node: "10.0.1.1", Image: "factory.talos.dev/installer/abc:v1.11.3", Preserve: true},
+	}, server.Upgrades())
+
+	err = client.WaitForVersion(context.Background(), "10.0.1.1", "v1.11.3", time.Millisecond)
+	assert.NoError(t, err)
+}
+
+func TestClient_Reset(t *testing.T) {
+	server, client := newTestClient(t, "v1.10.0")
+
+	err := client.Reset(context.Background(), "10.0.1.1", true)
+	require.NoError(t, err)
+
+	assert.Equal(t, []apitest.ResetRequest{{Node: "10.0.1.1", Graceful: true}}, server.Resets())
+}
+
+func TestClient_EtcdLeaveCluster(t *testing.T) {
+	server, client := newTestClient(t, "v1.10.0")
+
+	err := client.EtcdLeaveCluster(context.Background(), "10.0.1.1")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"10.0.1.1"}, server.EtcdLeaves())
+}
+
+func TestClient_ApplyConfiguration(t *testing.T) {
+	server, client := newTestClient(t, "v1.10.0")
+
+	err := client.ApplyConfiguration(context.Background(), "10.0.1.1", []byte("version: v1alpha1"), api.ApplyModeAuto)
+	require.NoError(t, err)
+
+	assert.Equal(t, []apitest.ApplyRequest{{Node: "10.0.1.1", Configuration: "version: v1alpha1", Mode: api.ApplyModeAuto}}, server.Applies())
+}
+
+func TestClient_MachineConfiguration(t *testing.T) {
+	server, client := newTestClient(t, "v1.10.0")
+	server.SetMachineConfiguration("10.0.1.1", "version: v1alpha1")
+
+	configuration, err := client.MachineConfiguration(context.Background(), "10.0.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "version: v1alpha1", string(configuration))
+
+	_, err = client.MachineConfiguration(context.Background(), "10.0.1.2")
+	var nodeErr *api.NodeError
+	require.ErrorAs(t, err, &nodeErr)
+	assert.Equal(t, codes.NotFound, nodeErr.Code)
+	assert.ErrorIs(t, err, api.ErrNodeFailed)
+}
+
+func TestClient_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		failure  error
+		wantErr  error
+		wantCode codes.Code
+	}{
+		{
+			name:     "unavailable",
+			failure:  apitest.Unavailable(),
+			wantErr:  api.ErrNodeUnavailable,
+			wantCode: codes.Unavailable,
+		},
+		{
+			name:     "permission denied",
+			failure:  status.Error(codes.PermissionDenied, "not allowed"),
+			wantErr:  api.ErrPermissionDenied,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "internal",
+			failure:  status.Error(codes.Internal, "boom"),
+			wantErr:  api.ErrNodeFailed,
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestClient(t, "v1.10.0")
+			server.SetFailure("10.0.1.1", tt.failure)
+
+			err := client.Upgrade(context.Background(), "10.0.1.1", "installer:v1.11.3", true)
+
+			var nodeErr *api.NodeError
+			require.True(t, errors.As(err, &nodeErr))
+			assert.Equal(t, "upgrade", nodeErr.Operation)
+			assert.Equal(t, "10.0.1.1", nodeErr.Node)
+			assert.Equal(t, tt.wantCode, nodeErr.Code)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Empty(t, server.Upgrades())
+		})
+	}
+}
+
+func TestClient_WaitForVersion_timeout(t *testing.T) {
+	_, client := newTestClient(t, "v1.10.0")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := client.WaitForVersion(ctx, "10.0.1.1", "v1.11.3", 10*time.Millisecond)
+	assert.ErrorIs(t, err, api.ErrVersionMismatch)
+}
+
+func TestNewClient_invalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *api.ClientConfig
+	}{
+		{
+			name: "no endpoints",
+			cfg:  &api.ClientConfig{},
+		},
+		{
+			name: "invalid certificates",
+			cfg: &api.ClientConfig{
+				Endpoints:         []string{"127.0.0.1"},
+				CACertificate:     "not-base64!",
+				ClientCertificate: "",
+				ClientKey:         "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := api.NewClient(tt.cfg)
+			assert.ErrorIs(t, err, api.ErrInvalidClientConfig)
+		})
+	}
+}
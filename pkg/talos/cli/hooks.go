@@ -0,0 +1,502 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+var (
+	// ErrClientConfigUnavailable is returned when the Talos client configuration did not resolve in time
+	ErrClientConfigUnavailable = errors.New("talos client configuration unavailable")
+	// ErrMissingHookInput is returned when a resource hook is triggered for a resource without the expected inputs
+	ErrMissingHookInput = errors.New("missing resource hook input")
+)
+
+const (
+	// defaultUpgradeTimeout is the maximum duration of a single node upgrade, including the reboot
+	defaultUpgradeTimeout = 10 * time.Minute
+	// resetTimeout is the maximum duration of a reset request
+	resetTimeout = 2 * time.Minute
+	// defaultDrainTimeout is the maximum duration to drain a node before it is reset
+	defaultDrainTimeout = 5 * time.Minute
+	// drainPollInterval is the pause between two eviction rounds while a node is drained
+	drainPollInterval = 5 * time.Second
+	// clientConfigTimeout is the maximum wait for the Talos client configuration when a hook is triggered
+	clientConfigTimeout = 5 * time.Minute
+	// upgradePollInterval is the pause between two version checks while a node upgrades
+	upgradePollInterval = 10 * time.Second
+	// readyTimeout is the maximum wait for a new node to become ready
+	readyTimeout = 10 * time.Minute
+	// readyPollInterval is the pause between two checks while a new node becomes ready
+	readyPollInterval = 10 * time.Second
+)
+
+// Environment keys of the lifecycle resources, read by the resource hooks
+const (
+	envNodeIP         = "NODE_IP"
+	envNodeImage      = "NODE_IMAGE"
+	envTalosVersion   = "TALOS_VERSION"
+	envInstallerImage = "INSTALLER_IMAGE"
+	envARMImage       = "ARM_IMAGE"
+	envX86Image       = "X86_IMAGE"
+	envNodeName       = "NODE_NAME"
+	envNodeInternalIP = "NODE_INTERNAL_IP"
+	envControlPlane   = "NODE_CONTROL_PLANE"
+)
+
+// TalosHooksArgs are the arguments for NewTalosHooks
+type TalosHooksArgs struct {
+	// Endpoints are the Talos API endpoints, usually the public IPs of the control plane nodes
+	Endpoints []pulumi.StringOutput
+	// CACertificate is the base64 encoded Talos CA certificate
+	CACertificate pulumi.StringOutput
+	// ClientCertificate is the base64 encoded Talos client certificate
+	ClientCertificate pulumi.StringOutput
+	// ClientKey is the base64 encoded Talos client key
+	ClientKey pulumi.StringOutput
+	// UpgradeTimeout is the maximum duration of a single node upgrade, defaults to 10 minutes
+	UpgradeTimeout time.Duration
+	// KubernetesHost is the URL of the Kubernetes API server, used to drain and remove nodes before they are reset.
+	// If not set, nodes are reset without being drained and their Node objects are kept.
+	KubernetesHost pulumi.StringInput
+	// KubernetesCACertificate is the base64 encoded Kubernetes CA certificate
+	KubernetesCACertificate pulumi.StringInput
+	// KubernetesCAKey is the base64 encoded Kubernetes CA key, used to issue a short-lived admin certificate
+	KubernetesCAKey pulumi.StringInput
+	// DrainTimeout is the maximum duration to drain a node before it is reset, defaults to 5 minutes
+	DrainTimeout time.Duration
+}
+
+// TalosHooks are the resource hooks which upgrade and reset Talos nodes through the Talos API.
+// The Talos credentials are only held in memory of the Pulumi program.
+type TalosHooks struct {
+	// Upgrade is a before create hook, it upgrades the node to the Talos version of the resource inputs
+	Upgrade *pulumi.ResourceHook
+	// Reset is a before delete hook, it decommissions the node of the resource inputs:
+	// the node is drained, control plane nodes leave etcd, the node is gracefully reset and its Node object is deleted
+	Reset *pulumi.ResourceHook
+	// Ready is a before create hook, it waits until the node of the resource inputs is a ready Kubernetes node
+	Ready *pulumi.ResourceHook
+	// Retire is a before create hook, it decommissions the node of the resource inputs like Reset,
+	// so a replaced node leaves the cluster before its server is deleted
+	Retire *pulumi.ResourceHook
+}
+
+// NewTalosHooks registers the Talos upgrade, reset, ready and retire hooks.
+// Delete hooks only run on `pulumi destroy` if the program is run, see `pulumi destroy --run-program`.
+func NewTalosHooks(ctx *pulumi.Context, name string, args *TalosHooksArgs) (*TalosHooks, error) {
+	clientConfig := newClientConfigSource(args)
+
+	upgradeTimeout := args.UpgradeTimeout
+	if upgradeTimeout == 0 {
+		upgradeTimeout = defaultUpgradeTimeout
+	}
+
+	upgrade, err := ctx.RegisterResourceHook(fmt.Sprintf("%s-talos-upgrade", name), newUpgradeHook(ctx, clientConfig, upgradeTimeout), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	drainTimeout := args.DrainTimeout
+	if drainTimeout == 0 {
+		drainTimeout = defaultDrainTimeout
+	}
+
+	var kubernetesClient kubernetesClientSource
+	if args.KubernetesHost != nil {
+		kubernetesClient = newKubernetesClientSource(args)
+	}
+
+	reset, err := ctx.RegisterResourceHook(fmt.Sprintf("%s-talos-reset", name), newResetHook(ctx, clientConfig, kubernetesClient, drainTimeout), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ready, err := ctx.RegisterResourceHook(fmt.Sprintf("%s-talos-ready", name), newReadyHook(ctx, kubernetesClient, readyTimeout, readyPollInterval), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	retire, err := ctx.RegisterResourceHook(fmt.Sprintf("%s-talos-retire", name), newRetireHook(ctx, clientConfig, kubernetesClient, drainTimeout), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TalosHooks{
+		Upgrade: upgrade,
+		Reset:   reset,
+		Ready:   ready,
+		Retire:  retire,
+	}, nil
+}
+
+// clientConfigSource returns the resolved Talos client configuration
+type clientConfigSource func() (*api.ClientConfig, error)
+
+// newClientConfigSource resolves the Talos client configuration in memory.
+// The returned source blocks until the outputs are resolved.
+func newClientConfigSource(args *TalosHooksArgs) clientConfigSource {
+	resolved := make(chan *api.ClientConfig, 1)
+
+	pulumi.All(
+		pulumi.ToStringArrayOutput(args.Endpoints),
+		args.CACertificate,
+		args.ClientCertificate,
+		args.ClientKey,
+	).ApplyT(func(v []interface{}) error {
+		resolved <- &api.ClientConfig{
+			Endpoints:         v[0].([]string),
+			CACertificate:     v[1].(string),
+			ClientCertificate: v[2].(string),
+			ClientKey:         v[3].(string),
+		}
+		return nil
+	})
+
+	var mu sync.Mutex
+	var cfg *api.ClientConfig
+	return func() (*api.ClientConfig, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if cfg != nil {
+			return cfg, nil
+		}
+
+		select {
+		case cfg = <-resolved:
+			return cfg, nil
+		case <-time.After(clientConfigTimeout):
+			return nil, ErrClientConfigUnavailable
+		}
+	}
+}
+
+// kubernetesClientSource returns a Kubernetes client with a short-lived admin certificate
+type kubernetesClientSource func() (*health.Client, error)
+
+// newKubernetesClientSource resolves the Kubernetes credentials in memory.
+// The returned source blocks until the outputs are resolved, every call issues a new admin certificate.
+func newKubernetesClientSource(args *TalosHooksArgs) kubernetesClientSource {
+	resolved := make(chan []string, 1)
+
+	pulumi.All(
+		args.KubernetesHost,
+		args.KubernetesCACertificate,
+		args.KubernetesCAKey,
+	).ApplyT(func(v []interface{}) error {
+		resolved <- []string{v[0].(string), v[1].(string), v[2].(string)}
+		return nil
+	})
+
+	var mu sync.Mutex
+	var credentials []string
+	return func() (*health.Client, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if credentials == nil {
+			select {
+			case credentials = <-resolved:
+			case <-time.After(clientConfigTimeout):
+				return nil, ErrClientConfigUnavailable
+			}
+		}
+
+		return newKubernetesHealthClient(credentials[0], credentials[1], credentials[2])
+	}
+}
+
+// newUpgradeHook returns the hook function which upgrades the node of the created resource
+func newUpgradeHook(ctx *pulumi.Context, clientConfig clientConfigSource, timeout time.Duration) pulumi.ResourceHookFunction {
+	return func(args *pulumi.ResourceHookArgs) error {
+		node, err := environmentValue(args.NewInputs, envNodeIP)
+		if err != nil {
+			return err
+		}
+
+		// Nodes created from the current image already run the expected version
+		nodeImage, _ := environmentValue(args.NewInputs, envNodeImage)
+		armImage, _ := environmentValue(args.NewInputs, envARMImage)
+		x86Image, _ := environmentValue(args.NewInputs, envX86Image)
+		if nodeImage != "" && (nodeImage == armImage || nodeImage == x86Image) {
+			return nil
+		}
+
+		talosVersion, err := environmentValue(args.NewInputs, envTalosVersion)
+		if err != nil {
+			return err
+		}
+		installerImage, err := environmentValue(args.NewInputs, envInstallerImage)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := clientConfig()
+		if err != nil {
+			return err
+		}
+
+		// Delete and replace steps may run after the program finished, so the hooks do not use the program context
+		upgraded, err := upgradeNode(context.Background(), cfg, node, talosVersion, installerImage, timeout)
+		if err != nil {
+			return err
+		}
+		if upgraded {
+			_ = ctx.Log.Info(fmt.Sprintf("upgraded Talos on node %s to %s", node, talosVersion), nil)
+		}
+		return nil
+	}
+}
+
+// newResetHook returns the hook function which decommissions the node of the deleted resource.
+// Without Kubernetes client, the node is only reset.
+func newResetHook(ctx *pulumi.Context, clientConfig clientConfigSource, kubernetesClient kubernetesClientSource, drainTimeout time.Duration) pulumi.ResourceHookFunction {
+	return func(args *pulumi.ResourceHookArgs) error {
+		return decommissionFromInputs(ctx, args.OldInputs, clientConfig, kubernetesClient, drainTimeout)
+	}
+}
+
+// newRetireHook returns the hook function which decommissions the node of the created resource.
+// Without Kubernetes client, the node is only reset.
+func newRetireHook(ctx *pulumi.Context, clientConfig clientConfigSource, kubernetesClient kubernetesClientSource, drainTimeout time.Duration) pulumi.ResourceHookFunction {
+	return func(args *pulumi.ResourceHookArgs) error {
+		return decommissionFromInputs(ctx, args.NewInputs, clientConfig, kubernetesClient, drainTimeout)
+	}
+}
+
+// decommissionFromInputs decommissions the node described by the inputs of a lifecycle resource
+func decommissionFromInputs(ctx *pulumi.Context, inputs resource.PropertyMap, clientConfig clientConfigSource, kubernetesClient kubernetesClientSource, drainTimeout time.Duration) error {
+	node, err := environmentValue(inputs, envNodeIP)
+	if err != nil {
+		return err
+	}
+
+	// Lifecycle resources created by older versions only know the address of the node
+	target := decommissionTarget{address: node}
+	target.name, _ = environmentValue(inputs, envNodeName)
+	target.internalIP, _ = environmentValue(inputs, envNodeInternalIP)
+	controlPlane, _ := environmentValue(inputs, envControlPlane)
+	target.controlPlane = controlPlane == "true"
+
+	cfg, err := clientConfig()
+	if err != nil {
+		return err
+	}
+
+	var kubernetes *health.Client
+	if kubernetesClient != nil {
+		if kubernetes, err = kubernetesClient(); err != nil {
+			return err
+		}
+	}
+
+	return decommissionNode(context.Background(), cfg, kubernetes, target, drainTimeout, drainPollInterval, func(msg string) {
+		_ = ctx.Log.Info(msg, nil)
+	})
+}
+
+// newReadyHook returns the hook function which waits until the node of the created resource is ready.
+// Without Kubernetes client, the readiness can not be checked and the hook returns immediately.
+func newReadyHook(ctx *pulumi.Context, kubernetesClient kubernetesClientSource, timeout, interval time.Duration) pulumi.ResourceHookFunction {
+	return func(args *pulumi.ResourceHookArgs) error {
+		internalIP, err := environmentValue(args.NewInputs, envNodeInternalIP)
+		if err != nil {
+			return err
+		}
+
+		if kubernetesClient == nil {
+			return nil
+		}
+
+		kubernetes, err := kubernetesClient()
+		if err != nil {
+			return err
+		}
+
+		waitCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		if err := kubernetes.WaitForNode(waitCtx, internalIP, "", interval); err != nil {
+			return err
+		}
+
+		_ = ctx.Log.Info(fmt.Sprintf("node %s is ready", internalIP), nil)
+		return nil
+	}
+}
+
+// upgradeNode upgrades the node to the installer image, unless it already runs the expected version.
+// It waits until the node runs the expected version and reports whether an upgrade was done.
+func upgradeNode(ctx context.Context, cfg *api.ClientConfig, node, talosVersion, installerImage string, timeout time.Duration) (bool, error) {
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	current, err := client.Version(ctx, node)
+	if err != nil {
+		return false, err
+	}
+	if current.Tag == talosVersion {
+		return false, nil
+	}
+
+	// Preserve keeps the ephemeral data on the node intact during the upgrade
+	if err := client.Upgrade(ctx, node, installerImage, true); err != nil {
+		return false, err
+	}
+
+	if err := client.WaitForVersion(ctx, node, talosVersion, upgradePollInterval); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// decommissionTarget is a node which is removed from the cluster
+type decommissionTarget struct {
+	// address is the Talos API address of the node
+	address string
+	// name is the name of the server, which is the name of the Kubernetes node
+	name string
+	// internalIP is the IP the node is registered with in Kubernetes
+	internalIP string
+	// controlPlane is true for control plane nodes, which are members of etcd
+	controlPlane bool
+}
+
+// decommissionNode safely removes the node from the cluster before its server is deleted.
+// The Kubernetes node is cordoned and drained, honouring PodDisruptionBudgets until the drain timeout,
+// control plane nodes leave etcd, then the node is gracefully reset and the Kubernetes node object is deleted.
+// A drain which times out fails the deletion, so no disruption budget is violated.
+// A node which is gone from Kubernetes and whose Talos API is unreachable was already decommissioned,
+// e.g. when it was retired by a rolling replacement before its server is deleted.
+func decommissionNode(ctx context.Context, cfg *api.ClientConfig, kubernetes *health.Client, target decommissionTarget, drainTimeout, interval time.Duration, logf func(string)) error {
+	kubernetesNode := ""
+	if kubernetes != nil {
+		var err error
+		if kubernetesNode, err = findKubernetesNode(ctx, kubernetes, target); err != nil {
+			return err
+		}
+	}
+
+	if kubernetesNode != "" {
+		drainCtx, cancel := context.WithTimeout(ctx, drainTimeout)
+		err := kubernetes.Drain(drainCtx, kubernetesNode, interval)
+		cancel()
+		if err != nil {
+			return err
+		}
+		logf(fmt.Sprintf("drained node %s", kubernetesNode))
+	}
+
+	removed := kubernetes != nil && kubernetesNode == "" && (target.name != "" || target.internalIP != "")
+
+	if target.controlPlane {
+		if err := leaveEtcd(ctx, cfg, target.address); err != nil {
+			if removed && errors.Is(err, api.ErrNodeUnavailable) {
+				logf(fmt.Sprintf("node %s was already decommissioned", target.address))
+				return nil
+			}
+			return err
+		}
+		logf(fmt.Sprintf("node %s left etcd", target.address))
+	}
+
+	if err := resetNode(ctx, cfg, target.address); err != nil {
+		if removed && errors.Is(err, api.ErrNodeUnavailable) {
+			logf(fmt.Sprintf("node %s was already decommissioned", target.address))
+			return nil
+		}
+		return err
+	}
+
+	// The node is wiped, failing now would retry the reset of a node which is gone
+	if kubernetesNode != "" {
+		if err := kubernetes.DeleteNode(ctx, kubernetesNode); err != nil {
+			logf(fmt.Sprintf("node %s was reset, but its Node object could not be deleted: %s", kubernetesNode, err))
+		}
+	}
+
+	return nil
+}
+
+// findKubernetesNode returns the name of the Kubernetes node of the target, or an empty name if it never joined the cluster
+func findKubernetesNode(ctx context.Context, kubernetes *health.Client, target decommissionTarget) (string, error) {
+	if target.name == "" && target.internalIP == "" {
+		return "", nil
+	}
+
+	nodes, err := kubernetes.Nodes(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, node := range nodes {
+		if (target.name != "" && node.Name == target.name) || (target.internalIP != "" && node.InternalIP == target.internalIP) {
+			return node.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+// leaveEtcd removes the control plane node from the etcd cluster
+func leaveEtcd(ctx context.Context, cfg *api.ClientConfig, node string) error {
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, resetTimeout)
+	defer cancel()
+
+	return client.EtcdLeaveCluster(ctx, node)
+}
+
+// resetNode gracefully resets the node, so it leaves the cluster before it is deleted
+func resetNode(ctx context.Context, cfg *api.ClientConfig, node string) error {
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, resetTimeout)
+	defer cancel()
+
+	return client.Reset(ctx, node, true)
+}
+
+// environmentValue reads a value of the "environment" input of a lifecycle resource
+func environmentValue(inputs resource.PropertyMap, key string) (string, error) {
+	env := unwrapSecret(inputs["environment"])
+	if env.IsObject() {
+		value := unwrapSecret(env.ObjectValue()[resource.PropertyKey(key)])
+		if value.IsString() && value.StringValue() != "" {
+			return value.StringValue(), nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrMissingHookInput, key)
+}
+
+func unwrapSecret(v resource.PropertyValue) resource.PropertyValue {
+	if v.IsSecret() {
+		return v.SecretValue().Element
+	}
+	return v
+}
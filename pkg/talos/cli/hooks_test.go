@@ -0,0 +1,337 @@
+package cli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health/healthtest"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api/apitest"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeTalos(t *testing.T, version string) *apitest.Server {
+	t.Helper()
+
+	server, err := apitest.NewServer(version)
+	require.NoError(t, err)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func environmentInputs(env map[string]interface{}) resource.PropertyMap {
+	return resource.NewPropertyMapFromMap(map[string]interface{}{
+		"environment": env,
+	})
+}
+
+func Test_upgradeNode(t *testing.T) {
+	tests := []struct {
+		name         string
+		nodeVersion  string
+		wantUpgraded bool
+		wantUpgrades []apitest.UpgradeRequest
+	}{
+		{
+			name:         "already on target version",
+			nodeVersion:  "v1.11.3",
+			wantUpgraded: false,
+			wantUpgrades: []apitest.UpgradeRequest{},
+		},
+		{
+			name:         "upgrade to target version",
+			nodeVersion:  "v1.10.0",
+			wantUpgraded: true,
+			wantUpgrades: []apitest.UpgradeRequest{
+				{Node: "1.2.3.4", Image: "factory.talos.dev/installer/abc:v1.11.3", Preserve: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeTalos(t, tt.nodeVersion)
+
+			upgraded, err := upgradeNode(context.Background(), server.ClientConfig, "1.2.3.4", "v1.11.3", InstallerImage("abc", "v1.11.3"), time.Minute)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantUpgraded, upgraded)
+			assert.Equal(t, tt.wantUpgrades, server.Upgrades())
+		})
+	}
+}
+
+func Test_upgradeNode_unavailable(t *testing.T) {
+	server := newFakeTalos(t, "v1.10.0")
+	server.SetFailure("1.2.3.4", apitest.Unavailable())
+
+	_, err := upgradeNode(context.Background(), server.ClientConfig, "1.2.3.4", "v1.11.3", InstallerImage("abc", "v1.11.3"), time.Minute)
+	assert.ErrorIs(t, err, api.ErrNodeUnavailable)
+}
+
+func Test_resetNode(t *testing.T) {
+	server := newFakeTalos(t, "v1.11.3")
+
+	err := resetNode(context.Background(), server.ClientConfig, "1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, []apitest.ResetRequest{{Node: "1.2.3.4", Graceful: true}}, server.Resets())
+}
+
+func Test_newUpgradeHook(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]interface{}
+		wantErr      error
+		wantUpgrades int
+	}{
+		{
+			name: "upgrade",
+			env: map[string]interface{}{
+				envNodeIP:         "1.2.3.4",
+				envNodeImage:      "1",
+				envARMImage:       "2",
+				envX86Image:       "3",
+				envTalosVersion:   "v1.11.3",
+				envInstallerImage: "installer:v1.11.3",
+			},
+			wantUpgrades: 1,
+		},
+		{
+			name: "node created from current image",
+			env: map[string]interface{}{
+				envNodeIP:         "1.2.3.4",
+				envNodeImage:      "3",
+				envARMImage:       "2",
+				envX86Image:       "3",
+				envTalosVersion:   "v1.11.3",
+				envInstallerImage: "installer:v1.11.3",
+			},
+			wantUpgrades: 0,
+		},
+		{
+			name: "missing node ip",
+			env: map[string]interface{}{
+				envTalosVersion: "v1.11.3",
+			},
+			wantErr: ErrMissingHookInput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeTalos(t, "v1.10.0")
+
+			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+				hook := newUpgradeHook(ctx, func() (*api.ClientConfig, error) {
+					return server.ClientConfig, nil
+				}, time.Minute)
+
+				return hook(&pulumi.ResourceHookArgs{NewInputs: environmentInputs(tt.env)})
+			}, pulumi.WithMocks("project", "stack", mocks(0)))
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, server.Upgrades(), tt.wantUpgrades)
+		})
+	}
+}
+
+func Test_newResetHook(t *testing.T) {
+	server := newFakeTalos(t, "v1.11.3")
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		hook := newResetHook(ctx, func() (*api.ClientConfig, error) {
+			return server.ClientConfig, nil
+		}, nil, time.Minute)
+
+		if err := hook(&pulumi.ResourceHookArgs{OldInputs: environmentInputs(map[string]interface{}{
+			envNodeIP: "1.2.3.4",
+		})}); err != nil {
+			return err
+		}
+
+		assert.ErrorIs(t, hook(&pulumi.ResourceHookArgs{OldInputs: resource.PropertyMap{}}), ErrMissingHookInput)
+		return nil
+	}, pulumi.WithMocks("project", "stack", mocks(0)))
+	require.NoError(t, err)
+	assert.Equal(t, []apitest.ResetRequest{{Node: "1.2.3.4", Graceful: true}}, server.Resets())
+}
+
+func Test_decommissionNode(t *testing.T) {
+	tests := []struct {
+		name             string
+		target           decommissionTarget
+		blockEviction    bool
+		unavailable      bool
+		wantErr          error
+		wantEvictions    []string
+		wantEtcdLeaves   []string
+		wantResets       []apitest.ResetRequest
+		wantDeletedNodes []string
+	}{
+		{
+			name:             "worker is drained, reset and deleted",
+			target:           decommissionTarget{address: "1.2.3.4", name: "workers-0", internalIP: "10.0.1.2"},
+			wantEvictions:    []string{"default/app"},
+			wantEtcdLeaves:   []string{},
+			wantResets:       []apitest.ResetRequest{{Node: "1.2.3.4", Graceful: true}},
+			wantDeletedNodes: []string{"workers-0"},
+		},
+		{
+			name:             "control plane leaves etcd",
+			target:           decommissionTarget{address: "1.2.3.5", internalIP: "10.0.1.1", controlPlane: true},
+			wantEvictions:    []string{},
+			wantEtcdLeaves:   []string{"1.2.3.5"},
+			wantResets:       []apitest.ResetRequest{{Node: "1.2.3.5", Graceful: true}},
+			wantDeletedNodes: []string{"controlplane-0"},
+		},
+		{
+			name:             "node which never joined is only reset",
+			target:           decommissionTarget{address: "1.2.3.6", name: "workers-1", internalIP: "10.0.1.3"},
+			wantEvictions:    []string{},
+			wantEtcdLeaves:   []string{},
+			wantResets:       []apitest.ResetRequest{{Node: "1.2.3.6", Graceful: true}},
+			wantDeletedNodes: []string{},
+		},
+		{
+			name:             "drain blocked by a disruption budget keeps the node",
+			target:           decommissionTarget{address: "1.2.3.4", name: "workers-0"},
+			blockEviction:    true,
+			wantErr:          health.ErrDrainTimeout,
+			wantEvictions:    []string{},
+			wantEtcdLeaves:   []string{},
+			wantResets:       []apitest.ResetRequest{},
+			wantDeletedNodes: []string{},
+		},
+		{
+			name:             "already decommissioned node is skipped",
+			target:           decommissionTarget{address: "1.2.3.6", name: "workers-1", internalIP: "10.0.1.3"},
+			unavailable:      true,
+			wantEvictions:    []string{},
+			wantEtcdLeaves:   []string{},
+			wantResets:       []apitest.ResetRequest{},
+			wantDeletedNodes: []string{},
+		},
+		{
+			name:             "unreachable node which is still registered fails",
+			target:           decommissionTarget{address: "1.2.3.4", name: "workers-0", internalIP: "10.0.1.2"},
+			unavailable:      true,
+			wantErr:          api.ErrNodeUnavailable,
+			wantEvictions:    []string{"default/app"},
+			wantEtcdLeaves:   []string{},
+			wantResets:       []apitest.ResetRequest{},
+			wantDeletedNodes: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			talos := newFakeTalos(t, "v1.11.3")
+			if tt.unavailable {
+				talos.SetFailure(tt.target.address, apitest.Unavailable())
+			}
+
+			kubernetes, err := healthtest.NewServer()
+			require.NoError(t, err)
+			t.Cleanup(kubernetes.Close)
+			kubernetes.SetNodes(
+				health.Node{Name: "controlplane-0", InternalIP: "10.0.1.1", Ready: true},
+				health.Node{Name: "workers-0", InternalIP: "10.0.1.2", Ready: true},
+			)
+			kubernetes.SetPods(health.Pod{Namespace: "default", Name: "app", NodeName: "workers-0"})
+			if tt.blockEviction {
+				kubernetes.BlockEviction("default", "app", 1000)
+			}
+
+			client, err := health.NewClient(kubernetes.Config)
+			require.NoError(t, err)
+
+			err = decommissionNode(context.Background(), talos.ClientConfig, client, tt.target, 50*time.Millisecond, 10*time.Millisecond, func(string) {})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantEvictions, kubernetes.Evictions())
+			assert.Equal(t, tt.wantEtcdLeaves, talos.EtcdLeaves())
+			assert.Equal(t, tt.wantResets, talos.Resets())
+			assert.Equal(t, tt.wantDeletedNodes, kubernetes.DeletedNodes())
+		})
+	}
+}
+
+func Test_newRetireHook(t *testing.T) {
+	server := newFakeTalos(t, "v1.11.3")
+
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		hook := newRetireHook(ctx, func() (*api.ClientConfig, error) {
+			return server.ClientConfig, nil
+		}, nil, time.Minute)
+
+		if err := hook(&pulumi.ResourceHookArgs{NewInputs: environmentInputs(map[string]interface{}{
+			envNodeIP:       "1.2.3.4",
+			envNodeName:     "workers-0-abc123",
+			envControlPlane: "false",
+		})}); err != nil {
+			return err
+		}
+
+		assert.ErrorIs(t, hook(&pulumi.ResourceHookArgs{NewInputs: resource.PropertyMap{}}), ErrMissingHookInput)
+		return nil
+	}, pulumi.WithMocks("project", "stack", mocks(0)))
+	require.NoError(t, err)
+	assert.Equal(t, []apitest.ResetRequest{{Node: "1.2.3.4", Graceful: true}}, server.Resets())
+}
+
+func Test_newReadyHook(t *testing.T) {
+	tests := []struct {
+		name    string
+		node    health.Node
+		env     map[string]interface{}
+		wantErr error
+	}{
+		{
+			name: "ready node",
+			node: health.Node{Name: "workers-0-abc123", InternalIP: "10.0.1.2", Ready: true},
+			env:  map[string]interface{}{envNodeInternalIP: "10.0.1.2"},
+		},
+		{
+			name:    "node not ready in time",
+			node:    health.Node{Name: "workers-0-abc123", InternalIP: "10.0.1.2"},
+			env:     map[string]interface{}{envNodeInternalIP: "10.0.1.2"},
+			wantErr: health.ErrNodeNotReady,
+		},
+		{
+			name:    "missing internal ip",
+			env:     map[string]interface{}{envNodeIP: "1.2.3.4"},
+			wantErr: ErrMissingHookInput,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubernetes, err := healthtest.NewServer()
+			require.NoError(t, err)
+			t.Cleanup(kubernetes.Close)
+			kubernetes.SetNodes(tt.node)
+
+			err = pulumi.RunErr(func(ctx *pulumi.Context) error {
+				hook := newReadyHook(ctx, func() (*health.Client, error) {
+					return health.NewClient(kubernetes.Config)
+				}, 50*time.Millisecond, 10*time.Millisecond)
+
+				return hook(&pulumi.ResourceHookArgs{NewInputs: environmentInputs(tt.env)})
+			}, pulumi.WithMocks("project", "stack", mocks(0)))
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,428 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/core"
+	"github.com/pulumi/pulumi-command/sdk/go/command/local"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+	"github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+)
+
+var (
+	// ErrKubernetesImagePatch is returned when the Kubernetes images can not be patched into the running configuration of a node
+	ErrKubernetesImagePatch = errors.New("failed to patch the Kubernetes images")
+)
+
+const (
+	// defaultKubernetesUpgradeNodeTimeout is the maximum duration to roll a single node to the new Kubernetes version
+	defaultKubernetesUpgradeNodeTimeout = 10 * time.Minute
+	// envKubernetesVersion is the environment key of the Kubernetes version lifecycle resource
+	envKubernetesVersion = "KUBERNETES_VERSION"
+)
+
+// KubernetesUpgradeNode is a node which is rolled to a new Kubernetes version
+type KubernetesUpgradeNode struct {
+	// Address is the Talos API address of the node, usually its public IP
+	Address pulumi.StringOutput
+	// InternalIP is the IP the node is registered with in Kubernetes
+	InternalIP pulumi.StringOutput
+	// MachineConfiguration is the machine configuration of the node, rendered for the new Kubernetes version
+	MachineConfiguration pulumi.StringOutput
+}
+
+// KubernetesUpgradePool is a worker pool whose kubelets are rolled together
+type KubernetesUpgradePool struct {
+	// Name of the node pool
+	Name string
+	// Nodes of the node pool
+	Nodes []KubernetesUpgradeNode
+}
+
+// KubernetesUpgradeArgs are the arguments for NewKubernetesUpgrade
+type KubernetesUpgradeArgs struct {
+	// Endpoints are the Talos API endpoints, usually the public IPs of the control plane nodes
+	Endpoints []pulumi.StringOutput
+	// CACertificate is the base64 encoded Talos CA certificate
+	CACertificate pulumi.StringOutput
+	// ClientCertificate is the base64 encoded Talos client certificate
+	ClientCertificate pulumi.StringOutput
+	// ClientKey is the base64 encoded Talos client key
+	ClientKey pulumi.StringOutput
+	// KubernetesHost is the URL of the Kubernetes API server, usually the cluster endpoint
+	KubernetesHost pulumi.StringOutput
+	// KubernetesCACertificate is the base64 encoded Kubernetes CA certificate
+	KubernetesCACertificate pulumi.StringOutput
+	// KubernetesCAKey is the base64 encoded Kubernetes CA key, used to issue a short-lived admin certificate
+	KubernetesCAKey pulumi.StringOutput
+	// KubernetesVersion is the Kubernetes version of the cluster
+	KubernetesVersion string
+	// ControlPlaneNodes are upgraded first, one by one
+	ControlPlaneNodes []KubernetesUpgradeNode
+	// WorkerPools are upgraded after the control plane, pool by pool
+	WorkerPools []KubernetesUpgradePool
+	// NodeTimeout is the maximum duration to roll a single node, defaults to 10 minutes
+	NodeTimeout time.Duration
+}
+
+// KubernetesUpgrade tracks the Kubernetes version of the cluster.
+// Version is a lifecycle resource without commands. When the Kubernetes version changes,
+// a before update hook rolls the new version through the cluster before the configuration of any node is applied:
+// the control plane nodes one by one (API server, controller manager, scheduler and kubelet),
+// then the kubelets of the worker pools pool by pool. Every node must be ready on the new version before the next one is rolled.
+// Only the Kubernetes images are patched into the running configuration of a node, without reboot.
+// All other changes of the configuration are applied afterwards by the regular configuration apply.
+type KubernetesUpgrade struct {
+	Version *local.Command
+}
+
+// NewKubernetesUpgrade registers the Kubernetes upgrade hook and creates the Kubernetes version lifecycle resource.
+// Resources which apply the machine configuration should depend on it.
+func NewKubernetesUpgrade(ctx *pulumi.Context, name string, args *KubernetesUpgradeArgs, opts ...pulumi.ResourceOption) (*KubernetesUpgrade, error) {
+	nodeTimeout := args.NodeTimeout
+	if nodeTimeout == 0 {
+		nodeTimeout = defaultKubernetesUpgradeNodeTimeout
+	}
+
+	hook, err := ctx.RegisterResourceHook(fmt.Sprintf("%s-kubernetes-upgrade", name),
+		newKubernetesUpgradeHook(ctx, newKubernetesUpgradePlanSource(args), nodeTimeout), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := local.NewCommand(ctx, fmt.Sprintf("%s-kubernetes-version", name), &local.CommandArgs{
+		Environment: pulumi.StringMap{
+			envKubernetesVersion: pulumi.String(args.KubernetesVersion),
+		},
+	}, append(opts, pulumi.ResourceHooks(&pulumi.ResourceHookBinding{
+		BeforeUpdate: []*pulumi.ResourceHook{hook},
+	}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KubernetesUpgrade{
+		Version: version,
+	}, nil
+}
+
+// kubernetesUpgradeTarget is a resolved KubernetesUpgradeNode
+type kubernetesUpgradeTarget struct {
+	address              string
+	internalIP           string
+	machineConfiguration string
+}
+
+// kubernetesUpgradePool is a resolved KubernetesUpgradePool
+type kubernetesUpgradePool struct {
+	name  string
+	nodes []kubernetesUpgradeTarget
+}
+
+// kubernetesUpgradePlan holds everything the Kubernetes upgrade hook needs, resolved in memory
+type kubernetesUpgradePlan struct {
+	talos                   *api.ClientConfig
+	kubernetesHost          string
+	kubernetesCACertificate string
+	kubernetesCAKey         string
+	controlPlane            []kubernetesUpgradeTarget
+	workerPools             []kubernetesUpgradePool
+}
+
+// kubernetesUpgradePlanSource returns the resolved upgrade plan
+type kubernetesUpgradePlanSource func() (*kubernetesUpgradePlan, error)
+
+// newKubernetesUpgradePlanSource resolves the upgrade plan in memory.
+// The returned source blocks until the outputs are resolved.
+func newKubernetesUpgradePlanSource(args *KubernetesUpgradeArgs) kubernetesUpgradePlanSource {
+	resolved := make(chan *kubernetesUpgradePlan, 1)
+
+	inputs := []interface{}{
+		pulumi.ToStringArrayOutput(args.Endpoints),
+		args.CACertificate,
+		args.ClientCertificate,
+		args.ClientKey,
+		args.KubernetesHost,
+		args.KubernetesCACertificate,
+		args.KubernetesCAKey,
+	}
+	inputs = append(inputs, kubernetesUpgradeNodeOutputs(args.ControlPlaneNodes))
+	for _, pool := range args.WorkerPools {
+		inputs = append(inputs, kubernetesUpgradeNodeOutputs(pool.Nodes))
+	}
+
+	pulumi.All(inputs...).ApplyT(func(v []interface{}) error {
+		plan := &kubernetesUpgradePlan{
+			talos: &api.ClientConfig{
+				Endpoints:         v[0].([]string),
+				CACertificate:     v[1].(string),
+				ClientCertificate: v[2].(string),
+				ClientKey:         v[3].(string),
+			},
+			kubernetesHost:          v[4].(string),
+			kubernetesCACertificate: v[5].(string),
+			kubernetesCAKey:         v[6].(string),
+			controlPlane:            kubernetesUpgradeTargets(v[7].([]string)),
+		}
+		for i, pool := range args.WorkerPools {
+			plan.workerPools = append(plan.workerPools, kubernetesUpgradePool{
+				name:  pool.Name,
+				nodes: kubernetesUpgradeTargets(v[8+i].([]string)),
+			})
+		}
+		resolved <- plan
+		return nil
+	})
+
+	var mu sync.Mutex
+	var plan *kubernetesUpgradePlan
+	return func() (*kubernetesUpgradePlan, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if plan != nil {
+			return plan, nil
+		}
+
+		select {
+		case plan = <-resolved:
+			return plan, nil
+		case <-time.After(clientConfigTimeout):
+			return nil, ErrClientConfigUnavailable
+		}
+	}
+}
+
+// kubernetesUpgradeNodeOutputs flattens the nodes into a single output of address, internal IP and configuration triples
+func kubernetesUpgradeNodeOutputs(nodes []KubernetesUpgradeNode) pulumi.StringArrayOutput {
+	outputs := []pulumi.StringOutput{}
+	for _, node := range nodes {
+		outputs = append(outputs, node.Address, node.InternalIP, node.MachineConfiguration)
+	}
+	return pulumi.ToStringArrayOutput(outputs)
+}
+
+// kubernetesUpgradeTargets is the reverse of kubernetesUpgradeNodeOutputs
+func kubernetesUpgradeTargets(values []string) []kubernetesUpgradeTarget {
+	targets := []kubernetesUpgradeTarget{}
+	for i := 0; i+2 < len(values); i += 3 {
+		targets = append(targets, kubernetesUpgradeTarget{
+			address:              values[i],
+			internalIP:           values[i+1],
+			machineConfiguration: values[i+2],
+		})
+	}
+	return targets
+}
+
+// newKubernetesUpgradeHook returns the hook function which rolls a changed Kubernetes version through the cluster
+func newKubernetesUpgradeHook(ctx *pulumi.Context, planSource kubernetesUpgradePlanSource, nodeTimeout time.Duration) pulumi.ResourceHookFunction {
+	return func(args *pulumi.ResourceHookArgs) error {
+		from, err := environmentValue(args.OldInputs, envKubernetesVersion)
+		if err != nil {
+			return err
+		}
+		to, err := environmentValue(args.NewInputs, envKubernetesVersion)
+		if err != nil {
+			return err
+		}
+		if from == to {
+			return nil
+		}
+
+		if err := core.ValidateKubernetesUpgrade(from, to); err != nil {
+			return err
+		}
+
+		plan, err := planSource()
+		if err != nil {
+			return err
+		}
+
+		_ = ctx.Log.Info(fmt.Sprintf("upgrading Kubernetes from %s to %s", from, to), nil)
+
+		return upgradeKubernetes(context.Background(), plan, to, nodeTimeout, upgradePollInterval, func(msg string) {
+			_ = ctx.Log.Info(msg, nil)
+		})
+	}
+}
+
+// upgradeKubernetes rolls the Kubernetes version through the cluster, like `talosctl upgrade-k8s`.
+// The Kubernetes images are patched on one node at a time, control plane first, then pool by pool.
+// After each node, the node must be ready with the new kubelet version and the API server must report ready.
+func upgradeKubernetes(ctx context.Context, plan *kubernetesUpgradePlan, kubernetesVersion string, nodeTimeout, interval time.Duration, logf func(string)) error {
+	talosClient, err := api.NewClient(plan.talos)
+	if err != nil {
+		return err
+	}
+	defer talosClient.Close()
+
+	kubernetesClient, err := newKubernetesHealthClient(plan.kubernetesHost, plan.kubernetesCACertificate, plan.kubernetesCAKey)
+	if err != nil {
+		return err
+	}
+
+	nodes := append([]kubernetesUpgradeTarget{}, plan.controlPlane...)
+	for _, pool := range plan.workerPools {
+		nodes = append(nodes, pool.nodes...)
+	}
+
+	// The running Talos version must support the new Kubernetes version, Talos upgrades are applied after the configuration
+	for _, node := range nodes {
+		talosVersion, err := talosClient.Version(ctx, node.address)
+		if err != nil {
+			return err
+		}
+		if err := core.ValidateKubernetesVersion(talosVersion.Tag, kubernetesVersion); err != nil {
+			return fmt.Errorf("node %s: %w, upgrade Talos first", node.address, err)
+		}
+	}
+
+	kubeletVersion := core.KubeletVersion(kubernetesVersion)
+
+	for _, node := range plan.controlPlane {
+		if err := rollKubernetesNode(ctx, talosClient, kubernetesClient, node, kubeletVersion, nodeTimeout, interval); err != nil {
+			return err
+		}
+		logf(fmt.Sprintf("upgraded Kubernetes control plane node %s to %s", node.address, kubernetesVersion))
+	}
+
+	for _, pool := range plan.workerPools {
+		for _, node := range pool.nodes {
+			if err := rollKubernetesNode(ctx, talosClient, kubernetesClient, node, kubeletVersion, nodeTimeout, interval); err != nil {
+				return err
+			}
+		}
+		logf(fmt.Sprintf("upgraded Kubernetes on node pool %s to %s", pool.name, kubernetesVersion))
+	}
+
+	return nil
+}
+
+// rollKubernetesNode patches the Kubernetes images of the rendered machine configuration into the running configuration of the node
+// and waits until the node and the API server are ready again.
+// The patch is applied with ApplyModeNoReboot, Talos rejects it if the change would require a reboot.
+func rollKubernetesNode(ctx context.Context, talosClient *api.Client, kubernetesClient *health.Client, node kubernetesUpgradeTarget, kubeletVersion string, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	running, err := talosClient.MachineConfiguration(ctx, node.address)
+	if err != nil {
+		return err
+	}
+
+	patched, err := patchKubernetesImages(running, []byte(node.machineConfiguration))
+	if err != nil {
+		return fmt.Errorf("node %s: %w", node.address, err)
+	}
+
+	if err := talosClient.ApplyConfiguration(ctx, node.address, patched, api.ApplyModeNoReboot); err != nil {
+		return err
+	}
+
+	if err := kubernetesClient.WaitForNode(ctx, node.internalIP, kubeletVersion, interval); err != nil {
+		return err
+	}
+
+	return kubernetesClient.WaitUntilReady(ctx, interval)
+}
+
+// patchKubernetesImages returns the running machine configuration with the Kubernetes images of the rendered configuration.
+// The kubelet image is patched on every node, the images of the control plane components only if the rendered configuration sets them.
+func patchKubernetesImages(running, rendered []byte) ([]byte, error) {
+	renderedConfig, err := configloader.NewFromBytes(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("%w: rendered configuration: %w", ErrKubernetesImagePatch, err)
+	}
+	runningConfig, err := configloader.NewFromBytes(running)
+	if err != nil {
+		return nil, fmt.Errorf("%w: running configuration: %w", ErrKubernetesImagePatch, err)
+	}
+
+	target := renderedConfig.RawV1Alpha1()
+	if target == nil || target.MachineConfig == nil || target.MachineConfig.MachineKubelet == nil || target.MachineConfig.MachineKubelet.KubeletImage == "" {
+		return nil, fmt.Errorf("%w: rendered configuration has no kubelet image", ErrKubernetesImagePatch)
+	}
+
+	patched, err := runningConfig.PatchV1Alpha1(func(cfg *v1alpha1.Config) error {
+		if cfg.MachineConfig == nil {
+			return fmt.Errorf("%w: running configuration has no machine section", ErrKubernetesImagePatch)
+		}
+		if cfg.MachineConfig.MachineKubelet == nil {
+			cfg.MachineConfig.MachineKubelet = &v1alpha1.KubeletConfig{}
+		}
+		cfg.MachineConfig.MachineKubelet.KubeletImage = target.MachineConfig.MachineKubelet.KubeletImage
+
+		cluster := target.ClusterConfig
+		if cluster == nil {
+			return nil
+		}
+		if cfg.ClusterConfig == nil {
+			cfg.ClusterConfig = &v1alpha1.ClusterConfig{}
+		}
+		if cluster.APIServerConfig != nil && cluster.APIServerConfig.ContainerImage != "" {
+			if cfg.ClusterConfig.APIServerConfig == nil {
+				cfg.ClusterConfig.APIServerConfig = &v1alpha1.APIServerConfig{}
+			}
+			cfg.ClusterConfig.APIServerConfig.ContainerImage = cluster.APIServerConfig.ContainerImage
+		}
+		if cluster.ControllerManagerConfig != nil && cluster.ControllerManagerConfig.ContainerImage != "" {
+			if cfg.ClusterConfig.ControllerManagerConfig == nil {
+				cfg.ClusterConfig.ControllerManagerConfig = &v1alpha1.ControllerManagerConfig{}
+			}
+			cfg.ClusterConfig.ControllerManagerConfig.ContainerImage = cluster.ControllerManagerConfig.ContainerImage
+		}
+		if cluster.SchedulerConfig != nil && cluster.SchedulerConfig.ContainerImage != "" {
+			if cfg.ClusterConfig.SchedulerConfig == nil {
+				cfg.ClusterConfig.SchedulerConfig = &v1alpha1.SchedulerConfig{}
+			}
+			cfg.ClusterConfig.SchedulerConfig.ContainerImage = cluster.SchedulerConfig.ContainerImage
+		}
+		if cluster.ProxyConfig != nil && cluster.ProxyConfig.ContainerImage != "" {
+			if cfg.ClusterConfig.ProxyConfig == nil {
+				cfg.ClusterConfig.ProxyConfig = &v1alpha1.ProxyConfig{}
+			}
+			cfg.ClusterConfig.ProxyConfig.ContainerImage = cluster.ProxyConfig.ContainerImage
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return patched.EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+}
+
+// newKubernetesHealthClient creates a Kubernetes health client with a short-lived admin certificate issued by the cluster CA
+// The CA certificate and key are base64 encoded.
+func newKubernetesHealthClient(host, encodedCACertificate, encodedCAKey string) (*health.Client, error) {
+	caCertificate, err := base64.StdEncoding.DecodeString(encodedCACertificate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: Kubernetes CA certificate: %w", health.ErrInvalidConfig, err)
+	}
+	caKey, err := base64.StdEncoding.DecodeString(encodedCAKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: Kubernetes CA key: %w", health.ErrInvalidConfig, err)
+	}
+
+	certificate, key, err := health.NewAdminCredentials(caCertificate, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return health.NewClient(&health.Config{
+		Host:              host,
+		CACertificate:     caCertificate,
+		ClientCertificate: certificate,
+		ClientKey:         key,
+	})
+}
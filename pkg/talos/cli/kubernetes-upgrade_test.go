@@ -0,0 +1,276 @@
+package cli
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/k8s/health/healthtest"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/api/apitest"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/core"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/siderolabs/talos/pkg/machinery/config/configloader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMachineConfiguration returns a minimal machine configuration of the Kubernetes version.
+// Control plane configurations also set the images of the control plane components.
+func testMachineConfiguration(machineType, hostname, kubernetesVersion string) string {
+	configuration := fmt.Sprintf(`version: v1alpha1
+machine:
+  type: %s
+  network:
+    hostname: %s
+  kubelet:
+    image: ghcr.io/siderolabs/kubelet:v%s
+cluster:
+  proxy:
+    image: registry.k8s.io/kube-proxy:v%[3]s
+`, machineType, hostname, kubernetesVersion)
+	if machineType == "controlplane" {
+		configuration += fmt.Sprintf(`  apiServer:
+    image: registry.k8s.io/kube-apiserver:v%[1]s
+  controllerManager:
+    image: registry.k8s.io/kube-controller-manager:v%[1]s
+  scheduler:
+    image: registry.k8s.io/kube-scheduler:v%[1]s
+`, kubernetesVersion)
+	}
+	return configuration
+}
+
+// newFakeKubernetesCluster starts a fake Talos and Kubernetes API for the given nodes.
+// All nodes run the configuration of Kubernetes v1.33.5 with their address as hostname.
+// A node reports the new kubelet version as soon as a configuration was applied to it through the Talos API.
+func newFakeKubernetesCluster(t *testing.T, talosVersion string, nodes map[string]string) (*apitest.Server, *healthtest.Server) {
+	t.Helper()
+
+	talos := newFakeTalos(t, talosVersion)
+	for address := range nodes {
+		machineType := "worker"
+		if strings.HasSuffix(address, ".1") || strings.HasSuffix(address, ".2") {
+			machineType = "controlplane"
+		}
+		talos.SetMachineConfiguration(address, testMachineConfiguration(machineType, address, "1.33.5"))
+	}
+
+	kubernetes, err := healthtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(kubernetes.Close)
+
+	kubernetes.SetNodeSource(func() []health.Node {
+		applied := map[string]bool{}
+		for _, apply := range talos.Applies() {
+			applied[apply.Node] = true
+		}
+
+		out := []health.Node{}
+		for address, internalIP := range nodes {
+			node := health.Node{Name: address, InternalIP: internalIP, KubeletVersion: "v1.33.5", Ready: true}
+			if applied[address] {
+				node.KubeletVersion = "v1.34.0"
+			}
+			out = append(out, node)
+		}
+		return out
+	})
+
+	return talos, kubernetes
+}
+
+func newTestKubernetesUpgradePlan(talos *apitest.Server, kubernetes *healthtest.Server) *kubernetesUpgradePlan {
+	return &kubernetesUpgradePlan{
+		talos:                   talos.ClientConfig,
+		kubernetesHost:          kubernetes.Config.Host,
+		kubernetesCACertificate: base64.StdEncoding.EncodeToString(kubernetes.Config.CACertificate),
+		kubernetesCAKey:         base64.StdEncoding.EncodeToString(kubernetes.CAKey),
+		controlPlane: []kubernetesUpgradeTarget{
+			{address: "1.0.0.1", internalIP: "10.0.1.1", machineConfiguration: testMachineConfiguration("controlplane", "rendered", "1.34.0")},
+			{address: "1.0.0.2", internalIP: "10.0.1.2", machineConfiguration: testMachineConfiguration("controlplane", "rendered", "1.34.0")},
+		},
+		workerPools: []kubernetesUpgradePool{
+			{name: "workers-a", nodes: []kubernetesUpgradeTarget{
+				{address: "1.0.0.3", internalIP: "10.0.1.3", machineConfiguration: testMachineConfiguration("worker", "rendered", "1.34.0")},
+			}},
+			{name: "workers-b", nodes: []kubernetesUpgradeTarget{
+				{address: "1.0.0.4", internalIP: "10.0.1.4", machineConfiguration: testMachineConfiguration("worker", "rendered", "1.34.0")},
+			}},
+		},
+	}
+}
+
+var testKubernetesNodes = map[string]string{
+	"1.0.0.1": "10.0.1.1",
+	"1.0.0.2": "10.0.1.2",
+	"1.0.0.3": "10.0.1.3",
+	"1.0.0.4": "10.0.1.4",
+}
+
+func Test_upgradeKubernetes(t *testing.T) {
+	talos, kubernetes := newFakeKubernetesCluster(t, "v1.11.3", testKubernetesNodes)
+
+	logs := []string{}
+	err := upgradeKubernetes(context.Background(), newTestKubernetesUpgradePlan(talos, kubernetes), "1.34.0", time.Minute, time.Millisecond, func(msg string) {
+		logs = append(logs, msg)
+	})
+	require.NoError(t, err)
+
+	// control planes first, then pool by pool, only the images are patched into the running configuration
+	applies := talos.Applies()
+	require.Len(t, applies, 4)
+	for i, node := range []string{"1.0.0.1", "1.0.0.2", "1.0.0.3", "1.0.0.4"} {
+		assert.Equal(t, node, applies[i].Node)
+		assert.Equal(t, api.ApplyModeNoReboot, applies[i].Mode)
+
+		cfg, err := configloader.NewFromBytes([]byte(applies[i].Configuration))
+		require.NoError(t, err)
+		raw := cfg.RawV1Alpha1()
+		assert.Equal(t, node, raw.MachineConfig.MachineNetwork.NetworkHostname)
+		assert.Equal(t, "ghcr.io/siderolabs/kubelet:v1.34.0", raw.MachineConfig.MachineKubelet.KubeletImage)
+		assert.Equal(t, "registry.k8s.io/kube-proxy:v1.34.0", raw.ClusterConfig.ProxyConfig.ContainerImage)
+	}
+	assert.Len(t, logs, 4)
+}
+
+func Test_upgradeKubernetes_rebootRequired(t *testing.T) {
+	talos, kubernetes := newFakeKubernetesCluster(t, "v1.11.3", testKubernetesNodes)
+	talos.SetRebootRequired("1.0.0.1")
+
+	err := upgradeKubernetes(context.Background(), newTestKubernetesUpgradePlan(talos, kubernetes), "1.34.0", time.Minute, time.Millisecond, func(string) {})
+	assert.ErrorIs(t, err, api.ErrNodeFailed)
+	assert.Empty(t, talos.Applies())
+}
+
+func Test_patchKubernetesImages(t *testing.T) {
+	t.Run("control plane", func(t *testing.T) {
+		patched, err := patchKubernetesImages(
+			[]byte(testMachineConfiguration("controlplane", "running", "1.33.5")),
+			[]byte(testMachineConfiguration("controlplane", "rendered", "1.34.0")),
+		)
+		require.NoError(t, err)
+
+		cfg, err := configloader.NewFromBytes(patched)
+		require.NoError(t, err)
+		raw := cfg.RawV1Alpha1()
+		assert.Equal(t, "running", raw.MachineConfig.MachineNetwork.NetworkHostname)
+		assert.Equal(t, "ghcr.io/siderolabs/kubelet:v1.34.0", raw.MachineConfig.MachineKubelet.KubeletImage)
+		assert.Equal(t, "registry.k8s.io/kube-apiserver:v1.34.0", raw.ClusterConfig.APIServerConfig.ContainerImage)
+		assert.Equal(t, "registry.k8s.io/kube-controller-manager:v1.34.0", raw.ClusterConfig.ControllerManagerConfig.ContainerImage)
+		assert.Equal(t, "registry.k8s.io/kube-scheduler:v1.34.0", raw.ClusterConfig.SchedulerConfig.ContainerImage)
+		assert.Equal(t, "registry.k8s.io/kube-proxy:v1.34.0", raw.ClusterConfig.ProxyConfig.ContainerImage)
+	})
+
+	t.Run("worker", func(t *testing.T) {
+		patched, err := patchKubernetesImages(
+			[]byte(testMachineConfiguration("worker", "running", "1.33.5")),
+			[]byte(testMachineConfiguration("worker", "rendered", "1.34.0")),
+		)
+		require.NoError(t, err)
+
+		cfg, err := configloader.NewFromBytes(patched)
+		require.NoError(t, err)
+		raw := cfg.RawV1Alpha1()
+		assert.Equal(t, "running", raw.MachineConfig.MachineNetwork.NetworkHostname)
+		assert.Equal(t, "ghcr.io/siderolabs/kubelet:v1.34.0", raw.MachineConfig.MachineKubelet.KubeletImage)
+		assert.Nil(t, raw.ClusterConfig.APIServerConfig)
+	})
+
+	t.Run("rendered configuration without kubelet image", func(t *testing.T) {
+		_, err := patchKubernetesImages(
+			[]byte(testMachineConfiguration("worker", "running", "1.33.5")),
+			[]byte("version: v1alpha1\nmachine:\n  type: worker\n"),
+		)
+		assert.ErrorIs(t, err, ErrKubernetesImagePatch)
+	})
+
+	t.Run("invalid running configuration", func(t *testing.T) {
+		_, err := patchKubernetesImages([]byte("version: ["), []byte(testMachineConfiguration("worker", "rendered", "1.34.0")))
+		assert.ErrorIs(t, err, ErrKubernetesImagePatch)
+	})
+}
+
+func Test_upgradeKubernetes_unsupportedByRunningTalos(t *testing.T) {
+	talos, kubernetes := newFakeKubernetesCluster(t, "v1.10.5", testKubernetesNodes)
+
+	err := upgradeKubernetes(context.Background(), newTestKubernetesUpgradePlan(talos, kubernetes), "1.34.0", time.Minute, time.Millisecond, func(string) {})
+	assert.ErrorIs(t, err, core.ErrUnsupportedKubernetesVersion)
+	assert.Empty(t, talos.Applies())
+}
+
+func Test_upgradeKubernetes_stopsOnUnhealthyNode(t *testing.T) {
+	talos, kubernetes := newFakeKubernetesCluster(t, "v1.11.3", testKubernetesNodes)
+	kubernetes.SetReady(false)
+
+	err := upgradeKubernetes(context.Background(), newTestKubernetesUpgradePlan(talos, kubernetes), "1.34.0", 50*time.Millisecond, 10*time.Millisecond, func(string) {})
+	assert.ErrorIs(t, err, health.ErrAPIServerNotReady)
+
+	// the rollout stops after the first node
+	assert.Len(t, talos.Applies(), 1)
+}
+
+func Test_newKubernetesUpgradeHook(t *testing.T) {
+	tests := []struct {
+		name        string
+		from        string
+		to          string
+		wantErr     error
+		wantApplies int
+	}{
+		{
+			name:        "version unchanged",
+			from:        "1.34.0",
+			to:          "1.34.0",
+			wantApplies: 0,
+		},
+		{
+			name:        "minor upgrade",
+			from:        "1.33.5",
+			to:          "1.34.0",
+			wantApplies: 4,
+		},
+		{
+			name:    "skips a minor version",
+			from:    "1.32.0",
+			to:      "1.34.0",
+			wantErr: core.ErrUnsupportedKubernetesUpgrade,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			talos, kubernetes := newFakeKubernetesCluster(t, "v1.11.3", testKubernetesNodes)
+			plan := newTestKubernetesUpgradePlan(talos, kubernetes)
+
+			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+				hook := newKubernetesUpgradeHook(ctx, func() (*kubernetesUpgradePlan, error) {
+					return plan, nil
+				}, time.Minute)
+
+				return hook(&pulumi.ResourceHookArgs{
+					OldInputs: environmentInputs(map[string]interface{}{envKubernetesVersion: tt.from}),
+					NewInputs: environmentInputs(map[string]interface{}{envKubernetesVersion: tt.to}),
+				})
+			}, pulumi.WithMocks("project", "stack", mocks(0)))
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Len(t, talos.Applies(), tt.wantApplies)
+		})
+	}
+}
+
+func Test_kubernetesUpgradeTargets(t *testing.T) {
+	assert.Equal(t, []kubernetesUpgradeTarget{
+		{address: "1.0.0.1", internalIP: "10.0.1.1", machineConfiguration: "a"},
+		{address: "1.0.0.2", internalIP: "10.0.1.2", machineConfiguration: "b"},
+	}, kubernetesUpgradeTargets([]string{"1.0.0.1", "10.0.1.1", "a", "1.0.0.2", "10.0.1.2", "b"}))
+	assert.Empty(t, kubernetesUpgradeTargets(nil))
+}
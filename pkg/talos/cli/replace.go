@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/pulumi/pulumi-command/sdk/go/command/local"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+)
+
+// WaitForNodeArgs are the arguments for the NewWaitForNode function
+type WaitForNodeArgs struct {
+	// Hooks wait for the node through the Kubernetes API.
+	// Without hooks, only the lifecycle resource is created.
+	Hooks *TalosHooks
+	// NodeIpv4Address is the IPv4 address of the node
+	NodeIpv4Address pulumi.StringOutput
+	// NodeInternalIP is the IP the node is registered with in Kubernetes
+	NodeInternalIP pulumi.StringOutput
+}
+
+// NewWaitForNode creates a lifecycle resource which is created once the new node is a ready Kubernetes node.
+// Resources which depend on it, e.g. the retirement of the node it replaces, wait for the node.
+func NewWaitForNode(ctx *pulumi.Context, name string, args *WaitForNodeArgs, opts ...pulumi.ResourceOption) (*local.Command, error) {
+	readyOpts := append([]pulumi.ResourceOption{}, opts...)
+	if args.Hooks != nil {
+		readyOpts = append(readyOpts, pulumi.ResourceHooks(&pulumi.ResourceHookBinding{
+			BeforeCreate: []*pulumi.ResourceHook{args.Hooks.Ready},
+		}))
+	}
+
+	return local.NewCommand(ctx, fmt.Sprintf("ready-talos-%s", name), &local.CommandArgs{
+		Environment: pulumi.StringMap{
+			envNodeIP:         args.NodeIpv4Address,
+			envNodeInternalIP: args.NodeInternalIP,
+		},
+		Triggers: pulumi.Array{
+			args.NodeIpv4Address,
+		},
+	}, readyOpts...)
+}
+
+// RetireNodeArgs are the arguments for the NewRetireNode function
+type RetireNodeArgs struct {
+	// Hooks decommission the node through the Talos and Kubernetes API.
+	// Without hooks, only the lifecycle resource is created.
+	Hooks *TalosHooks
+	// NodeIpv4Address is the IPv4 address of the node
+	NodeIpv4Address string
+	// NodeName is the name of the server, which is the name of the Kubernetes node
+	NodeName string
+	// NodeInternalIP is the IP the node is registered with in Kubernetes
+	NodeInternalIP string
+}
+
+// NewRetireNode creates a lifecycle resource which decommissions a replaced node when it is created.
+// The node is drained, reset and its Node object is deleted, its server is deleted later by Pulumi.
+func NewRetireNode(ctx *pulumi.Context, name string, args *RetireNodeArgs, opts ...pulumi.ResourceOption) (*local.Command, error) {
+	retireOpts := append([]pulumi.ResourceOption{}, opts...)
+	if args.Hooks != nil {
+		retireOpts = append(retireOpts, pulumi.ResourceHooks(&pulumi.ResourceHookBinding{
+			BeforeCreate: []*pulumi.ResourceHook{args.Hooks.Retire},
+		}))
+	}
+
+	environment := pulumi.StringMap{
+		envNodeIP:       pulumi.String(args.NodeIpv4Address),
+		envNodeName:     pulumi.String(args.NodeName),
+		envControlPlane: pulumi.String("false"),
+	}
+	if args.NodeInternalIP != "" {
+		environment[envNodeInternalIP] = pulumi.String(args.NodeInternalIP)
+	}
+
+	return local.NewCommand(ctx, fmt.Sprintf("retire-talos-%s", name), &local.CommandArgs{
+		Environment: environment,
+		Triggers: pulumi.Array{
+			pulumi.String(args.NodeIpv4Address),
+		},
+	}, retireOpts...)
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWaitForNode(t *testing.T) {
+	err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+		ready, err := NewWaitForNode(ctx, "cluster-workers-0-abc123", &WaitForNodeArgs{
+			NodeIpv4Address: pulumi.String("1.2.3.4").ToStringOutput(),
+			NodeInternalIP:  pulumi.String("10.0.1.2").ToStringOutput(),
+		})
+		require.NoError(t, err)
+
+		pulumi.All(ready.URN(), ready.Environment).ApplyT(func(args []interface{}) error {
+			assert.Contains(t, string(args[0].(pulumi.URN)), "::ready-talos-cluster-workers-0-abc123")
+			env := args[1].(map[string]string)
+			assert.Equal(t, "1.2.3.4", env[envNodeIP])
+			assert.Equal(t, "10.0.1.2", env[envNodeInternalIP])
+			return nil
+		})
+		return nil
+	}, pulumi.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestNewRetireNode(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    *RetireNodeArgs
+		wantEnv map[string]string
+	}{
+		{
+			name: "node with network",
+			args: &RetireNodeArgs{NodeIpv4Address: "1.2.3.4", NodeName: "workers-0", NodeInternalIP: "10.0.1.2"},
+			wantEnv: map[string]string{
+				envNodeIP:         "1.2.3.4",
+				envNodeName:       "workers-0",
+				envNodeInternalIP: "10.0.1.2",
+				envControlPlane:   "false",
+			},
+		},
+		{
+			name: "node without network",
+			args: &RetireNodeArgs{NodeIpv4Address: "1.2.3.4", NodeName: "workers-0"},
+			wantEnv: map[string]string{
+				envNodeIP:       "1.2.3.4",
+				envNodeName:     "workers-0",
+				envControlPlane: "false",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
+				retire, err := NewRetireNode(ctx, "cluster-workers-0", tt.args)
+				require.NoError(t, err)
+
+				retire.Environment.ApplyT(func(env map[string]string) error {
+					assert.Equal(t, tt.wantEnv, env)
+					return nil
+				})
+				return nil
+			}, pulumi.WithMocks("project", "stack", mocks(0)))
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -1,12 +0,0 @@
-#!/bin/bash
-
-# Write Talos configuration to a file
-echo $TALOSCONFIG_VALUE > $TALOSCONFIG
-
-# Reset the node
-if ! talosctl --talosconfig $TALOSCONFIG -n $NODE_IP reset; then
-  echo "ERROR: Talos reset failed for node $NODE_IP" >&2
-  exit 1
-fi
-
-exit 0
@@ -1,33 +1,18 @@
 package cli
 
 import (
-	_ "embed"
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
 	"github.com/pulumi/pulumi-command/sdk/go/command/local"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 )
 
-//go:embed talos-upgrade-version.sh
-var talosUpgradeScript []byte
-
-//go:embed talos-delete-node.sh
-var talosDeleteScript []byte
-
-const scriptSubdir = ".pulumi-tmp"
-const (
-	dirPerm    = 0o700
-	filePerm   = 0o600
-	scriptPerm = 0o700 // permission for executable scripts
-)
-
 // UpgradeTalosArgs are the arguments for the UpgradeTalos function
 type UpgradeTalosArgs struct {
-	// Talosconfig is the Talos configuration
-	Talosconfig pulumi.StringOutput
+	// Hooks upgrade and reset the node through the Talos API.
+	// Without hooks, only the lifecycle resources are created.
+	Hooks *TalosHooks
 	// TalosVersion is the version of Talos to upgrade to
 	TalosVersion string
 	// Images is the image information for the upgrade
@@ -41,45 +26,33 @@ type UpgradeTalosArgs struct {
 	Protection bool
 	// RemoveNodeFromClusterOnDelete determines whether the node should be removed from the cluster before deletion
 	RemoveNodeFromClusterOnDelete bool
+	// NodeName is the name of the server, which is the name of the Kubernetes node. Used to drain the node on delete.
+	// this is optional and can be nil
+	NodeName pulumi.StringInput
+	// NodeInternalIP is the IP the node is registered with in Kubernetes. Used to find the node if it has another name.
+	// this is optional and can be nil
+	NodeInternalIP pulumi.StringInput
+	// ControlPlane marks control plane nodes, they leave etcd before they are reset
+	ControlPlane bool
+	// LegacyName is the name the node had before resource names were prefixed with the cluster name.
+	// If set, the lifecycle resources are aliased to it, so the node is neither upgraded nor reset again.
+	LegacyName string
+	// LegacyTopLevel marks nodes whose lifecycle resources were created without a parent
+	// before the cluster became a component resource, the aliases then point to the top level.
+	LegacyTopLevel bool
 }
 
-// UpgradeTalos upgrades the Talos version on a node
+// UpgradeTalos upgrades the Talos version on a node.
+// Upgrade and Delete are lifecycle resources without commands, the work is done by the Talos hooks
+// when they are created or deleted.
 type UpgradeTalos struct {
 	Upgrade *local.Command
 	Delete  *local.Command
 }
 
-// DeleteTalosArgs are the arguments for the DeleteTalos function
-type DeleteTalosArgs struct {
-	// Talosconfig is the Talos configuration
-	Talosconfig pulumi.StringOutput
-	// NodeIpv4Address is the IPv4 address of the node
-	NodeIpv4Address pulumi.StringOutput
-}
-
-func TalosConfigPath(ctx *pulumi.Context) string {
-	return fmt.Sprintf("%s.talosconfig.json", ctx.Stack())
-}
-
-// writeScriptToProjectTmp writes the embedded script to a persistent project subfolder and returns its path
-func writeScriptToProjectTmp(name string, content []byte) (string, error) {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", err
-	}
-	dir := filepath.Join(cwd, scriptSubdir)
-	if err := os.MkdirAll(dir, dirPerm); err != nil {
-		return "", err
-	}
-	file := filepath.Join(dir, name)
-	if err := os.WriteFile(file, content, filePerm); err != nil {
-		return "", err
-	}
-	// Set executable permission on the script
-	if err := os.Chmod(file, scriptPerm); err != nil {
-		return "", err
-	}
-	return filepath.Join(scriptSubdir, name), nil
+// InstallerImage returns the Talos installer image of the image factory for the given schematic and version
+func InstallerImage(talosImageID, talosVersion string) string {
+	return fmt.Sprintf("factory.talos.dev/installer/%s:%s", talosImageID, talosVersion)
 }
 
 // UpgradeTalos upgrades the Talos version on a node
@@ -94,28 +67,24 @@ func NewUpgradeTalos(ctx *pulumi.Context, name string, args *UpgradeTalosArgs, o
 		return nil, err
 	}
 
-	upgradeScriptPath, err := writeScriptToProjectTmp("talos-upgrade-version.sh", talosUpgradeScript)
-	if err != nil {
-		return nil, err
+	upgradeOpts := append([]pulumi.ResourceOption{}, opts...)
+	if args.LegacyName != "" {
+		upgradeOpts = append(upgradeOpts, pulumi.Aliases([]pulumi.Alias{legacyAlias("upgrade-talos", args)}))
 	}
-
-	deleteScriptPath, err := writeScriptToProjectTmp("talos-delete-node-from-cluster.sh", talosDeleteScript)
-	if err != nil {
-		return nil, err
+	if args.Hooks != nil {
+		upgradeOpts = append(upgradeOpts, pulumi.ResourceHooks(&pulumi.ResourceHookBinding{
+			BeforeCreate: []*pulumi.ResourceHook{args.Hooks.Upgrade},
+		}))
 	}
 
 	upgrade, err := local.NewCommand(ctx, fmt.Sprintf("upgrade-talos-%s", name), &local.CommandArgs{
-		Create: pulumi.String(upgradeScriptPath),
 		Environment: pulumi.StringMap{
-			"TALOSCONFIG":       pulumi.String(TalosConfigPath(ctx)),
-			"TALOSCONFIG_VALUE": args.Talosconfig,
-			"TALOS_VERSION":     pulumi.String(args.TalosVersion),
-			"TALOS_IMAGE":       pulumi.String(args.Images.TalosImageID),
-			"ARM_IMAGE":         pulumi.Sprintf("%d", armImage.ImageId()),
-			"X86_IMAGE":         pulumi.Sprintf("%d", x86Image.ImageId()),
-			"NODE_NAME":         pulumi.String(name),
-			"NODE_IP":           args.NodeIpv4Address,
-			"NODE_IMAGE": args.NodeImage.ApplyT(func(image *string) string {
+			envTalosVersion:   pulumi.String(args.TalosVersion),
+			envInstallerImage: pulumi.String(InstallerImage(args.Images.TalosImageID, args.TalosVersion)),
+			envARMImage:       pulumi.Sprintf("%d", armImage.ImageId()),
+			envX86Image:       pulumi.Sprintf("%d", x86Image.ImageId()),
+			envNodeIP:         args.NodeIpv4Address,
+			envNodeImage: args.NodeImage.ApplyT(func(image *string) string {
 				return *image
 			}).(pulumi.StringOutput),
 		},
@@ -126,24 +95,40 @@ func NewUpgradeTalos(ctx *pulumi.Context, name string, args *UpgradeTalosArgs, o
 			args.NodeIpv4Address,
 			args.NodeImage,
 		},
-	}, opts...)
+	}, upgradeOpts...)
 	if err != nil {
 		return nil, err
 	}
 
 	var delete *local.Command
 	if args.RemoveNodeFromClusterOnDelete {
+		deleteOpts := append([]pulumi.ResourceOption{}, opts...)
+		if args.LegacyName != "" {
+			deleteOpts = append(deleteOpts, pulumi.Aliases([]pulumi.Alias{legacyAlias("delete-talos", args)}))
+		}
+		if args.Hooks != nil {
+			deleteOpts = append(deleteOpts, pulumi.ResourceHooks(&pulumi.ResourceHookBinding{
+				BeforeDelete: []*pulumi.ResourceHook{args.Hooks.Reset},
+			}))
+		}
+
+		environment := pulumi.StringMap{
+			envNodeIP:       args.NodeIpv4Address,
+			envControlPlane: pulumi.Sprintf("%t", args.ControlPlane),
+		}
+		if args.NodeName != nil {
+			environment[envNodeName] = args.NodeName
+		}
+		if args.NodeInternalIP != nil {
+			environment[envNodeInternalIP] = args.NodeInternalIP
+		}
+
 		delete, err = local.NewCommand(ctx, fmt.Sprintf("delete-talos-%s", name), &local.CommandArgs{
-			Delete: pulumi.String(deleteScriptPath),
-			Environment: pulumi.StringMap{
-				"TALOSCONFIG":       pulumi.String(TalosConfigPath(ctx)),
-				"TALOSCONFIG_VALUE": args.Talosconfig,
-				"NODE_IP":           args.NodeIpv4Address,
-			},
+			Environment: environment,
 			Triggers: pulumi.Array{
 				args.NodeIpv4Address,
 			},
-		}, opts...)
+		}, deleteOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -154,3 +139,13 @@ func NewUpgradeTalos(ctx *pulumi.Context, name string, args *UpgradeTalosArgs, o
 		Delete:  delete,
 	}, nil
 }
+
+// legacyAlias returns the alias of a lifecycle resource with the given prefix to the legacy name of the node
+func legacyAlias(prefix string, args *UpgradeTalosArgs) pulumi.Alias {
+	alias := pulumi.Alias{Name: pulumi.Sprintf("%s-%s", prefix, args.LegacyName)}
+	if args.LegacyTopLevel {
+		alias.NoParent = pulumi.Bool(true)
+	}
+
+	return alias
+}
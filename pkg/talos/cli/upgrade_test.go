@@ -1,8 +1,6 @@
 package cli
 
 import (
-	_ "embed"
-	"path/filepath"
 	"testing"
 
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/image"
@@ -25,73 +23,6 @@ func (mocks) Call(args pulumi.MockCallArgs) (resource.PropertyMap, error) {
 	return resource.NewPropertyMapFromMap(outputs), nil
 }
 
-func TestTalosConfigPath(t *testing.T) {
-	type args struct {
-		project string
-		stack   string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{
-			name: "default",
-			args: args{
-				project: "test-project",
-				stack:   "test-stack",
-			},
-			want: "test-stack.talosconfig.json",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := pulumi.RunErr(func(ctx *pulumi.Context) error {
-				if got := TalosConfigPath(ctx); got != tt.want {
-					t.Errorf("TalosConfigPath() = %v, want %v", got, tt.want)
-				}
-				return nil
-			}, pulumi.WithMocks(tt.args.project, tt.args.stack, mocks(0)))
-			assert.NoError(t, err)
-		})
-	}
-}
-
-func Test_writeScriptToProjectTmp(t *testing.T) {
-	type args struct {
-		name    string
-		content []byte
-	}
-	tests := []struct {
-		name    string
-		args    args
-		want    string
-		wantErr bool
-	}{
-		{
-			name: "default",
-			args: args{
-				name:    "talos-upgrade-version.sh",
-				content: []byte("test content"),
-			},
-			want:    filepath.Join(".pulumi-tmp", "talos-upgrade-version.sh"),
-			wantErr: false,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got, err := writeScriptToProjectTmp(tt.args.name, tt.args.content)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("writeScriptToProjectTmp() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if got != tt.want {
-				t.Errorf("writeScriptToProjectTmp() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestNewUpgradeTalos(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -119,7 +50,6 @@ func TestNewUpgradeTalos(t *testing.T) {
 				}
 
 				return &UpgradeTalosArgs{
-					Talosconfig:                   pulumi.Sprintf("talosconfig-content"),
 					TalosVersion:                  "v1.2.3",
 					Images:                        images,
 					NodeIpv4Address:               pulumi.Sprintf("1.2.3.4"),
@@ -132,12 +62,11 @@ func TestNewUpgradeTalos(t *testing.T) {
 				assert.Nil(t, result.Delete)
 				pulumi.All(result.Upgrade.Environment).ApplyT(func(args []interface{}) error {
 					env := args[0].(map[string]string)
-					assert.Equal(t, "talosconfig-content", env["TALOSCONFIG_VALUE"])
+					assert.NotContains(t, env, "TALOSCONFIG_VALUE")
 					assert.Equal(t, "v1.2.3", env["TALOS_VERSION"])
-					assert.Equal(t, "v1.0.0", env["TALOS_IMAGE"])
+					assert.Equal(t, "factory.talos.dev/installer/v1.0.0:v1.2.3", env["INSTALLER_IMAGE"])
 					assert.Equal(t, "12345", env["ARM_IMAGE"])
 					assert.Equal(t, "12345", env["X86_IMAGE"])
-					assert.Equal(t, "test-node", env["NODE_NAME"])
 					assert.Equal(t, "1.2.3.4", env["NODE_IP"])
 					assert.Equal(t, "node-image", env["NODE_IMAGE"])
 					return nil
@@ -164,7 +93,6 @@ func TestNewUpgradeTalos(t *testing.T) {
 				}
 
 				return &UpgradeTalosArgs{
-					Talosconfig:                   pulumi.Sprintf("talosconfig-content"),
 					TalosVersion:                  "v1.2.3",
 					Images:                        images,
 					NodeIpv4Address:               pulumi.Sprintf("1.2.3.4"),
@@ -177,7 +105,7 @@ func TestNewUpgradeTalos(t *testing.T) {
 				assert.NotNil(t, result.Delete)
 				pulumi.All(result.Delete.Environment).ApplyT(func(args []interface{}) error {
 					env := args[0].(map[string]string)
-					assert.Equal(t, "talosconfig-content", env["TALOSCONFIG_VALUE"])
+					assert.NotContains(t, env, "TALOSCONFIG_VALUE")
 					assert.Equal(t, "1.2.3.4", env["NODE_IP"])
 					return nil
 				})
@@ -0,0 +1,41 @@
+package volume
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// SwapVolumeConfig represents a swap volume.
+// Generated based on Talos v1.12 documentation:
+// https://docs.siderolabs.com/talos/v1.12/reference/configuration/block/swapvolumeconfig
+type SwapVolumeConfig struct {
+	APIVersion   string            `yaml:"apiVersion" validate:"required,eq=v1alpha1"`
+	Kind         string            `yaml:"kind" validate:"required,eq=SwapVolumeConfig"`
+	Name         string            `yaml:"name" validate:"required,max=34"`
+	Provisioning *ProvisioningSpec `yaml:"provisioning" validate:"required"`
+	Encryption   *EncryptionSpec   `yaml:"encryption,omitempty" validate:"omitempty"`
+}
+
+// YAML marshals the SwapVolumeConfig to YAML.
+func (svc *SwapVolumeConfig) YAML() (string, error) {
+	// Ensure APIVersion and Kind are set
+	if svc.APIVersion == "" {
+		svc.APIVersion = "v1alpha1"
+	}
+	if svc.Kind == "" {
+		svc.Kind = "SwapVolumeConfig"
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(svc); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+
+	out, err := yaml.Marshal(svc)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal SwapVolumeConfig: %w", err)
+	}
+	return string(out), nil
+}
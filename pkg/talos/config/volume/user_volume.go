@@ -0,0 +1,48 @@
+package volume
+
+import (
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// UserVolumeConfig represents a user volume, which is mounted at /var/mnt/<name>.
+// Generated based on Talos v1.12 documentation:
+// https://docs.siderolabs.com/talos/v1.12/reference/configuration/block/uservolumeconfig
+type UserVolumeConfig struct {
+	APIVersion   string            `yaml:"apiVersion" validate:"required,eq=v1alpha1"`
+	Kind         string            `yaml:"kind" validate:"required,eq=UserVolumeConfig"`
+	Name         string            `yaml:"name" validate:"required,max=34"`
+	VolumeType   string            `yaml:"volumeType,omitempty" validate:"omitempty,oneof=partition disk directory"`
+	Provisioning *ProvisioningSpec `yaml:"provisioning,omitempty" validate:"omitempty"`
+	Filesystem   *FilesystemSpec   `yaml:"filesystem,omitempty" validate:"omitempty"`
+	Encryption   *EncryptionSpec   `yaml:"encryption,omitempty" validate:"omitempty"`
+}
+
+// FilesystemSpec describes how the volume is formatted.
+type FilesystemSpec struct {
+	Type string `yaml:"type,omitempty" validate:"omitempty,oneof=xfs ext4"`
+}
+
+// YAML marshals the UserVolumeConfig to YAML.
+func (uvc *UserVolumeConfig) YAML() (string, error) {
+	// Ensure APIVersion and Kind are set
+	if uvc.APIVersion == "" {
+		uvc.APIVersion = "v1alpha1"
+	}
+	if uvc.Kind == "" {
+		uvc.Kind = "UserVolumeConfig"
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(uvc); err != nil {
+		return "", fmt.Errorf("validation failed: %w", err)
+	}
+
+	out, err := yaml.Marshal(uvc)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal UserVolumeConfig: %w", err)
+	}
+	return string(out), nil
+}
@@ -16,7 +16,7 @@ import (
 type VolumeConfig struct {
 	APIVersion   string            `yaml:"apiVersion" validate:"required,eq=v1alpha1"`
 	Kind         string            `yaml:"kind" validate:"required,eq=VolumeConfig"`
-	Name         string            `yaml:"name" validate:"required,oneof=STATE EPHEMERAL IMAGE-CACHE"`
+	Name         string            `yaml:"name" validate:"required,oneof=STATE EPHEMERAL IMAGECACHE"`
 	Provisioning *ProvisioningSpec `yaml:"provisioning,omitempty" validate:"omitempty"`
 	Encryption   *EncryptionSpec   `yaml:"encryption,omitempty" validate:"omitempty"`
 }
@@ -24,7 +24,7 @@ type VolumeConfig struct {
 // ProvisioningSpec describes how the volume is provisioned.
 type ProvisioningSpec struct {
 	DiskSelector *DiskSelector `yaml:"diskSelector,omitempty" validate:"omitempty"`
-	Grow         bool          `yaml:"grow,omitempty"`
+	Grow         *bool         `yaml:"grow,omitempty"`
 	MinSize      string        `yaml:"minSize,omitempty"` // ByteSize
 	MaxSize      string        `yaml:"maxSize,omitempty"` // Size
 }
@@ -75,7 +75,7 @@ type EncryptionKeyTPM struct {
 
 // EncryptionKeyTPMOptions represents the options for TPM-based key protection.
 type EncryptionKeyTPMOptions struct {
-	PCRs []int `yaml:"pcrs,omitempty"`
+	PCRs []int `yaml:"pcrs"`
 }
 
 // YAML marshals the VolumeConfig to YAML.
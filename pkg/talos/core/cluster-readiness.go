@@ -0,0 +1,320 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	core_config "github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/pulumi/pulumi-command/sdk/go/command/local"
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
+	"github.com/pulumiverse/pulumi-talos/sdk/go/talos/cluster"
+	"github.com/pulumiverse/pulumi-talos/sdk/go/talos/machine"
+)
+
+var (
+	// ErrClusterNotReady is returned when the cluster did not become healthy within the configured attempts
+	ErrClusterNotReady = errors.New("cluster did not become ready")
+	// ErrAPIServerNotReady is returned when the Kubernetes API server answers with a server error
+	ErrAPIServerNotReady = errors.New("kubernetes API server is not ready")
+	// ErrInvalidCACertificate is returned when the Kubernetes CA certificate can not be parsed
+	ErrInvalidCACertificate = errors.New("invalid kubernetes CA certificate")
+	// ErrReadinessCredentialsUnavailable is returned when the cluster credentials did not resolve in time
+	ErrReadinessCredentialsUnavailable = errors.New("cluster credentials unavailable")
+)
+
+const (
+	// apiServerProbeTimeout is the timeout of a single request against the Kubernetes API server
+	apiServerProbeTimeout = 10 * time.Second
+	// readinessCredentialsTimeout is the maximum wait for the cluster credentials when the readiness hook is triggered
+	readinessCredentialsTimeout = 5 * time.Minute
+)
+
+// Environment keys of the readiness resource, read by the readiness hook
+const (
+	envTalosEndpoints    = "TALOS_ENDPOINTS"
+	envControlPlaneNodes = "CONTROL_PLANE_NODES"
+	envWorkerNodes       = "WORKER_NODES"
+	envTalosVersion      = "TALOS_VERSION"
+	envKubernetesVersion = "KUBERNETES_VERSION"
+)
+
+type ClusterReadinessArgs struct {
+	// Secrets are the Talos Linux secrets for the cluster, used to authenticate against the Talos API
+	Secrets *machine.Secrets
+	// Kubeconfig is the kubeconfig of the cluster, its host is probed to check the API server through the cluster endpoint
+	Kubeconfig *Kubeconfig
+	// Endpoints are the Talos API endpoints, usually the public IPs of the control plane nodes
+	Endpoints []pulumi.StringOutput
+	// ControlPlaneNodes are the private IPs of the control plane nodes, as registered in Kubernetes
+	ControlPlaneNodes []pulumi.StringOutput
+	// WorkerNodes are the private IPs of the worker nodes, as registered in Kubernetes
+	WorkerNodes []pulumi.StringOutput
+	// TalosVersion is the Talos version of the cluster, the cluster is checked again when it changes
+	TalosVersion string
+	// KubernetesVersion is the Kubernetes version of the cluster, the cluster is checked again when it changes
+	KubernetesVersion string
+	// DependsOn are resources which must be finished before the health checks start, like Talos upgrades
+	DependsOn []pulumi.Resource
+	// Config holds the timeout and retry settings of the readiness gate
+	Config core_config.ReadinessConfig
+}
+
+// ClusterReadiness gates the Kubernetes phase of a deployment until the cluster is healthy.
+type ClusterReadiness struct {
+	// Kubeconfig is the raw kubeconfig of the cluster
+	Kubeconfig pulumi.StringOutput
+	// Gate is a lifecycle resource without commands, a before create and before update hook waits until the cluster is healthy.
+	// Resources using the Kubernetes API must depend on it. It is nil if the readiness gate is disabled.
+	Gate *local.Command
+}
+
+// NewClusterReadiness creates a readiness gate for the cluster.
+// The Talos health checks (etcd members, kubelet and all nodes ready) are polled and the Kubernetes
+// API server is probed through the cluster endpoint. Failed checks are retried as configured.
+// The checks run when the gate is created and whenever the nodes or versions of the cluster change.
+func NewClusterReadiness(ctx *pulumi.Context, name string, args *ClusterReadinessArgs, opts ...pulumi.ResourceOption) (*ClusterReadiness, error) {
+	if args.Config.Disabled {
+		return &ClusterReadiness{
+			Kubeconfig: args.Kubeconfig.KubeconfigRaw,
+		}, nil
+	}
+
+	// the durations are validated with the configuration
+	timeout, err := time.ParseDuration(args.Config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid readiness timeout: %w", err)
+	}
+
+	retryInterval, err := time.ParseDuration(args.Config.RetryInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid readiness retry interval: %w", err)
+	}
+
+	hook, err := ctx.RegisterResourceHook(fmt.Sprintf("%s-cluster-readiness", name),
+		newReadinessHook(ctx, newReadinessCredentialsSource(args), args.Config.Retries, timeout, retryInterval), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	gate, err := local.NewCommand(ctx, fmt.Sprintf("%s-cluster-readiness", name), &local.CommandArgs{
+		Environment: pulumi.StringMap{
+			envTalosEndpoints:    joinAddresses(args.Endpoints),
+			envControlPlaneNodes: joinAddresses(args.ControlPlaneNodes),
+			envWorkerNodes:       joinAddresses(args.WorkerNodes),
+			envTalosVersion:      pulumi.String(args.TalosVersion),
+			envKubernetesVersion: pulumi.String(args.KubernetesVersion),
+		},
+	}, append(opts,
+		pulumi.DependsOn(args.DependsOn),
+		pulumi.ResourceHooks(&pulumi.ResourceHookBinding{
+			BeforeCreate: []*pulumi.ResourceHook{hook},
+			BeforeUpdate: []*pulumi.ResourceHook{hook},
+		}),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClusterReadiness{
+		Kubeconfig: args.Kubeconfig.KubeconfigRaw,
+		Gate:       gate,
+	}, nil
+}
+
+// readinessCredentials are the credentials of the readiness checks, resolved in memory
+type readinessCredentials struct {
+	host                    string
+	kubernetesCACertificate string
+	caCertificate           string
+	clientCertificate       string
+	clientKey               string
+}
+
+// readinessCredentialsSource returns the resolved readiness credentials
+type readinessCredentialsSource func() (*readinessCredentials, error)
+
+// newReadinessCredentialsSource resolves the readiness credentials in memory.
+// The returned source blocks until the outputs are resolved.
+func newReadinessCredentialsSource(args *ClusterReadinessArgs) readinessCredentialsSource {
+	resolved := make(chan *readinessCredentials, 1)
+
+	clientConfiguration := args.Secrets.ClientConfiguration
+	pulumi.All(
+		args.Kubeconfig.Host,
+		args.Kubeconfig.Kubeconfig.KubernetesClientConfiguration.CaCertificate(),
+		clientConfiguration.CaCertificate(),
+		clientConfiguration.ClientCertificate(),
+		clientConfiguration.ClientKey(),
+	).ApplyT(func(v []interface{}) error {
+		resolved <- &readinessCredentials{
+			host:                    v[0].(string),
+			kubernetesCACertificate: stringFromPtr(v[1].(*string)),
+			caCertificate:           v[2].(string),
+			clientCertificate:       v[3].(string),
+			clientKey:               v[4].(string),
+		}
+		return nil
+	})
+
+	var mu sync.Mutex
+	var credentials *readinessCredentials
+	return func() (*readinessCredentials, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if credentials != nil {
+			return credentials, nil
+		}
+
+		select {
+		case credentials = <-resolved:
+			return credentials, nil
+		case <-time.After(readinessCredentialsTimeout):
+			return nil, ErrReadinessCredentialsUnavailable
+		}
+	}
+}
+
+// newReadinessHook returns the hook function which waits until the cluster of the readiness resource is healthy
+func newReadinessHook(ctx *pulumi.Context, credentialsSource readinessCredentialsSource, retries int, timeout, retryInterval time.Duration) pulumi.ResourceHookFunction {
+	return func(args *pulumi.ResourceHookArgs) error {
+		credentials, err := credentialsSource()
+		if err != nil {
+			return err
+		}
+
+		healthArgs := &cluster.GetHealthArgs{
+			ClientConfiguration: cluster.GetHealthClientConfiguration{
+				CaCertificate:     credentials.caCertificate,
+				ClientCertificate: credentials.clientCertificate,
+				ClientKey:         credentials.clientKey,
+			},
+			Endpoints:         readinessAddresses(args.NewInputs, envTalosEndpoints),
+			ControlPlaneNodes: readinessAddresses(args.NewInputs, envControlPlaneNodes),
+			WorkerNodes:       readinessAddresses(args.NewInputs, envWorkerNodes),
+			Timeouts: &cluster.GetHealthTimeouts{
+				Read: pulumi.StringRef(timeout.String()),
+			},
+		}
+
+		err = waitUntilReady(retries, retryInterval, func() error {
+			if _, err := cluster.GetHealth(ctx, healthArgs); err != nil {
+				return err
+			}
+			return probeAPIServer(credentials.host, credentials.kubernetesCACertificate)
+		}, func(attempt int, err error) {
+			_ = ctx.Log.Warn(fmt.Sprintf("cluster not ready yet (attempt %d/%d), retrying in %s: %s", attempt, retries, retryInterval, err), nil)
+		})
+		if err != nil {
+			return err
+		}
+
+		_ = ctx.Log.Info("cluster is ready", nil)
+		return nil
+	}
+}
+
+// joinAddresses joins the addresses into a single comma separated output
+func joinAddresses(addresses []pulumi.StringOutput) pulumi.StringOutput {
+	return pulumi.ToStringArrayOutput(addresses).ApplyT(func(v []string) string {
+		return strings.Join(v, ",")
+	}).(pulumi.StringOutput)
+}
+
+// readinessAddresses reads a comma separated list of addresses of the "environment" input of the readiness resource
+func readinessAddresses(inputs resource.PropertyMap, key string) []string {
+	env := inputs["environment"]
+	if env.IsSecret() {
+		env = env.SecretValue().Element
+	}
+	if !env.IsObject() {
+		return nil
+	}
+
+	value := env.ObjectValue()[resource.PropertyKey(key)]
+	if value.IsSecret() {
+		value = value.SecretValue().Element
+	}
+	if !value.IsString() || value.StringValue() == "" {
+		return nil
+	}
+
+	return strings.Split(value.StringValue(), ",")
+}
+
+// waitUntilReady runs the check until it succeeds or all attempts are used up.
+// onRetry is called after every failed attempt which is followed by another one.
+func waitUntilReady(attempts int, interval time.Duration, check func() error, onRetry func(attempt int, err error)) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = check(); err == nil {
+			return nil
+		}
+
+		if attempt < attempts {
+			onRetry(attempt, err)
+			time.Sleep(interval)
+		}
+	}
+
+	return fmt.Errorf("%w after %d attempts: %w", ErrClusterNotReady, attempts, err)
+}
+
+// probeAPIServer checks that the Kubernetes API server is reachable through the given host and ready to serve requests.
+// The CA certificate is expected base64 encoded, as provided by the Talos kubeconfig.
+func probeAPIServer(host, caCertificate string) error {
+	rootCAs := x509.NewCertPool()
+	caPEM, err := base64.StdEncoding.DecodeString(caCertificate)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidCACertificate, err)
+	}
+	if !rootCAs.AppendCertsFromPEM(caPEM) {
+		return ErrInvalidCACertificate
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    rootCAs,
+				MinVersion: tls.VersionTLS12,
+			},
+		},
+	}
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), apiServerProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, strings.TrimSuffix(host, "/")+"/readyz", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Anonymous requests may be rejected, but the API server answered, so it is reachable
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %s responded with %s", ErrAPIServerNotReady, host, resp.Status)
+	}
+
+	return nil
+}
+
+func stringFromPtr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pulumi/pulumi/sdk/v3/go/common/resource"
+	"github.com/stretchr/testify/assert"
+)
+
+var errCheckFailed = errors.New("check failed")
+
+func Test_waitUntilReady(t *testing.T) {
+	tests := []struct {
+		name        string
+		attempts    int
+		failures    int
+		wantCalls   int
+		wantRetries int
+		wantErr     bool
+	}{
+		{
+			name:        "ready on first attempt",
+			attempts:    3,
+			failures:    0,
+			wantCalls:   1,
+			wantRetries: 0,
+		},
+		{
+			name:        "ready after retries",
+			attempts:    3,
+			failures:    2,
+			wantCalls:   3,
+			wantRetries: 2,
+		},
+		{
+			name:        "never ready",
+			attempts:    3,
+			failures:    5,
+			wantCalls:   3,
+			wantRetries: 2,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			retries := 0
+			err := waitUntilReady(tt.attempts, 0, func() error {
+				calls++
+				if calls <= tt.failures {
+					return errCheckFailed
+				}
+				return nil
+			}, func(_ int, _ error) {
+				retries++
+			})
+
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, tt.wantRetries, retries)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrClusterNotReady)
+				assert.ErrorIs(t, err, errCheckFailed)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_probeAPIServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		wantErr    error
+	}{
+		{
+			name:       "ready",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "unauthorized but reachable",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "not ready",
+			statusCode: http.StatusServiceUnavailable,
+			wantErr:    ErrAPIServerNotReady,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/readyz", r.URL.Path)
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer server.Close()
+
+			caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+			err := probeAPIServer(server.URL, base64.StdEncoding.EncodeToString(caPEM))
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_probeAPIServer_invalidCACertificate(t *testing.T) {
+	err := probeAPIServer("https://127.0.0.1:6443", base64.StdEncoding.EncodeToString([]byte("invalid")))
+	assert.ErrorIs(t, err, ErrInvalidCACertificate)
+}
+
+func Test_readinessAddresses(t *testing.T) {
+	inputs := resource.NewPropertyMapFromMap(map[string]interface{}{
+		"environment": map[string]interface{}{
+			envTalosEndpoints:    "203.0.113.1,203.0.113.2",
+			envControlPlaneNodes: "10.0.0.2",
+			envWorkerNodes:       "",
+		},
+	})
+
+	assert.Equal(t, []string{"203.0.113.1", "203.0.113.2"}, readinessAddresses(inputs, envTalosEndpoints))
+	assert.Equal(t, []string{"10.0.0.2"}, readinessAddresses(inputs, envControlPlaneNodes))
+	assert.Nil(t, readinessAddresses(inputs, envWorkerNodes))
+	assert.Nil(t, readinessAddresses(resource.PropertyMap{}, envWorkerNodes))
+}
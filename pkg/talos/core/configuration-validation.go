@@ -0,0 +1,175 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/siderolabs/crypto/x509"
+	talosconfig "github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/configpatcher"
+	"github.com/siderolabs/talos/pkg/machinery/config/container"
+	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate/secrets"
+	"github.com/siderolabs/talos/pkg/machinery/config/machine"
+	"github.com/siderolabs/talos/pkg/machinery/config/types/block"
+	"github.com/siderolabs/talos/pkg/machinery/config/validation"
+)
+
+var (
+	// ErrInvalidMachineConfiguration is returned when a generated machine configuration is rejected by Talos
+	ErrInvalidMachineConfiguration = errors.New("invalid Talos machine configuration")
+)
+
+const (
+	// validationEndpoint is the cluster endpoint of the validated configurations.
+	// The real endpoint is not known before the control plane load balancer exists.
+	validationEndpoint = "https://cluster.invalid:6443"
+	// RedactedValue replaces the secrets in rendered configurations
+	RedactedValue = "******"
+)
+
+// cloudMode is the runtime mode of Talos on Hetzner Cloud servers
+type cloudMode struct{}
+
+func (cloudMode) String() string        { return "cloud" }
+func (cloudMode) RequiresInstall() bool { return false }
+func (cloudMode) InContainer() bool     { return false }
+
+// MachineConfigurationValidator validates machine configurations offline, before any node is created or changed.
+// The configurations are checked by the Talos machinery like `talos_machine_configuration_apply` does it on the node.
+type MachineConfigurationValidator struct {
+	input *generate.Input
+}
+
+// NewMachineConfigurationValidator creates a validator for the configurations of the Talos and Kubernetes version.
+// The base configuration is generated with redacted secrets for the version contract of the Talos version,
+// the real secrets are only known to the Talos provider.
+func NewMachineConfigurationValidator(talosVersion, kubernetesVersion string) (*MachineConfigurationValidator, error) {
+	contract, err := talosconfig.ParseContractFromVersion(talosVersion)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidVersion, err)
+	}
+
+	input, err := generate.NewInput("validation", validationEndpoint, kubernetesVersion, generate.WithVersionContract(contract), generate.WithSecretsBundle(redactedSecretsBundle()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the Talos base configuration: %w", err)
+	}
+
+	return &MachineConfigurationValidator{input: input}, nil
+}
+
+// Validate applies the config patches of a node to the base configuration and validates the result in mode cloud.
+// Unknown fields, e.g. typos or fields removed in the Talos version, are rejected when the patches are loaded.
+func (v *MachineConfigurationValidator) Validate(nodeType meta.ServerNodeType, configPatches []string) error {
+	_, err := v.configuration(nodeType, configPatches)
+	return err
+}
+
+// Render returns the validated machine configuration of a node as YAML, all secrets are replaced by RedactedValue.
+// The endpoint of the cluster is a placeholder as well.
+func (v *MachineConfigurationValidator) Render(nodeType meta.ServerNodeType, configPatches []string) (string, error) {
+	cfg, err := v.configuration(nodeType, configPatches)
+	if err != nil {
+		return "", err
+	}
+
+	redacted, err := redactVolumePassphrases(cfg.RedactSecrets(RedactedValue))
+	if err != nil {
+		return "", err
+	}
+
+	rendered, err := redacted.EncodeString(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the Talos machine configuration: %w", err)
+	}
+
+	return rendered, nil
+}
+
+// configuration applies the config patches of a node to the base configuration and validates the result
+func (v *MachineConfigurationValidator) configuration(nodeType meta.ServerNodeType, configPatches []string) (talosconfig.Provider, error) {
+	machineType, err := machine.ParseType(string(nodeType))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMachineConfiguration, err)
+	}
+
+	base, err := v.input.Config(machineType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the Talos base configuration: %w", err)
+	}
+
+	patches, err := configpatcher.LoadPatches(configPatches)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMachineConfiguration, err)
+	}
+
+	patched, err := configpatcher.Apply(configpatcher.WithConfig(base), patches)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to apply patches: %w", ErrInvalidMachineConfiguration, err)
+	}
+
+	cfg, err := patched.Config()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMachineConfiguration, err)
+	}
+
+	_, err = cfg.Validate(cloudMode{}, validation.WithLocal())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMachineConfiguration, err)
+	}
+
+	return cfg, nil
+}
+
+// redactVolumePassphrases replaces the static passphrases of the volume encryption keys by RedactedValue,
+// volume configurations are not redacted by Talos.
+func redactVolumePassphrases(cfg talosconfig.Provider) (talosconfig.Provider, error) {
+	documents := cfg.Documents()
+	for i, document := range documents {
+		volumeConfig, ok := document.(*block.VolumeConfigV1Alpha1)
+		if !ok {
+			continue
+		}
+
+		volumeConfig = volumeConfig.DeepCopy()
+		for j, key := range volumeConfig.EncryptionSpec.EncryptionKeys {
+			if key.KeyStatic != nil {
+				volumeConfig.EncryptionSpec.EncryptionKeys[j].KeyStatic.KeyData = RedactedValue
+			}
+		}
+		documents[i] = volumeConfig
+	}
+
+	redacted, err := container.New(documents...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redact the Talos machine configuration: %w", err)
+	}
+
+	return redacted, nil
+}
+
+// redactedSecretsBundle returns a secrets bundle with RedactedValue as every secret and certificate,
+// which keeps the rendered configurations free of secrets and stable between renders.
+func redactedSecretsBundle() *secrets.Bundle {
+	certificateAndKey := func() *x509.PEMEncodedCertificateAndKey {
+		return &x509.PEMEncodedCertificateAndKey{Crt: []byte(RedactedValue), Key: []byte(RedactedValue)}
+	}
+
+	return &secrets.Bundle{
+		Cluster: &secrets.Cluster{ID: RedactedValue, Secret: RedactedValue},
+		Secrets: &secrets.Secrets{
+			BootstrapToken:            RedactedValue,
+			SecretboxEncryptionSecret: RedactedValue,
+		},
+		TrustdInfo: &secrets.TrustdInfo{Token: RedactedValue},
+		Certs: &secrets.Certs{
+			Etcd:              certificateAndKey(),
+			K8s:               certificateAndKey(),
+			K8sAggregator:     certificateAndKey(),
+			K8sServiceAccount: &x509.PEMEncodedKey{Key: []byte(RedactedValue)},
+			OS:                certificateAndKey(),
+		},
+	}
+}
@@ -0,0 +1,218 @@
+package core
+
+import (
+	"testing"
+
+	core_config "github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMachineConfigurationValidator_Validate(t *testing.T) {
+	validator, err := NewMachineConfigurationValidator("v1.11.3", "1.34.0")
+	require.NoError(t, err)
+
+	generated := func(args *NodeConfigurationArgs) []string {
+		configs, err := NewNodeConfiguration(args)
+		require.NoError(t, err)
+		return configs
+	}
+
+	tests := []struct {
+		name     string
+		nodeType meta.ServerNodeType
+		patches  []string
+		wantErr  string
+	}{
+		{
+			name:     "generated control plane configuration",
+			nodeType: meta.ControlPlaneNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType:        meta.ControlPlaneNode,
+				Subnet:                "10.128.1.0/24",
+				PodSubnets:            "172.20.0.0/16",
+				NodeLabels:            map[string]string{"role": "control"},
+				NodeTaints:            []core_config.Taint{{Key: "dedicated", Value: "cp", Effect: "NoSchedule"}},
+				EnableLonghornSupport: true,
+				LocalStorageFolders:   []string{"/var/mnt/local"},
+				EnableKubeSpan:        true,
+				CNI:                   &core_config.CNIConfig{Name: core_config.CNICilium},
+				InlineManifests:       []core_config.ClusterInlineManifest{{Name: "example", Contents: "kind: Namespace"}},
+				Registries: &core_config.RegistriesConfig{
+					Mirrors: map[string]core_config.RegistryMirrorConfig{"docker.io": {Endpoints: []string{"https://mirror.gcr.io"}}},
+				},
+				DiskEncryption: &core_config.DiskEncryptionConfig{
+					EncryptState: true,
+					Keys:         []core_config.EncryptionKeyConfig{{Slot: 0, NodeID: &core_config.EncryptionKeyNodeID{}}},
+				},
+			}),
+		},
+		{
+			name:     "generated worker configuration",
+			nodeType: meta.WorkerNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+				Proxy:          &core_config.ProxyConfig{Mode: "ipvs"},
+			}),
+		},
+		{
+			name:     "generated disk encryption key types",
+			nodeType: meta.WorkerNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+				DiskEncryption: &core_config.DiskEncryptionConfig{
+					EncryptState:     true,
+					EncryptEphemeral: true,
+					Cipher:           "xchacha20,aes-adiantum-plain64",
+					KeySize:          256,
+					Keys: []core_config.EncryptionKeyConfig{
+						{Slot: 0, Static: &core_config.EncryptionKeyStatic{Passphrase: "passphrase"}},
+						{Slot: 1, KMS: &core_config.EncryptionKeyKMS{Endpoint: "https://10.128.1.10:4050"}, LockToState: true},
+						{Slot: 2, TPM: &core_config.EncryptionKeyTPM{PCRs: []int{7}}},
+					},
+				},
+			}),
+		},
+		{
+			name:     "generated volumes",
+			nodeType: meta.WorkerNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+				Volumes:        []core_config.NodeVolumeConfig{{Name: "longhorn", Size: 100, Format: "ext4"}},
+			}),
+		},
+		{
+			name:     "generated ephemeral and image cache",
+			nodeType: meta.ControlPlaneNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.ControlPlaneNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+				Ephemeral:      &core_config.EphemeralConfig{MinSize: "20GiB", MaxSize: "80%"},
+				ImageCache:     &core_config.ImageCacheConfig{Enabled: true, MaxSize: "2GiB"},
+			}),
+		},
+		{
+			name:     "generated swap",
+			nodeType: meta.WorkerNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+				Ephemeral:      &core_config.EphemeralConfig{MaxSize: "30GiB"},
+				Swap:           &core_config.SwapConfig{Size: "4GiB", Encrypted: true, Behavior: "LimitedSwap"},
+			}),
+		},
+		{
+			name:     "generated control plane VIP",
+			nodeType: meta.ControlPlaneNode,
+			patches: append(generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.ControlPlaneNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+			}), vipConfigPatch(t)),
+		},
+		{
+			name:     "invalid ephemeral size",
+			nodeType: meta.WorkerNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+				Ephemeral:      &core_config.EphemeralConfig{MaxSize: "lots"},
+			}),
+			wantErr: "VolumeConfig",
+		},
+		{
+			name:     "invalid volume name",
+			nodeType: meta.WorkerNode,
+			patches: generated(&NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.128.1.0/24",
+				PodSubnets:     "172.20.0.0/16",
+				Volumes:        []core_config.NodeVolumeConfig{{Name: "local_data", Size: 100, Format: "xfs"}},
+			}),
+			wantErr: "name can only contain",
+		},
+		{
+			name:     "json6902 patch",
+			nodeType: meta.WorkerNode,
+			patches:  []string{"- op: add\n  path: /machine/sysctls\n  value:\n    net.core.somaxconn: \"65535\"\n"},
+		},
+		{
+			name:     "unknown field",
+			nodeType: meta.WorkerNode,
+			patches:  []string{"machine:\n  kubelett:\n    extraArgs: {}\n"},
+			wantErr:  "kubelett",
+		},
+		{
+			name:     "invalid value",
+			nodeType: meta.WorkerNode,
+			patches:  []string{"machine:\n  kubelet:\n    nodeIP:\n      validSubnets: [\"not-a-cidr\"]\n"},
+			wantErr:  "not-a-cidr",
+		},
+		{
+			name:     "unknown node type",
+			nodeType: meta.ServerNodeType("gateway"),
+			wantErr:  "gateway",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.Validate(tt.nodeType, tt.patches)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidMachineConfiguration)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestNewMachineConfigurationValidator(t *testing.T) {
+	_, err := NewMachineConfigurationValidator("latest", "1.34.0")
+	assert.ErrorIs(t, err, ErrInvalidVersion)
+}
+
+func TestMachineConfigurationValidator_Render(t *testing.T) {
+	validator, err := NewMachineConfigurationValidator("v1.11.3", "1.34.0")
+	require.NoError(t, err)
+
+	secret := "0123456789abcdef0123456789abcdef"
+	configPatches, err := NewNodeConfiguration(&NodeConfigurationArgs{
+		ServerNodeType:            meta.ControlPlaneNode,
+		Subnet:                    "10.128.1.0/24",
+		PodSubnets:                "172.20.0.0/16",
+		SecretboxEncryptionSecret: &secret,
+		DiskEncryption: &core_config.DiskEncryptionConfig{
+			EncryptState: true,
+			Keys:         []core_config.EncryptionKeyConfig{{Slot: 0, Static: &core_config.EncryptionKeyStatic{Passphrase: "static-passphrase"}}},
+		},
+	})
+	require.NoError(t, err)
+
+	got, err := validator.Render(meta.ControlPlaneNode, configPatches)
+	require.NoError(t, err)
+	assert.Contains(t, got, "type: controlplane")
+	assert.Contains(t, got, "- 172.20.0.0/16")
+	assert.NotContains(t, got, secret)
+	assert.Contains(t, got, "secretboxEncryptionSecret: '"+RedactedValue+"'")
+	assert.NotContains(t, got, "static-passphrase")
+	assert.Contains(t, got, "passphrase: '"+RedactedValue+"'")
+
+	// the rendered configuration is stable
+	again, err := validator.Render(meta.ControlPlaneNode, configPatches)
+	require.NoError(t, err)
+	assert.Equal(t, got, again)
+
+	_, err = validator.Render(meta.WorkerNode, []string{"machine:\n  kubelett: {}\n"})
+	assert.ErrorIs(t, err, ErrInvalidMachineConfiguration)
+}
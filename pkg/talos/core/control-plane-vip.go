@@ -0,0 +1,47 @@
+package core
+
+import (
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/config/core"
+)
+
+const (
+	// publicInterface is the interface of the public network of Hetzner servers, the first interface of the server
+	publicInterface = "eth0"
+	// privateInterface is the interface of the private network of Hetzner servers with public network
+	privateInterface = "eth1"
+)
+
+// NewControlPlaneVIPConfigPatch returns the config patch which shares the IP as Talos VIP on the public interface of the control planes.
+// The elected control plane assigns the Hetzner floating IP of the VIP to its server with the API token.
+func NewControlPlaneVIPConfigPatch(ip, hcloudToken string) (string, error) {
+	patch := core.TalosConfig{
+		Machine: &core.MachineConfig{
+			Network: &core.NetworkConfig{
+				Interfaces: []core.Device{
+					{
+						Interface: publicInterface,
+						DHCP:      true,
+						VIP: &core.DeviceVIPConfig{
+							IP:     ip,
+							HCloud: &core.VIPHCloudConfig{APIToken: hcloudToken},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return patch.YAML()
+}
+
+// NewTalosEndpointConfigPatch returns the config patch which adds the IP of the Talos API endpoint to the certificate of the Talos API.
+// Talos only adds the addresses of the node itself, clients of the endpoint verify the certificate against its IP.
+func NewTalosEndpointConfigPatch(ip string) (string, error) {
+	patch := core.TalosConfig{
+		Machine: &core.MachineConfig{
+			CertSANs: []string{ip},
+		},
+	}
+
+	return patch.YAML()
+}
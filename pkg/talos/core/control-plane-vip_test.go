@@ -0,0 +1,45 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/config/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func vipConfigPatch(t *testing.T) string {
+	patch, err := NewControlPlaneVIPConfigPatch("203.0.113.10", "token")
+	require.NoError(t, err)
+	return patch
+}
+
+func TestNewControlPlaneVIPConfigPatch(t *testing.T) {
+	var got core.TalosConfig
+	require.NoError(t, yaml.Unmarshal([]byte(vipConfigPatch(t)), &got))
+
+	assert.Nil(t, got.Cluster)
+	require.Len(t, got.Machine.Network.Interfaces, 1)
+	assert.Equal(t, core.Device{
+		Interface: "eth0",
+		DHCP:      true,
+		VIP: &core.DeviceVIPConfig{
+			IP:     "203.0.113.10",
+			HCloud: &core.VIPHCloudConfig{APIToken: "token"},
+		},
+	}, got.Machine.Network.Interfaces[0])
+	assert.Nil(t, got.Machine.Network.KubeSpan, "the patch keeps the generated network configuration")
+}
+
+func TestNewTalosEndpointConfigPatch(t *testing.T) {
+	patch, err := NewTalosEndpointConfigPatch("203.0.113.20")
+	require.NoError(t, err)
+
+	var got core.TalosConfig
+	require.NoError(t, yaml.Unmarshal([]byte(patch), &got))
+
+	assert.Nil(t, got.Cluster)
+	assert.Equal(t, []string{"203.0.113.20"}, got.Machine.CertSANs)
+	assert.Nil(t, got.Machine.Network, "the patch keeps the generated network configuration")
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	core_config "github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+)
+
+// creationHashLength is the number of hex characters of a creation hash
+const creationHashLength = 12
+
+// CreationOnlyFields returns the fields of the node configuration which Talos only applies when a node is installed,
+// e.g. the encryption of a partition which is already formatted can not be changed.
+// All other fields are reconciled when the configuration is applied to existing nodes.
+// Fields which are not set are left out, so a new creation-only field does not change the hash of existing nodes.
+func (args *NodeConfigurationArgs) CreationOnlyFields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	if args.DiskEncryption != nil {
+		fields["disk_encryption"] = args.DiskEncryption
+	}
+	if args.Ephemeral != nil {
+		fields["ephemeral"] = args.Ephemeral
+	}
+	if args.ImageCache != nil && args.ImageCache.MaxSize != "" {
+		fields["image_cache_max_size"] = args.ImageCache.MaxSize
+	}
+
+	return fields
+}
+
+// Reconcilable returns a copy of the arguments without the creation-only fields,
+// for the configuration which is applied to existing nodes.
+// The image cache stays enabled, only the size of its partition is creation-only.
+// The volume of the EPHEMERAL partition stays unmounted.
+func (args *NodeConfigurationArgs) Reconcilable() *NodeConfigurationArgs {
+	reconcilable := *args
+	reconcilable.DiskEncryption = nil
+
+	if args.ImageCache != nil {
+		imageCache := *args.ImageCache
+		imageCache.MaxSize = ""
+		reconcilable.ImageCache = &imageCache
+	}
+
+	if args.Ephemeral != nil {
+		automount := false
+		reconcilable.Volumes = make([]core_config.NodeVolumeConfig, len(args.Volumes))
+		for i, v := range args.Volumes {
+			if v.Name == args.Ephemeral.Volume {
+				v.Automount = &automount
+			}
+			reconcilable.Volumes[i] = v
+		}
+		reconcilable.Ephemeral = nil
+	}
+
+	return &reconcilable
+}
+
+// CreationHash returns a short hash of the creation-only fields, it is empty without any
+func (args *NodeConfigurationArgs) CreationHash() (string, error) {
+	fields := args.CreationOnlyFields()
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the creation-only fields: %w", err)
+	}
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])[:creationHashLength], nil
+}
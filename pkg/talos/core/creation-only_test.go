@@ -0,0 +1,70 @@
+package core
+
+import (
+	"sort"
+	"testing"
+
+	core_config "github.com/exivity/pulumi-hcloud-k8s/pkg/config"
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeConfigurationArgs_CreationHash(t *testing.T) {
+	encryption := func(ephemeral bool) *core_config.DiskEncryptionConfig {
+		return &core_config.DiskEncryptionConfig{
+			EncryptState:     true,
+			EncryptEphemeral: ephemeral,
+			Keys:             []core_config.EncryptionKeyConfig{{Slot: 0, NodeID: &core_config.EncryptionKeyNodeID{}}},
+		}
+	}
+
+	hash := func(args *NodeConfigurationArgs) string {
+		got, err := args.CreationHash()
+		require.NoError(t, err)
+		return got
+	}
+
+	base := &NodeConfigurationArgs{ServerNodeType: meta.WorkerNode, Subnet: "10.128.1.0/24"}
+	assert.Empty(t, hash(base))
+
+	encrypted := &NodeConfigurationArgs{ServerNodeType: meta.WorkerNode, Subnet: "10.128.1.0/24", DiskEncryption: encryption(false)}
+	assert.Len(t, hash(encrypted), creationHashLength)
+	assert.Equal(t, hash(encrypted), hash(&NodeConfigurationArgs{DiskEncryption: encryption(false)}), "reconcilable fields are not part of the hash")
+	assert.NotEqual(t, hash(encrypted), hash(&NodeConfigurationArgs{DiskEncryption: encryption(true)}))
+
+	reconcilable := encrypted.Reconcilable()
+	assert.Nil(t, reconcilable.DiskEncryption)
+	assert.Empty(t, reconcilable.CreationOnlyFields())
+	assert.Equal(t, encrypted.Subnet, reconcilable.Subnet)
+	assert.NotNil(t, encrypted.DiskEncryption, "the arguments are not changed")
+}
+
+func TestNodeConfigurationArgs_Reconcilable_partitions(t *testing.T) {
+	args := &NodeConfigurationArgs{
+		ServerNodeType: meta.WorkerNode,
+		Volumes:        []core_config.NodeVolumeConfig{{Name: "var", Size: 200}, {Name: "data", Size: 100}},
+		Ephemeral:      &core_config.EphemeralConfig{Volume: "var"},
+		ImageCache:     &core_config.ImageCacheConfig{Enabled: true, MaxSize: "2GiB"},
+	}
+	assert.Equal(t, []string{"ephemeral", "image_cache_max_size"}, keys(args.CreationOnlyFields()))
+
+	reconcilable := args.Reconcilable()
+	assert.Empty(t, reconcilable.CreationOnlyFields())
+	assert.Nil(t, reconcilable.Ephemeral)
+	assert.Equal(t, &core_config.ImageCacheConfig{Enabled: true}, reconcilable.ImageCache, "the image cache stays enabled")
+	require.NotNil(t, reconcilable.Volumes[0].Automount)
+	assert.False(t, *reconcilable.Volumes[0].Automount, "the volume of EPHEMERAL stays unmounted")
+	assert.Nil(t, reconcilable.Volumes[1].Automount)
+	assert.Nil(t, args.Volumes[0].Automount, "the arguments are not changed")
+	assert.Equal(t, "2GiB", args.ImageCache.MaxSize, "the arguments are not changed")
+}
+
+func keys(m map[string]interface{}) []string {
+	out := make([]string, 0, len(m))
+	for key := range m {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -1,17 +1,29 @@
 package core
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"github.com/pulumiverse/pulumi-talos/sdk/go/talos/cluster"
 	"github.com/pulumiverse/pulumi-talos/sdk/go/talos/machine"
+	"gopkg.in/yaml.v3"
 )
 
+// ErrInvalidKubeconfig is returned when the kubeconfig of the cluster can not be parsed
+var ErrInvalidKubeconfig = errors.New("invalid kubeconfig")
+
 type KubeconfigArgs struct {
 	// CertificateRenewalDuration is the duration for which the certificate is valid
 	CertificateRenewalDuration string
-	// FirstControlPlane is the first control plane node
+	// FirstControlPlane is the first control plane node, it bootstraps the cluster
 	FirstControlPlane *hcloud.Server
+	// TalosEndpoint is the Talos API endpoint the kubeconfig is requested through, see MachineConfigurationManager.TalosEndpoint
+	TalosEndpoint pulumi.StringOutput
+	// ClusterEndpoint is the URL of the Kubernetes API, the server of the kubeconfig, see MachineConfigurationManager.ClusterEndpoint
+	ClusterEndpoint pulumi.StringOutput
 	// Talos Linux secrets for the cluster
 	Secrets *machine.Secrets
 }
@@ -19,39 +31,83 @@ type KubeconfigArgs struct {
 type Kubeconfig struct {
 	Bootstrap  *machine.Bootstrap
 	Kubeconfig *cluster.Kubeconfig
+	// KubeconfigRaw is the kubeconfig of the cluster, its server is the cluster endpoint
+	KubeconfigRaw pulumi.StringOutput
+	// Host is the cluster endpoint, the server of KubeconfigRaw
+	Host pulumi.StringOutput
 }
 
-func NewKubeconfig(ctx *pulumi.Context, args *KubeconfigArgs, opts ...pulumi.ResourceOption) (*Kubeconfig, error) {
-	bootstrap, err := machine.NewBootstrap(ctx, "bootstrap", &machine.BootstrapArgs{
+func NewKubeconfig(ctx *pulumi.Context, name string, args *KubeconfigArgs, opts ...pulumi.ResourceOption) (*Kubeconfig, error) {
+	bootstrap, err := machine.NewBootstrap(ctx, fmt.Sprintf("%s-bootstrap", name), &machine.BootstrapArgs{
 		Node:                args.FirstControlPlane.Ipv4Address,
 		ClientConfiguration: args.Secrets.ClientConfiguration,
 	}, append(opts,
 		pulumi.Parent(args.Secrets),
 		pulumi.IgnoreChanges([]string{"node"}),
+		meta.LegacyName("bootstrap"),
 	)...)
 	if err != nil {
 		return nil, err
 	}
 
-	k8s, err := cluster.NewKubeconfig(ctx, "kubeconfigResource", &cluster.KubeconfigArgs{
+	k8s, err := cluster.NewKubeconfig(ctx, fmt.Sprintf("%s-kubeconfig", name), &cluster.KubeconfigArgs{
 		ClientConfiguration: &cluster.KubeconfigClientConfigurationArgs{
 			CaCertificate:     bootstrap.ClientConfiguration.CaCertificate(),
 			ClientCertificate: bootstrap.ClientConfiguration.ClientCertificate(),
 			ClientKey:         bootstrap.ClientConfiguration.ClientKey(),
 		},
-		Node:                       args.FirstControlPlane.Ipv4Address,
+		Node:                       args.TalosEndpoint,
 		CertificateRenewalDuration: pulumi.String(args.CertificateRenewalDuration),
-		Endpoint:                   args.FirstControlPlane.Ipv4Address,
+		Endpoint:                   args.TalosEndpoint,
 	},
 		pulumi.Parent(bootstrap),
 		pulumi.IgnoreChanges([]string{"node", "endpoint"}), // Ignore changes to the node address, as it may change after initial creation
+		meta.LegacyName("kubeconfigResource"),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	kubeconfigRaw := pulumi.All(k8s.KubeconfigRaw, args.ClusterEndpoint).ApplyT(func(v []interface{}) (string, error) {
+		return setKubeconfigServer(v[0].(string), v[1].(string))
+	}).(pulumi.StringOutput)
+
 	return &Kubeconfig{
-		Bootstrap:  bootstrap,
-		Kubeconfig: k8s,
+		Bootstrap:     bootstrap,
+		Kubeconfig:    k8s,
+		KubeconfigRaw: pulumi.ToSecret(kubeconfigRaw).(pulumi.StringOutput),
+		Host:          args.ClusterEndpoint,
 	}, nil
 }
+
+// setKubeconfigServer points all clusters of the kubeconfig at the server
+func setKubeconfigServer(kubeconfig, server string) (string, error) {
+	doc := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(kubeconfig), &doc); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidKubeconfig, err)
+	}
+
+	clusters, ok := doc["clusters"].([]interface{})
+	if !ok || len(clusters) == 0 {
+		return "", fmt.Errorf("%w: no clusters", ErrInvalidKubeconfig)
+	}
+
+	for _, entry := range clusters {
+		namedCluster, ok := entry.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%w: invalid cluster entry", ErrInvalidKubeconfig)
+		}
+		clusterConfig, ok := namedCluster["cluster"].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("%w: cluster entry without cluster", ErrInvalidKubeconfig)
+		}
+		clusterConfig["server"] = server
+	}
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
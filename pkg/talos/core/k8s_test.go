@@ -0,0 +1,79 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+  - name: test
+    cluster:
+      server: https://1.2.3.4:6443
+      certificate-authority-data: Y2E=
+contexts:
+  - name: admin@test
+    context:
+      cluster: test
+      user: admin@test
+current-context: admin@test
+users:
+  - name: admin@test
+    user:
+      client-certificate-data: Y2VydA==
+      client-key-data: a2V5
+`
+
+func Test_setKubeconfigServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		kubeconfig string
+		server     string
+		wantErr    error
+	}{
+		{
+			name:       "cluster endpoint",
+			kubeconfig: testKubeconfig,
+			server:     "https://api.cluster.example.com:6443",
+		},
+		{
+			name:       "no clusters",
+			kubeconfig: "apiVersion: v1\nkind: Config\n",
+			server:     "https://api.cluster.example.com:6443",
+			wantErr:    ErrInvalidKubeconfig,
+		},
+		{
+			name:       "invalid YAML",
+			kubeconfig: "clusters: [",
+			server:     "https://api.cluster.example.com:6443",
+			wantErr:    ErrInvalidKubeconfig,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := setKubeconfigServer(tt.kubeconfig, tt.server)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			kubeconfig := struct {
+				Clusters []struct {
+					Name    string
+					Cluster map[string]string
+				}
+				CurrentContext string `yaml:"current-context"`
+			}{}
+			require.NoError(t, yaml.Unmarshal([]byte(got), &kubeconfig))
+			require.Len(t, kubeconfig.Clusters, 1)
+			assert.Equal(t, tt.server, kubeconfig.Clusters[0].Cluster["server"])
+			assert.Equal(t, "Y2E=", kubeconfig.Clusters[0].Cluster["certificate-authority-data"])
+			assert.Equal(t, "admin@test", kubeconfig.CurrentContext)
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidVersion is returned when a Talos or Kubernetes version can not be parsed
+	ErrInvalidVersion = errors.New("invalid version")
+	// ErrUnsupportedKubernetesVersion is returned when the Kubernetes version is not supported by the Talos version
+	ErrUnsupportedKubernetesVersion = errors.New("kubernetes version is not supported by Talos")
+	// ErrUnsupportedKubernetesUpgrade is returned when the Kubernetes upgrade path is not allowed
+	ErrUnsupportedKubernetesUpgrade = errors.New("unsupported kubernetes upgrade")
+)
+
+// minorVersion is the major and minor part of a version, e.g. 1.34 for "v1.34.1"
+type minorVersion struct {
+	major int
+	minor int
+}
+
+func (v minorVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+func (v minorVersion) less(other minorVersion) bool {
+	if v.major != other.major {
+		return v.major < other.major
+	}
+	return v.minor < other.minor
+}
+
+// kubernetesRange is the range of supported Kubernetes minor versions, both ends included
+type kubernetesRange struct {
+	min minorVersion
+	max minorVersion
+}
+
+// talosKubernetesSupportMatrix maps a Talos minor version to the Kubernetes versions it supports.
+// See: https://www.talos.dev/latest/introduction/support-matrix/
+var talosKubernetesSupportMatrix = map[minorVersion]kubernetesRange{
+	{1, 7}:  {min: minorVersion{1, 25}, max: minorVersion{1, 30}},
+	{1, 8}:  {min: minorVersion{1, 26}, max: minorVersion{1, 31}},
+	{1, 9}:  {min: minorVersion{1, 27}, max: minorVersion{1, 32}},
+	{1, 10}: {min: minorVersion{1, 28}, max: minorVersion{1, 33}},
+	{1, 11}: {min: minorVersion{1, 29}, max: minorVersion{1, 34}},
+	{1, 12}: {min: minorVersion{1, 30}, max: minorVersion{1, 35}},
+}
+
+// ValidateKubernetesVersion checks the Kubernetes version against the Talos support matrix.
+// Talos versions which are not part of the matrix yet are not checked.
+func ValidateKubernetesVersion(talosVersion, kubernetesVersion string) error {
+	talos, err := parseMinorVersion(talosVersion)
+	if err != nil {
+		return err
+	}
+	kubernetes, err := parseMinorVersion(kubernetesVersion)
+	if err != nil {
+		return err
+	}
+
+	supported, ok := talosKubernetesSupportMatrix[talos]
+	if !ok {
+		return nil
+	}
+
+	if kubernetes.less(supported.min) || supported.max.less(kubernetes) {
+		return fmt.Errorf("%w: Talos %s supports Kubernetes %s to %s, got %s",
+			ErrUnsupportedKubernetesVersion, talos, supported.min, supported.max, kubernetesVersion)
+	}
+
+	return nil
+}
+
+// ValidateKubernetesUpgrade checks that the Kubernetes version can be upgraded from one version to the other.
+// Kubernetes does not support downgrades and the control plane can only be upgraded one minor version at a time.
+func ValidateKubernetesUpgrade(from, to string) error {
+	fromVersion, err := parseMinorVersion(from)
+	if err != nil {
+		return err
+	}
+	toVersion, err := parseMinorVersion(to)
+	if err != nil {
+		return err
+	}
+
+	if toVersion.less(fromVersion) {
+		return fmt.Errorf("%w: downgrade from %s to %s", ErrUnsupportedKubernetesUpgrade, from, to)
+	}
+
+	if toVersion.major != fromVersion.major || toVersion.minor > fromVersion.minor+1 {
+		return fmt.Errorf("%w: from %s to %s skips a minor version", ErrUnsupportedKubernetesUpgrade, from, to)
+	}
+
+	return nil
+}
+
+// KubeletVersion returns the version as reported by the kubelet, e.g. "v1.34.0" for "1.34.0"
+func KubeletVersion(kubernetesVersion string) string {
+	return "v" + strings.TrimPrefix(kubernetesVersion, "v")
+}
+
+// parseMinorVersion parses the major and minor part of a version like "v1.11.3" or "1.34.0"
+func parseMinorVersion(version string) (minorVersion, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 { //nolint:mnd // major and minor
+		return minorVersion{}, fmt.Errorf("%w: %q", ErrInvalidVersion, version)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return minorVersion{}, fmt.Errorf("%w: %q", ErrInvalidVersion, version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return minorVersion{}, fmt.Errorf("%w: %q", ErrInvalidVersion, version)
+	}
+
+	return minorVersion{major: major, minor: minor}, nil
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKubernetesVersion(t *testing.T) {
+	tests := []struct {
+		name              string
+		talosVersion      string
+		kubernetesVersion string
+		wantErr           error
+	}{
+		{
+			name:              "supported",
+			talosVersion:      "v1.11.3",
+			kubernetesVersion: "1.34.0",
+		},
+		{
+			name:              "oldest supported",
+			talosVersion:      "v1.11.3",
+			kubernetesVersion: "v1.29.4",
+		},
+		{
+			name:              "too new for Talos",
+			talosVersion:      "v1.10.5",
+			kubernetesVersion: "1.34.0",
+			wantErr:           ErrUnsupportedKubernetesVersion,
+		},
+		{
+			name:              "too old for Talos",
+			talosVersion:      "v1.11.3",
+			kubernetesVersion: "1.28.0",
+			wantErr:           ErrUnsupportedKubernetesVersion,
+		},
+		{
+			name:              "Talos version not in the matrix",
+			talosVersion:      "v1.99.0",
+			kubernetesVersion: "1.50.0",
+		},
+		{
+			name:              "invalid Talos version",
+			talosVersion:      "latest",
+			kubernetesVersion: "1.34.0",
+			wantErr:           ErrInvalidVersion,
+		},
+		{
+			name:              "invalid Kubernetes version",
+			talosVersion:      "v1.11.3",
+			kubernetesVersion: "1.x",
+			wantErr:           ErrInvalidVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateKubernetesVersion(tt.talosVersion, tt.kubernetesVersion)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateKubernetesUpgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		wantErr error
+	}{
+		{
+			name: "patch upgrade",
+			from: "1.34.0",
+			to:   "1.34.1",
+		},
+		{
+			name: "minor upgrade",
+			from: "1.33.5",
+			to:   "v1.34.0",
+		},
+		{
+			name:    "skips a minor version",
+			from:    "1.32.0",
+			to:      "1.34.0",
+			wantErr: ErrUnsupportedKubernetesUpgrade,
+		},
+		{
+			name:    "downgrade",
+			from:    "1.34.0",
+			to:      "1.33.0",
+			wantErr: ErrUnsupportedKubernetesUpgrade,
+		},
+		{
+			name:    "invalid version",
+			from:    "",
+			to:      "1.34.0",
+			wantErr: ErrInvalidVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateKubernetesUpgrade(tt.from, tt.to)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestKubeletVersion(t *testing.T) {
+	assert.Equal(t, "v1.34.0", KubeletVersion("1.34.0"))
+	assert.Equal(t, "v1.34.0", KubeletVersion("v1.34.0"))
+}
@@ -6,18 +6,23 @@ import (
 
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/lb"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
+	"github.com/pulumi/pulumi-hcloud/sdk/go/hcloud"
 	"github.com/pulumi/pulumi/sdk/v3/go/pulumi"
 	"github.com/pulumiverse/pulumi-talos/sdk/go/talos/machine"
 )
 
 var (
-	// ErrNoClusterEndpoint is returned when neither ControlplaneLoadBalancer nor SingleControlPlaneNodeIP is set
-	ErrNoClusterEndpoint = errors.New("either ControlplaneLoadBalancer or SingleControlPlaneNodeIP must be set")
+	// ErrNoClusterEndpoint is returned when neither Hostname, ControlplaneLoadBalancer, ControlplaneFloatingIP nor SingleControlPlaneNodeIP is set
+	ErrNoClusterEndpoint = errors.New("either Hostname, ControlplaneLoadBalancer, ControlplaneFloatingIP or SingleControlPlaneNodeIP must be set")
 )
 
 type MachineConfigurationManagerArgs struct {
 	// ControlplaneLoadBalancer is the control plane load balancer
 	ControlplaneLoadBalancer *lb.Controlplane
+	// ControlplaneFloatingIP is the floating IP the control planes share as Talos VIP (used instead of a load balancer)
+	ControlplaneFloatingIP *hcloud.FloatingIp
+	// Hostname is the hostname of the Kubernetes API, it is preferred over the IPs of the endpoint
+	Hostname string
 	// SingleControlPlaneNodeIP is the IP address of a single control plane node (used when load balancer is disabled)
 	SingleControlPlaneNodeIP pulumi.StringInput
 	// TalosVersion is the version of Talos to use
@@ -33,6 +38,10 @@ type MachineConfigurationManager struct {
 	Secrets *machine.Secrets
 	// ControlplaneLoadBalancer is the control plane load balancer
 	ControlplaneLoadBalancer *lb.Controlplane
+	// ControlplaneFloatingIP is the floating IP the control planes share as Talos VIP (used instead of a load balancer)
+	ControlplaneFloatingIP *hcloud.FloatingIp
+	// Hostname is the hostname of the Kubernetes API, it is preferred over the IPs of the endpoint
+	Hostname string
 	// SingleControlPlaneNodeIP is the IP address of a single control plane node (used when load balancer is disabled)
 	SingleControlPlaneNodeIP pulumi.StringInput
 	// TalosVersion is the version of Talos to use
@@ -52,6 +61,8 @@ func NewMachineConfigurationManager(ctx *pulumi.Context, name string, args *Mach
 		ClusterName:              name,
 		Secrets:                  secrets,
 		ControlplaneLoadBalancer: args.ControlplaneLoadBalancer,
+		ControlplaneFloatingIP:   args.ControlplaneFloatingIP,
+		Hostname:                 args.Hostname,
 		SingleControlPlaneNodeIP: args.SingleControlPlaneNodeIP,
 		TalosVersion:             args.TalosVersion,
 		KubernetesVersion:        args.KubernetesVersion,
@@ -69,8 +80,14 @@ type MachineConfigurationArgs struct {
 // A MachineConfiguration is needed to give a new hetzner server as UserData
 // Like UserData: NewMachineConfiguration()
 func (c *MachineConfigurationManager) NewMachineConfiguration(ctx *pulumi.Context, args *MachineConfigurationArgs) (pulumi.StringOutput, error) {
+	clusterEndpoint, err := c.ClusterEndpoint()
+	if err != nil {
+		return pulumi.StringOutput{}, err
+	}
+
 	configuration := machine.GetConfigurationOutputArgs{
 		ClusterName:       pulumi.String(c.ClusterName),
+		ClusterEndpoint:   clusterEndpoint,
 		MachineType:       pulumi.String(args.ServerNodeType),
 		MachineSecrets:    c.Secrets.MachineSecrets,
 		TalosVersion:      pulumi.String(c.TalosVersion),
@@ -80,23 +97,81 @@ func (c *MachineConfigurationManager) NewMachineConfiguration(ctx *pulumi.Contex
 		Examples:          pulumi.BoolPtr(false),
 	}
 
+	return machine.GetConfigurationOutput(ctx, configuration,
+		pulumi.Parent(c.Secrets),
+	).MachineConfiguration(), nil
+}
+
+// ClusterEndpoint returns the URL of the Kubernetes API server.
+// The hostname is preferred, then the control plane load balancer, the floating IP and the IP of a single control plane node.
+// The hostname does not change when the load balancer or the floating IP is replaced.
+func (c *MachineConfigurationManager) ClusterEndpoint() (pulumi.StringOutput, error) {
+	if c.Hostname != "" {
+		return pulumi.Sprintf("https://%s:%d", c.Hostname, lb.ControlPlaneLoadBalancerPort), nil
+	}
+
+	// If we have a load balancer, prefer that over single node IP
+	if c.ControlplaneLoadBalancer != nil {
+		return pulumi.Sprintf("https://%s:%d", c.ControlplaneLoadBalancer.LoadBalancer.Ipv4, lb.ControlPlaneLoadBalancerPort), nil
+	}
+
+	// The floating IP follows the elected control plane
+	if c.ControlplaneFloatingIP != nil {
+		return pulumi.Sprintf("https://%s:%d", c.ControlplaneFloatingIP.IpAddress, lb.ControlPlaneLoadBalancerPort), nil
+	}
+
 	// If we have a single control plane IP, use that
 	if c.SingleControlPlaneNodeIP != nil {
-		configuration.ClusterEndpoint = pulumi.Sprintf("https://%s:%d", c.SingleControlPlaneNodeIP, lb.ControlPlaneLoadBalancerPort)
+		return pulumi.Sprintf("https://%s:%d", c.SingleControlPlaneNodeIP, lb.ControlPlaneLoadBalancerPort), nil
 	}
 
-	// If we have a load balancer, prefer that over single node IP
+	return pulumi.StringOutput{}, ErrNoClusterEndpoint
+}
+
+// TalosEndpoint returns the Talos API endpoint which reaches a healthy control plane.
+// The control plane load balancer forwards the Talos API and the floating IP follows the elected control plane.
+// Without either, the cluster has a single control plane endpoint, the IP of its node.
+func (c *MachineConfigurationManager) TalosEndpoint() (pulumi.StringOutput, error) {
 	if c.ControlplaneLoadBalancer != nil {
-		configuration.ClusterEndpoint = pulumi.Sprintf("https://%s:%d", c.ControlplaneLoadBalancer.LoadBalancer.Ipv4, lb.ControlPlaneLoadBalancerPort)
+		return c.ControlplaneLoadBalancer.LoadBalancer.Ipv4, nil
 	}
 
-	if configuration.ClusterEndpoint == nil {
-		return pulumi.StringOutput{}, ErrNoClusterEndpoint
+	if c.ControlplaneFloatingIP != nil {
+		return c.ControlplaneFloatingIP.IpAddress, nil
 	}
 
-	return machine.GetConfigurationOutput(ctx, configuration,
-		pulumi.Parent(c.Secrets),
-	).MachineConfiguration(), nil
+	if c.SingleControlPlaneNodeIP != nil {
+		return c.SingleControlPlaneNodeIP.ToStringOutput(), nil
+	}
+
+	return pulumi.StringOutput{}, ErrNoClusterEndpoint
+}
+
+// TalosEndpointConfigPatch returns the config patch which adds the IP of the control plane load balancer
+// to the certificate of the Talos API of the control planes. It returns false without load balancer,
+// the floating IP is an address of the elected control plane and part of its certificate.
+func (c *MachineConfigurationManager) TalosEndpointConfigPatch() (pulumi.StringOutput, bool) {
+	if c.ControlplaneLoadBalancer == nil {
+		return pulumi.StringOutput{}, false
+	}
+
+	patch := c.ControlplaneLoadBalancer.LoadBalancer.Ipv4.ApplyT(NewTalosEndpointConfigPatch).(pulumi.StringOutput)
+
+	return patch, true
+}
+
+// ControlplaneVIPConfigPatch returns the config patch of the Talos VIP of the control plane floating IP as secret,
+// it contains the API token. It returns false if the control planes have no floating IP.
+func (c *MachineConfigurationManager) ControlplaneVIPConfigPatch(hcloudToken string) (pulumi.StringOutput, bool) {
+	if c.ControlplaneFloatingIP == nil {
+		return pulumi.StringOutput{}, false
+	}
+
+	patch := c.ControlplaneFloatingIP.IpAddress.ApplyT(func(ip string) (string, error) {
+		return NewControlPlaneVIPConfigPatch(ip, hcloudToken)
+	}).(pulumi.StringOutput)
+
+	return pulumi.ToSecret(patch).(pulumi.StringOutput), true
 }
 
 // SetSingleControlPlaneNodeIP sets the IP address of the first control plane node.
@@ -107,9 +182,9 @@ func (c *MachineConfigurationManager) SetSingleControlPlaneNodeIP(ip pulumi.Stri
 }
 
 // HasClusterEndpoint checks if a cluster endpoint is available.
-// Returns true if either a control plane load balancer is configured
+// Returns true if either a hostname, a control plane load balancer or floating IP is configured
 // or a single control plane node IP is set. This helps determine
 // whether the configuration is for a load balancer or non-loadbalancer setup.
 func (c *MachineConfigurationManager) HasClusterEndpoint() bool {
-	return c.ControlplaneLoadBalancer != nil || c.SingleControlPlaneNodeIP != nil
+	return c.Hostname != "" || c.ControlplaneLoadBalancer != nil || c.ControlplaneFloatingIP != nil || c.SingleControlPlaneNodeIP != nil
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 
 	core_config "github.com/exivity/pulumi-hcloud-k8s/pkg/config"
@@ -10,6 +11,11 @@ import (
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/config/volume"
 )
 
+var (
+	// ErrUnknownVolume is returned when a partition is placed on a volume which the pool does not have
+	ErrUnknownVolume = errors.New("unknown volume")
+)
+
 type NodeConfigurationArgs struct {
 	// ServerNodeType is the type of the server node
 	ServerNodeType meta.ServerNodeType
@@ -56,8 +62,28 @@ type NodeConfigurationArgs struct {
 	EnableKubeSpan bool
 	// CNI is the CNI configuration for the cluster.
 	CNI *core_config.CNIConfig
+	// Proxy is the kube-proxy configuration for the cluster.
+	Proxy *core_config.ProxyConfig
 	// DiskEncryption configures disk encryption for system partitions.
 	DiskEncryption *core_config.DiskEncryptionConfig
+	// Volumes are the Hetzner volumes attached to the nodes, they are mounted as user volumes
+	Volumes []core_config.NodeVolumeConfig
+	// Ephemeral sizes and places the EPHEMERAL partition
+	Ephemeral *core_config.EphemeralConfig
+	// ImageCache enables the Talos image cache
+	ImageCache *core_config.ImageCacheConfig
+	// Swap enables swap on the node
+	Swap *core_config.SwapConfig
+	// CertSANs are additional SANs of the certificates of the Kubernetes API server and the Talos API, e.g. the API endpoint hostname
+	CertSANs []string
+	// PublicNetwork is the public network of the node, see config.NodePoolConfig.PublicNetwork. Empty is "dual".
+	// Without public network, the private network is the only interface of the server.
+	PublicNetwork string
+	// DefaultGateway routes the IPv4 traffic to the internet through the private network, e.g. to its NAT gateway
+	DefaultGateway string
+	// ConfigPatches are user config patches, appended after the generated documents.
+	// Strategic merge patches in YAML and JSON6902 patches are accepted.
+	ConfigPatches []string
 }
 
 func NewNodeConfiguration(args *NodeConfigurationArgs) ([]string, error) {
@@ -69,7 +95,10 @@ func NewNodeConfiguration(args *NodeConfigurationArgs) ([]string, error) {
 
 	configs := []string{nodeConfigYAML}
 
-	volumeConfigs := newVolumeConfigs(args)
+	volumeConfigs, err := newVolumeConfigs(args)
+	if err != nil {
+		return nil, err
+	}
 
 	for _, vc := range volumeConfigs {
 		vcYAML, err := vc.YAML()
@@ -79,6 +108,28 @@ func NewNodeConfiguration(args *NodeConfigurationArgs) ([]string, error) {
 		configs = append(configs, vcYAML)
 	}
 
+	for _, uvc := range newUserVolumeConfigs(args) {
+		uvcYAML, err := uvc.YAML()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate UserVolume config YAML: %w", err)
+		}
+		configs = append(configs, uvcYAML)
+	}
+
+	swapConfig, err := newSwapVolumeConfig(args)
+	if err != nil {
+		return nil, err
+	}
+	if swapConfig != nil {
+		swapYAML, err := swapConfig.YAML()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate SwapVolume config YAML: %w", err)
+		}
+		configs = append(configs, swapYAML)
+	}
+
+	configs = append(configs, args.ConfigPatches...)
+
 	return configs, nil
 }
 
@@ -118,6 +169,7 @@ func newMainTalosConfig(args *NodeConfigurationArgs) *core.TalosConfig { //nolin
 				Manifests: ccmExtraManifests,
 			},
 			Network: clusterNetwork,
+			Proxy:   toProxyConfig(args.Proxy, args.CNI),
 			Discovery: &core.ClusterDiscoveryConfig{
 				Enabled: true, // Enable discovery, required for network encryption via kube span
 			},
@@ -131,12 +183,10 @@ func newMainTalosConfig(args *NodeConfigurationArgs) *core.TalosConfig { //nolin
 			Type:            string(args.ServerNodeType),
 			NodeLabels:      args.NodeLabels,
 			NodeAnnotations: args.NodeAnnotations,
+			NodeTaints:      toNodeTaints(args.NodeTaints),
 			Network: &core.NetworkConfig{
 				Interfaces: []core.Device{
-					{
-						Interface: "eth1",
-						DHCP:      true,
-					},
+					toPrivateInterface(args),
 				},
 				Nameservers: args.Nameservers,
 				KubeSpan: &core.NetworkKubeSpan{
@@ -150,7 +200,6 @@ func newMainTalosConfig(args *NodeConfigurationArgs) *core.TalosConfig { //nolin
 					},
 				},
 				ExtraArgs: map[string]string{
-					"register-with-taints": toTalosTaints(args.NodeTaints),
 					// enable kubelet certificate rotation
 					// This is required for deploying a metric server
 					// See: https://www.talos.dev/v1.11/kubernetes-guides/configuration/deploy-metrics-server/
@@ -199,29 +248,74 @@ func newMainTalosConfig(args *NodeConfigurationArgs) *core.TalosConfig { //nolin
 
 	configPatch.Machine.Registries = toRegistriesConfig(args.Registries)
 
+	if len(args.CertSANs) > 0 {
+		configPatch.Machine.CertSANs = args.CertSANs
+		configPatch.Cluster.APIServer = &core.APIServerConfig{CertSANs: args.CertSANs}
+	}
+
+	if args.Swap != nil {
+		configPatch.Machine.Kubelet.ExtraConfig = map[string]interface{}{
+			"memorySwap": map[string]interface{}{
+				"swapBehavior": args.Swap.Behavior,
+			},
+		}
+	}
+
+	if args.ImageCache != nil && args.ImageCache.Enabled {
+		configPatch.Machine.Features = &core.FeaturesConfig{
+			ImageCache: &core.ImageCacheConfig{LocalEnabled: true},
+		}
+	}
+
 	return &configPatch
 }
 
+// toCNIConfig converts the CNI configuration. Cilium is installed through inline manifests, Talos deploys no CNI.
 func toCNIConfig(cni *core_config.CNIConfig) *core.CNIConfig {
 	if cni == nil {
 		return nil
 	}
 
+	if cni.Name == core_config.CNICilium {
+		return &core.CNIConfig{Name: "none"}
+	}
+
 	return &core.CNIConfig{
 		Name: cni.Name,
 		URLs: cni.URLs,
 	}
 }
 
-func toTalosTaints(taints []core_config.Taint) string {
-	t := ""
-	for _, taint := range taints {
-		t += fmt.Sprintf("%s=%s:%s,", taint.Key, taint.Value, taint.Effect)
+// toProxyConfig converts the kube-proxy configuration. kube-proxy is always disabled with Cilium, which replaces it.
+func toProxyConfig(proxy *core_config.ProxyConfig, cni *core_config.CNIConfig) *core.ProxyConfig {
+	if cni != nil && cni.Name == core_config.CNICilium {
+		return &core.ProxyConfig{Disabled: true}
 	}
-	if len(t) > 0 {
-		t = t[:len(t)-1]
+
+	if proxy == nil {
+		return nil
+	}
+
+	return &core.ProxyConfig{
+		Disabled:  proxy.Disabled,
+		Mode:      proxy.Mode,
+		ExtraArgs: proxy.ExtraArgs,
+	}
+}
+
+// toNodeTaints converts the taints to machine.nodeTaints, which Talos reconciles on the node.
+// Unlike kubelet's register-with-taints, added and removed taints are applied to existing nodes.
+// machine.nodeTaints holds one "value:effect" per key, the config validation rejects a key with several values or effects.
+func toNodeTaints(taints []core_config.Taint) map[string]string {
+	if len(taints) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(taints))
+	for _, taint := range taints {
+		out[taint.Key] = fmt.Sprintf("%s:%s", taint.Value, taint.Effect)
 	}
-	return t
+	return out
 }
 
 func toRegistriesConfig(args *core_config.RegistriesConfig) *core.RegistriesConfig {
@@ -295,45 +389,205 @@ func toInlineManifests(manifests []core_config.ClusterInlineManifest) []core.Clu
 	return out
 }
 
-func newVolumeConfigs(args *NodeConfigurationArgs) []*volume.VolumeConfig {
-	if args.DiskEncryption == nil {
-		return nil
-	}
-
+func newVolumeConfigs(args *NodeConfigurationArgs) ([]*volume.VolumeConfig, error) {
 	var configs []*volume.VolumeConfig
 
-	if args.DiskEncryption.EncryptState {
+	if args.DiskEncryption != nil && args.DiskEncryption.EncryptState {
 		configs = append(configs, &volume.VolumeConfig{
-			Name: "STATE",
-			Encryption: &volume.EncryptionSpec{
-				Provider: "luks2",
-				Keys:     toEncryptionKeys(args.DiskEncryption.Keys),
-			},
+			Name:       "STATE",
+			Encryption: newEncryptionSpec(args.DiskEncryption, false),
 		})
 	}
 
-	if args.DiskEncryption.EncryptEphemeral {
+	ephemeral, err := newEphemeralVolumeConfig(args)
+	if err != nil {
+		return nil, err
+	}
+	if ephemeral != nil {
+		configs = append(configs, ephemeral)
+	}
+
+	if args.ImageCache != nil && args.ImageCache.Enabled && args.ImageCache.MaxSize != "" {
 		configs = append(configs, &volume.VolumeConfig{
-			Name: "EPHEMERAL",
-			Encryption: &volume.EncryptionSpec{
-				Provider: "luks2",
-				Keys:     toEncryptionKeys(args.DiskEncryption.Keys),
+			Name:         "IMAGECACHE",
+			Provisioning: &volume.ProvisioningSpec{MaxSize: args.ImageCache.MaxSize},
+		})
+	}
+
+	return configs, nil
+}
+
+// newEphemeralVolumeConfig returns the EPHEMERAL volume with its encryption and provisioning, it is nil without both
+func newEphemeralVolumeConfig(args *NodeConfigurationArgs) (*volume.VolumeConfig, error) {
+	ephemeral := &volume.VolumeConfig{Name: "EPHEMERAL"}
+
+	if args.DiskEncryption != nil && args.DiskEncryption.EncryptEphemeral {
+		ephemeral.Encryption = newEncryptionSpec(args.DiskEncryption, true)
+	}
+
+	if args.Ephemeral != nil {
+		provisioning := &volume.ProvisioningSpec{
+			MinSize: args.Ephemeral.MinSize,
+			MaxSize: args.Ephemeral.MaxSize,
+			Grow:    args.Ephemeral.Grow,
+		}
+
+		if args.Ephemeral.Volume != "" {
+			v, ok := findVolume(args.Volumes, args.Ephemeral.Volume)
+			if !ok {
+				return nil, fmt.Errorf("%w: EPHEMERAL is placed on %s", ErrUnknownVolume, args.Ephemeral.Volume)
+			}
+			provisioning.DiskSelector = &volume.DiskSelector{Match: hetznerVolumeSelector(v.Size)}
+		}
+
+		if *provisioning != (volume.ProvisioningSpec{}) {
+			ephemeral.Provisioning = provisioning
+		}
+	}
+
+	if ephemeral.Encryption == nil && ephemeral.Provisioning == nil {
+		return nil, nil
+	}
+
+	return ephemeral, nil
+}
+
+// swapVolumeName is the name of the swap volume, Talos names the partition s-swap
+const swapVolumeName = "swap"
+
+// newSwapVolumeConfig returns the swap volume on the root disk or a volume of the pool, it is nil without swap
+func newSwapVolumeConfig(args *NodeConfigurationArgs) (*volume.SwapVolumeConfig, error) {
+	if args.Swap == nil {
+		return nil, nil
+	}
+
+	selector := "system_disk"
+	if args.Swap.Volume != "" {
+		v, ok := findVolume(args.Volumes, args.Swap.Volume)
+		if !ok {
+			return nil, fmt.Errorf("%w: swap is placed on %s", ErrUnknownVolume, args.Swap.Volume)
+		}
+		selector = hetznerVolumeSelector(v.Size)
+	}
+
+	swap := &volume.SwapVolumeConfig{
+		Name: swapVolumeName,
+		Provisioning: &volume.ProvisioningSpec{
+			DiskSelector: &volume.DiskSelector{Match: selector},
+			MinSize:      args.Swap.Size,
+			MaxSize:      args.Swap.Size,
+		},
+	}
+
+	if args.Swap.Encrypted {
+		swap.Encryption = &volume.EncryptionSpec{
+			Provider: "luks2",
+			Keys:     []volume.EncryptionKey{{Slot: 0, NodeID: &volume.EncryptionKeyNodeID{}}},
+		}
+	}
+
+	return swap, nil
+}
+
+// findVolume returns the volume with the name
+func findVolume(volumes []core_config.NodeVolumeConfig, name string) (core_config.NodeVolumeConfig, bool) {
+	for _, v := range volumes {
+		if v.Name == name {
+			return v, true
+		}
+	}
+
+	return core_config.NodeVolumeConfig{}, false
+}
+
+// newUserVolumeConfigs mounts the Hetzner volumes of the nodes, volumes without automount and the volumes of EPHEMERAL and swap are only attached
+func newUserVolumeConfigs(args *NodeConfigurationArgs) []*volume.UserVolumeConfig {
+	var configs []*volume.UserVolumeConfig
+	for _, v := range args.Volumes {
+		if v.Automount != nil && !*v.Automount {
+			continue
+		}
+		// the volume holds the EPHEMERAL or the swap partition
+		if (args.Ephemeral != nil && args.Ephemeral.Volume == v.Name) || (args.Swap != nil && args.Swap.Volume == v.Name) {
+			continue
+		}
+
+		configs = append(configs, &volume.UserVolumeConfig{
+			Name:       v.Name,
+			VolumeType: "disk",
+			Provisioning: &volume.ProvisioningSpec{
+				DiskSelector: &volume.DiskSelector{Match: hetznerVolumeSelector(v.Size)},
 			},
+			Filesystem: &volume.FilesystemSpec{Type: v.Format},
 		})
 	}
 
 	return configs
 }
 
-func toEncryptionKeys(keys []core_config.EncryptionKeyConfig) []volume.EncryptionKey {
+// hetznerVolumeSelector selects an attached Hetzner volume by its size in GB,
+// the ID in the serial of the disk is not known before the volume is created.
+func hetznerVolumeSelector(size int) string {
+	return fmt.Sprintf(`disk.model == "Volume" && disk.size == %du * GiB && !system_disk`, size)
+}
+
+// newEncryptionSpec returns the encryption of a partition, keys can only be locked to the STATE partition on other partitions
+func newEncryptionSpec(encryption *core_config.DiskEncryptionConfig, lockToState bool) *volume.EncryptionSpec {
+	return &volume.EncryptionSpec{
+		Provider:  "luks2",
+		Keys:      toEncryptionKeys(encryption.Keys, lockToState),
+		Cipher:    encryption.Cipher,
+		KeySize:   encryption.KeySize,
+		BlockSize: encryption.BlockSize,
+		Options:   encryption.Options,
+	}
+}
+
+func toEncryptionKeys(keys []core_config.EncryptionKeyConfig, lockToState bool) []volume.EncryptionKey {
 	out := make([]volume.EncryptionKey, len(keys))
 	for i, key := range keys {
 		out[i] = volume.EncryptionKey{
-			Slot: key.Slot,
+			Slot:        key.Slot,
+			LockToState: lockToState && key.LockToState,
 		}
 		if key.NodeID != nil {
 			out[i].NodeID = &volume.EncryptionKeyNodeID{}
 		}
+		if key.Static != nil {
+			out[i].Static = &volume.EncryptionKeyStatic{Passphrase: key.Static.Passphrase}
+		}
+		if key.KMS != nil {
+			out[i].KMS = &volume.EncryptionKeyKMS{Endpoint: key.KMS.Endpoint}
+		}
+		if key.TPM != nil {
+			out[i].TPM = &volume.EncryptionKeyTPM{CheckSecurebootStatusOnEnroll: key.TPM.CheckSecurebootStatusOnEnroll}
+			if key.TPM.PCRs != nil {
+				out[i].TPM.Options = &volume.EncryptionKeyTPMOptions{PCRs: key.TPM.PCRs}
+			}
+		}
 	}
 	return out
 }
+
+// toPrivateInterface returns the interface of the private network with the default route through its gateway, if set.
+// Servers without public network only have one interface.
+func toPrivateInterface(args *NodeConfigurationArgs) core.Device {
+	device := core.Device{
+		Interface: privateInterface,
+		DHCP:      true,
+	}
+	if args.PublicNetwork == core_config.PublicNetworkNone {
+		device.Interface = publicInterface
+	}
+
+	if args.DefaultGateway != "" {
+		device.Routes = []core.Route{
+			{
+				Network: "0.0.0.0/0",
+				Gateway: args.DefaultGateway,
+			},
+		}
+	}
+
+	return device
+}
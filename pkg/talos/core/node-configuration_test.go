@@ -8,7 +8,9 @@ import (
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/hetzner/meta"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/config/core"
 	"github.com/exivity/pulumi-hcloud-k8s/pkg/talos/config/volume"
+	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,99 +18,88 @@ func stringPtr(s string) *string {
 	return &s
 }
 
-func Test_toTalosTaints(t *testing.T) {
-	type args struct {
-		taints []core_config.Taint
-	}
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func Test_toNodeTaints(t *testing.T) {
 	tests := []struct {
-		name string
-		args args
-		want string
+		name   string
+		taints []core_config.Taint
+		want   map[string]string
 	}{
 		{
-			name: "empty taints",
-			args: args{
-				taints: []core_config.Taint{},
-			},
-			want: "",
+			name:   "no taints",
+			taints: []core_config.Taint{},
+			want:   nil,
 		},
 		{
 			name: "single taint",
-			args: args{
-				taints: []core_config.Taint{
-					{
-						Key:    "key1",
-						Value:  "value1",
-						Effect: "NoSchedule",
-					},
-				},
+			taints: []core_config.Taint{
+				{Key: "key1", Value: "value1", Effect: "NoSchedule"},
 			},
-			want: "key1=value1:NoSchedule",
+			want: map[string]string{"key1": "value1:NoSchedule"},
 		},
 		{
 			name: "multiple taints",
-			args: args{
-				taints: []core_config.Taint{
-					{
-						Key:    "key1",
-						Value:  "value1",
-						Effect: "NoSchedule",
-					},
-					{
-						Key:    "key2",
-						Value:  "value2",
-						Effect: "NoExecute",
-					},
-				},
+			taints: []core_config.Taint{
+				{Key: "special-workloads", Value: "true", Effect: "PreferNoSchedule"},
+				{Key: "dedicated", Value: "monitoring", Effect: "NoExecute"},
+			},
+			want: map[string]string{
+				"special-workloads": "true:PreferNoSchedule",
+				"dedicated":         "monitoring:NoExecute",
 			},
-			want: "key1=value1:NoSchedule,key2=value2:NoExecute",
 		},
 		{
-			name: "taints with empty value",
-			args: args{
-				taints: []core_config.Taint{
-					{
-						Key:    "node-role",
-						Value:  "",
-						Effect: "NoSchedule",
-					},
-				},
+			name: "taint with empty value",
+			taints: []core_config.Taint{
+				{Key: "node-role", Value: "", Effect: "NoSchedule"},
 			},
-			want: "node-role=:NoSchedule",
+			want: map[string]string{"node-role": ":NoSchedule"},
 		},
 		{
 			name: "complex taint combinations",
-			args: args{
-				taints: []core_config.Taint{
-					{
-						Key:    "special-workloads",
-						Value:  "true",
-						Effect: "PreferNoSchedule",
-					},
-					{
-						Key:    "node-role.kubernetes.io/master",
-						Value:  "",
-						Effect: "NoSchedule",
-					},
-					{
-						Key:    "dedicated",
-						Value:  "monitoring",
-						Effect: "NoExecute",
-					},
-				},
+			taints: []core_config.Taint{
+				{Key: "special-workloads", Value: "true", Effect: "PreferNoSchedule"},
+				{Key: "node-role.kubernetes.io/master", Value: "", Effect: "NoSchedule"},
+				{Key: "dedicated", Value: "monitoring", Effect: "NoExecute"},
+			},
+			want: map[string]string{
+				"special-workloads":              "true:PreferNoSchedule",
+				"node-role.kubernetes.io/master": ":NoSchedule",
+				"dedicated":                      "monitoring:NoExecute",
 			},
-			want: "special-workloads=true:PreferNoSchedule,node-role.kubernetes.io/master=:NoSchedule,dedicated=monitoring:NoExecute",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := toTalosTaints(tt.args.taints); got != tt.want {
-				t.Errorf("toTalosTaints() = %v, want %v", got, tt.want)
-			}
+			assert.Equal(t, tt.want, toNodeTaints(tt.taints))
 		})
 	}
 }
 
+func Test_toNodeTaints_duplicateKeys(t *testing.T) {
+	// machine.nodeTaints can not hold a key with several effects, the config validation rejects them
+	taints := []core_config.Taint{
+		{Key: "dedicated", Value: "monitoring", Effect: "NoSchedule"},
+		{Key: "dedicated", Value: "monitoring", Effect: "NoExecute"},
+	}
+	validate := validator.New()
+	for _, v := range core_config.GetCustomValidations() {
+		require.NoError(t, v.Register(validate))
+	}
+
+	for _, pool := range []interface{}{core_config.NodePoolConfig{}, core_config.ControlPlaneNodePoolConfig{}} {
+		field, ok := reflect.TypeOf(pool).FieldByName("Taints")
+		require.True(t, ok)
+		tag := field.Tag.Get("validate")
+
+		assert.Error(t, validate.Var(taints, tag), "%T", pool)
+		assert.NoError(t, validate.Var(taints[:1], tag), "%T", pool)
+	}
+}
+
 func Test_toRegistriesConfig(t *testing.T) {
 	type args struct {
 		args *core_config.RegistriesConfig
@@ -492,6 +483,11 @@ func Test_toCNIConfig(t *testing.T) {
 				URLs: []string{"https://example.com/cni.yaml"},
 			},
 		},
+		{
+			name: "cilium is installed without a talos cni",
+			cni:  &core_config.CNIConfig{Name: core_config.CNICilium},
+			want: &core.CNIConfig{Name: "none"},
+		},
 		{
 			name: "empty urls",
 			cni: &core_config.CNIConfig{
@@ -513,6 +509,50 @@ func Test_toCNIConfig(t *testing.T) {
 	}
 }
 
+func Test_toProxyConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy *core_config.ProxyConfig
+		cni   *core_config.CNIConfig
+		want  *core.ProxyConfig
+	}{
+		{
+			name:  "nil input",
+			proxy: nil,
+			want:  nil,
+		},
+		{
+			name:  "disabled",
+			proxy: &core_config.ProxyConfig{Disabled: true},
+			want:  &core.ProxyConfig{Disabled: true},
+		},
+		{
+			name: "ipvs mode with extra args",
+			proxy: &core_config.ProxyConfig{
+				Mode:      "ipvs",
+				ExtraArgs: map[string]string{"ipvs-strict-arp": "true"},
+			},
+			want: &core.ProxyConfig{
+				Mode:      "ipvs",
+				ExtraArgs: map[string]string{"ipvs-strict-arp": "true"},
+			},
+		},
+		{
+			name:  "cilium replaces kube-proxy",
+			proxy: &core_config.ProxyConfig{Mode: "ipvs"},
+			cni:   &core_config.CNIConfig{Name: core_config.CNICilium},
+			want:  &core.ProxyConfig{Disabled: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toProxyConfig(tt.proxy, tt.cni); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toProxyConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_newMainTalosConfig(t *testing.T) {
 	tests := []struct {
 		name string // description of this test case
@@ -634,7 +674,90 @@ func Test_newMainTalosConfig(t *testing.T) {
 				},
 			},
 			verify: func(t *testing.T, cfg *core.TalosConfig) {
-				assert.Equal(t, "key=val:NoSchedule", cfg.Machine.Kubelet.ExtraArgs["register-with-taints"])
+				assert.Equal(t, map[string]string{"key": "val:NoSchedule"}, cfg.Machine.NodeTaints)
+				assert.NotContains(t, cfg.Machine.Kubelet.ExtraArgs, "register-with-taints")
+			},
+		},
+		{
+			name: "with proxy disabled",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				Proxy:          &core_config.ProxyConfig{Disabled: true},
+			},
+			verify: func(t *testing.T, cfg *core.TalosConfig) {
+				assert.Equal(t, &core.ProxyConfig{Disabled: true}, cfg.Cluster.Proxy)
+			},
+		},
+		{
+			name: "private interface with public network",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+			},
+			verify: func(t *testing.T, cfg *core.TalosConfig) {
+				assert.Equal(t, []core.Device{{Interface: "eth1", DHCP: true}}, cfg.Machine.Network.Interfaces)
+			},
+		},
+		{
+			name: "IPv6 only with default gateway",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				PublicNetwork:  core_config.PublicNetworkIPv6,
+				DefaultGateway: "10.0.0.1",
+			},
+			verify: func(t *testing.T, cfg *core.TalosConfig) {
+				assert.Equal(t, []core.Device{{
+					Interface: "eth1",
+					DHCP:      true,
+					Routes:    []core.Route{{Network: "0.0.0.0/0", Gateway: "10.0.0.1"}},
+				}}, cfg.Machine.Network.Interfaces)
+			},
+		},
+		{
+			name: "without public network",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				PublicNetwork:  core_config.PublicNetworkNone,
+				DefaultGateway: "10.0.0.1",
+			},
+			verify: func(t *testing.T, cfg *core.TalosConfig) {
+				assert.Equal(t, []core.Device{{
+					Interface: "eth0",
+					DHCP:      true,
+					Routes:    []core.Route{{Network: "0.0.0.0/0", Gateway: "10.0.0.1"}},
+				}}, cfg.Machine.Network.Interfaces)
+			},
+		},
+		{
+			name: "with cert SANs",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.ControlPlaneNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				CertSANs:       []string{"api.cluster.example.com"},
+			},
+			verify: func(t *testing.T, cfg *core.TalosConfig) {
+				assert.Equal(t, []string{"api.cluster.example.com"}, cfg.Machine.CertSANs)
+				assert.Equal(t, &core.APIServerConfig{CertSANs: []string{"api.cluster.example.com"}}, cfg.Cluster.APIServer)
+			},
+		},
+		{
+			name: "without cert SANs",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.ControlPlaneNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+			},
+			verify: func(t *testing.T, cfg *core.TalosConfig) {
+				assert.Empty(t, cfg.Machine.CertSANs)
+				assert.Nil(t, cfg.Cluster.APIServer)
 			},
 		},
 		{
@@ -689,6 +812,25 @@ func TestNewNodeConfiguration(t *testing.T) {
 				assert.Equal(t, "controlplane", talosConfig.Machine.Type)
 			},
 		},
+		{
+			name: "config patches after the generated documents",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				ConfigPatches: []string{
+					"machine:\n  sysctls:\n    net.core.somaxconn: \"65535\"\n",
+					"- op: add\n  path: /machine/kernel/modules\n  value: [{name: br_netfilter}]\n",
+				},
+			},
+			wantLen: 3,
+			wantErr: false,
+			verify: func(t *testing.T, configs []string) {
+				assert.Contains(t, configs[0], "type: worker")
+				assert.Equal(t, "machine:\n  sysctls:\n    net.core.somaxconn: \"65535\"\n", configs[1])
+				assert.Equal(t, "- op: add\n  path: /machine/kernel/modules\n  value: [{name: br_netfilter}]\n", configs[2])
+			},
+		},
 		{
 			name: "with disk encryption",
 			args: &NodeConfigurationArgs{
@@ -726,6 +868,176 @@ func TestNewNodeConfiguration(t *testing.T) {
 				assert.Equal(t, "luks2", ephemeralConfig.Encryption.Provider)
 			},
 		},
+		{
+			name: "with volumes",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				Volumes: []core_config.NodeVolumeConfig{
+					{Name: "longhorn", Size: 100, Format: "xfs"},
+					{Name: "raw", Size: 50, Format: "xfs", Automount: boolPtr(false)},
+				},
+			},
+			wantLen: 2,
+			wantErr: false,
+			verify: func(t *testing.T, configs []string) {
+				var userVolumeConfig volume.UserVolumeConfig
+				err := yaml.Unmarshal([]byte(configs[1]), &userVolumeConfig)
+				assert.NoError(t, err)
+				assert.Equal(t, "UserVolumeConfig", userVolumeConfig.Kind)
+				assert.Equal(t, "longhorn", userVolumeConfig.Name)
+				assert.Equal(t, "disk", userVolumeConfig.VolumeType)
+				assert.Equal(t, `disk.model == "Volume" && disk.size == 100u * GiB && !system_disk`, userVolumeConfig.Provisioning.DiskSelector.Match)
+				assert.Equal(t, "xfs", userVolumeConfig.Filesystem.Type)
+			},
+		},
+		{
+			name: "with ephemeral on a volume and image cache",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				DiskEncryption: &core_config.DiskEncryptionConfig{
+					EncryptEphemeral: true,
+					Keys:             []core_config.EncryptionKeyConfig{{Slot: 0, NodeID: &core_config.EncryptionKeyNodeID{}}},
+				},
+				Volumes:    []core_config.NodeVolumeConfig{{Name: "var", Size: 200, Format: "xfs"}},
+				Ephemeral:  &core_config.EphemeralConfig{MaxSize: "150GiB", Grow: boolPtr(false), Volume: "var"},
+				ImageCache: &core_config.ImageCacheConfig{Enabled: true, MaxSize: "2GiB"},
+			},
+			wantLen: 3,
+			wantErr: false,
+			verify: func(t *testing.T, configs []string) {
+				var mainConfig core.TalosConfig
+				err := yaml.Unmarshal([]byte(configs[0]), &mainConfig)
+				assert.NoError(t, err)
+				assert.True(t, mainConfig.Machine.Features.ImageCache.LocalEnabled)
+
+				// encryption and provisioning share the EPHEMERAL document, the volume is not mounted
+				var ephemeralConfig volume.VolumeConfig
+				err = yaml.Unmarshal([]byte(configs[1]), &ephemeralConfig)
+				assert.NoError(t, err)
+				assert.Equal(t, "EPHEMERAL", ephemeralConfig.Name)
+				assert.NotNil(t, ephemeralConfig.Encryption)
+				assert.Equal(t, "150GiB", ephemeralConfig.Provisioning.MaxSize)
+				assert.Equal(t, boolPtr(false), ephemeralConfig.Provisioning.Grow)
+				assert.Equal(t, `disk.model == "Volume" && disk.size == 200u * GiB && !system_disk`, ephemeralConfig.Provisioning.DiskSelector.Match)
+
+				var imageCacheConfig volume.VolumeConfig
+				err = yaml.Unmarshal([]byte(configs[2]), &imageCacheConfig)
+				assert.NoError(t, err)
+				assert.Equal(t, "IMAGECACHE", imageCacheConfig.Name)
+				assert.Equal(t, "2GiB", imageCacheConfig.Provisioning.MaxSize)
+			},
+		},
+		{
+			name: "with ephemeral on an unknown volume",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.ControlPlaneNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				Ephemeral:      &core_config.EphemeralConfig{Volume: "var"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "with encrypted swap",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				Swap:           &core_config.SwapConfig{Size: "4GiB", Encrypted: true, Behavior: "LimitedSwap"},
+			},
+			wantLen: 2,
+			wantErr: false,
+			verify: func(t *testing.T, configs []string) {
+				var mainConfig core.TalosConfig
+				err := yaml.Unmarshal([]byte(configs[0]), &mainConfig)
+				assert.NoError(t, err)
+				assert.Equal(t, map[string]interface{}{"memorySwap": map[string]interface{}{"swapBehavior": "LimitedSwap"}}, mainConfig.Machine.Kubelet.ExtraConfig)
+
+				var swapConfig volume.SwapVolumeConfig
+				err = yaml.Unmarshal([]byte(configs[1]), &swapConfig)
+				assert.NoError(t, err)
+				assert.Equal(t, "SwapVolumeConfig", swapConfig.Kind)
+				assert.Equal(t, "system_disk", swapConfig.Provisioning.DiskSelector.Match)
+				assert.Equal(t, "4GiB", swapConfig.Provisioning.MinSize)
+				assert.Equal(t, "4GiB", swapConfig.Provisioning.MaxSize)
+				assert.NotNil(t, swapConfig.Encryption.Keys[0].NodeID)
+			},
+		},
+		{
+			name: "with swap on a volume",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				Volumes:        []core_config.NodeVolumeConfig{{Name: "swap", Size: 10, Format: "xfs"}},
+				Swap:           &core_config.SwapConfig{Size: "9GiB", Behavior: "NoSwap", Volume: "swap"},
+			},
+			wantLen: 2,
+			wantErr: false,
+			verify: func(t *testing.T, configs []string) {
+				var swapConfig volume.SwapVolumeConfig
+				err := yaml.Unmarshal([]byte(configs[1]), &swapConfig)
+				assert.NoError(t, err)
+				assert.Equal(t, `disk.model == "Volume" && disk.size == 10u * GiB && !system_disk`, swapConfig.Provisioning.DiskSelector.Match)
+				assert.Nil(t, swapConfig.Encryption)
+			},
+		},
+		{
+			name: "with swap on an unknown volume",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				Swap:           &core_config.SwapConfig{Size: "4GiB", Volume: "swap"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "with disk encryption key types",
+			args: &NodeConfigurationArgs{
+				ServerNodeType: meta.WorkerNode,
+				Subnet:         "10.0.0.0/24",
+				PodSubnets:     "10.244.0.0/16",
+				DiskEncryption: &core_config.DiskEncryptionConfig{
+					EncryptState:     true,
+					EncryptEphemeral: true,
+					Cipher:           "aes-xts-plain64",
+					KeySize:          512,
+					BlockSize:        4096,
+					Options:          []string{"no_read_workqueue"},
+					Keys: []core_config.EncryptionKeyConfig{
+						{Slot: 0, Static: &core_config.EncryptionKeyStatic{Passphrase: "passphrase"}},
+						{Slot: 1, KMS: &core_config.EncryptionKeyKMS{Endpoint: "https://10.0.0.10:4050"}, LockToState: true},
+						{Slot: 2, TPM: &core_config.EncryptionKeyTPM{PCRs: []int{}, CheckSecurebootStatusOnEnroll: true}},
+					},
+				},
+			},
+			wantLen: 3,
+			wantErr: false,
+			verify: func(t *testing.T, configs []string) {
+				var stateConfig volume.VolumeConfig
+				err := yaml.Unmarshal([]byte(configs[1]), &stateConfig)
+				assert.NoError(t, err)
+				assert.Equal(t, "aes-xts-plain64", stateConfig.Encryption.Cipher)
+				assert.Equal(t, uint(512), stateConfig.Encryption.KeySize)
+				assert.Equal(t, uint64(4096), stateConfig.Encryption.BlockSize)
+				assert.Equal(t, []string{"no_read_workqueue"}, stateConfig.Encryption.Options)
+				assert.Equal(t, "passphrase", stateConfig.Encryption.Keys[0].Static.Passphrase)
+				assert.Equal(t, "https://10.0.0.10:4050", stateConfig.Encryption.Keys[1].KMS.Endpoint)
+				assert.False(t, stateConfig.Encryption.Keys[1].LockToState, "STATE can not be locked to itself")
+				assert.True(t, stateConfig.Encryption.Keys[2].TPM.CheckSecurebootStatusOnEnroll)
+				assert.Equal(t, []int{}, stateConfig.Encryption.Keys[2].TPM.Options.PCRs, "an empty list disables the PCR binding")
+
+				var ephemeralConfig volume.VolumeConfig
+				err = yaml.Unmarshal([]byte(configs[2]), &ephemeralConfig)
+				assert.NoError(t, err)
+				assert.True(t, ephemeralConfig.Encryption.Keys[1].LockToState)
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -47,14 +47,16 @@ type Images struct {
 	X86 *Image
 	// TalosImageID is the ID of the Talos image to upload.
 	TalosImageID string
+	// TalosVersion is the version of the uploaded Talos images.
+	TalosVersion string
 }
 
 // NewImages uploads Talos images for both architectures to Hetzner Cloud
-func NewImages(ctx *pulumi.Context, args *ImagesArgs, opts ...pulumi.ResourceOption) (*Images, error) {
+func NewImages(ctx *pulumi.Context, name string, args *ImagesArgs, opts ...pulumi.ResourceOption) (*Images, error) {
 	var err error
 	var arm *Image
 	if args.EnableARMImageUpload {
-		arm, err = NewImage(ctx, &ImageArgs{
+		arm, err = NewImage(ctx, name, &ImageArgs{
 			HetznerToken:            args.HetznerToken,
 			TalosVersion:            args.TalosVersion,
 			TalosImageID:            args.TalosImageID,
@@ -69,7 +71,7 @@ func NewImages(ctx *pulumi.Context, args *ImagesArgs, opts ...pulumi.ResourceOpt
 
 	var x86 *Image
 	if args.EnableX86ImageUpload {
-		x86, err = NewImage(ctx, &ImageArgs{
+		x86, err = NewImage(ctx, name, &ImageArgs{
 			HetznerToken:            args.HetznerToken,
 			TalosVersion:            args.TalosVersion,
 			TalosImageID:            args.TalosImageID,
@@ -86,6 +88,7 @@ func NewImages(ctx *pulumi.Context, args *ImagesArgs, opts ...pulumi.ResourceOpt
 		ARM:          arm,
 		X86:          x86,
 		TalosImageID: args.TalosImageID,
+		TalosVersion: args.TalosVersion,
 	}, nil
 }
 
@@ -113,7 +116,7 @@ type Image struct {
 }
 
 // NewImage uploads a Talos image to Hetzner Cloud using the hcloud-upload-image package.
-func NewImage(ctx *pulumi.Context, args *ImageArgs, opts ...pulumi.ResourceOption) (*Image, error) {
+func NewImage(ctx *pulumi.Context, name string, args *ImageArgs, opts ...pulumi.ResourceOption) (*Image, error) {
 	if args.Arch != ArchARM && args.Arch != ArchX86 {
 		return nil, ErrUnknownArchitecture
 	}
@@ -129,10 +132,10 @@ func NewImage(ctx *pulumi.Context, args *ImageArgs, opts ...pulumi.ResourceOptio
 		return nil, ErrUnknownArchitecture
 	}
 
-	name := fmt.Sprintf("talos-%s-%s", arch, args.TalosVersion)
+	imageName := fmt.Sprintf("talos-%s-%s", arch, args.TalosVersion)
 
-	snapshot, err := hcloudimages.NewUploadedImage(ctx, name, &hcloudimages.UploadedImageArgs{
-		Description:      pulumi.Sprintf("%s - %s", name, time.Now().Format(time.RFC3339)),
+	snapshot, err := hcloudimages.NewUploadedImage(ctx, fmt.Sprintf("%s-%s", name, imageName), &hcloudimages.UploadedImageArgs{
+		Description:      pulumi.Sprintf("%s - %s", imageName, time.Now().Format(time.RFC3339)),
 		HcloudToken:      pulumi.String(args.HetznerToken),
 		Architecture:     pulumi.String(arch),
 		ImageUrl:         pulumi.Sprintf("https://factory.talos.dev/image/%s/%s/hcloud-%s.raw.xz", args.TalosImageID, args.TalosVersion, args.Arch),
@@ -146,7 +149,8 @@ func NewImage(ctx *pulumi.Context, args *ImageArgs, opts ...pulumi.ResourceOptio
 			"project":       pulumi.String(ctx.Project()),
 		},
 	}, append(opts,
-		pulumi.IgnoreChanges([]string{"description"}))...,
+		pulumi.IgnoreChanges([]string{"description"}),
+		pulumi.Aliases([]pulumi.Alias{{Name: pulumi.String(imageName)}}))...,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,21 @@
+package validators
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// DurationTag is the validation tag of fields which must hold a positive Go duration string, like "30s" or "10m"
+const DurationTag = "duration"
+
+// ValidateDuration checks that the field is a positive Go duration string.
+// It is used with the `duration` tag, after the `default` tag has set the default value.
+func ValidateDuration(fl validator.FieldLevel) bool {
+	duration, err := time.ParseDuration(fl.Field().String())
+	if err != nil {
+		return false
+	}
+
+	return duration > 0
+}
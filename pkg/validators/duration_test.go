@@ -0,0 +1,41 @@
+package validators
+
+import (
+	"testing"
+
+	validatorV10 "github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDuration(t *testing.T) {
+	type testConfig struct {
+		Timeout string `validate:"duration"`
+	}
+
+	tests := []struct {
+		name    string
+		timeout string
+		wantErr bool
+	}{
+		{name: "seconds", timeout: "30s"},
+		{name: "combined", timeout: "1h30m"},
+		{name: "empty", timeout: "", wantErr: true},
+		{name: "without unit", timeout: "10", wantErr: true},
+		{name: "zero", timeout: "0s", wantErr: true},
+		{name: "negative", timeout: "-5m", wantErr: true},
+		{name: "invalid", timeout: "ten minutes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validate := validatorV10.New()
+			assert.NoError(t, validate.RegisterValidation(DurationTag, ValidateDuration))
+
+			err := validate.Struct(testConfig{Timeout: tt.timeout})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
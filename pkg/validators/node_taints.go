@@ -0,0 +1,38 @@
+package validators
+
+import (
+	"reflect"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// OneTaintPerKeyTag is the validation tag of taint lists which must hold one value and effect per key.
+// Talos machine.nodeTaints maps every key to a single "value:effect", so Kubernetes taints which share a key
+// with different values or effects can not be expressed.
+const OneTaintPerKeyTag = "one_taint_per_key"
+
+// ValidateOneTaintPerKey checks that the taints of the slice only repeat a key with the same value and effect.
+// Note: This function works with reflection on the Key, Value and Effect fields to avoid import cycles
+func ValidateOneTaintPerKey(fl validator.FieldLevel) bool {
+	taints := fl.Field()
+	if taints.Kind() != reflect.Slice {
+		return false
+	}
+
+	valueEffects := make(map[string]string, taints.Len())
+	for i := 0; i < taints.Len(); i++ {
+		taint := reflect.Indirect(taints.Index(i))
+		if taint.Kind() != reflect.Struct {
+			return false
+		}
+
+		key := taint.FieldByName("Key").String()
+		valueEffect := taint.FieldByName("Value").String() + ":" + taint.FieldByName("Effect").String()
+		if existing, ok := valueEffects[key]; ok && existing != valueEffect {
+			return false
+		}
+		valueEffects[key] = valueEffect
+	}
+
+	return true
+}
@@ -0,0 +1,70 @@
+package validators
+
+import (
+	"testing"
+
+	validatorV10 "github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateOneTaintPerKey(t *testing.T) {
+	type taint struct {
+		Key    string
+		Value  string
+		Effect string
+	}
+	type testConfig struct {
+		Taints []taint `validate:"one_taint_per_key"`
+	}
+
+	tests := []struct {
+		name    string
+		taints  []taint
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "different keys",
+			taints: []taint{
+				{Key: "dedicated", Value: "monitoring", Effect: "NoSchedule"},
+				{Key: "gpu", Value: "true", Effect: "NoSchedule"},
+			},
+		},
+		{
+			name: "repeated taint",
+			taints: []taint{
+				{Key: "dedicated", Value: "monitoring", Effect: "NoSchedule"},
+				{Key: "dedicated", Value: "monitoring", Effect: "NoSchedule"},
+			},
+		},
+		{
+			name: "key with several effects",
+			taints: []taint{
+				{Key: "dedicated", Value: "monitoring", Effect: "NoSchedule"},
+				{Key: "dedicated", Value: "monitoring", Effect: "NoExecute"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "key with several values",
+			taints: []taint{
+				{Key: "dedicated", Value: "monitoring", Effect: "NoSchedule"},
+				{Key: "dedicated", Value: "logging", Effect: "NoSchedule"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validate := validatorV10.New()
+			assert.NoError(t, validate.RegisterValidation(OneTaintPerKeyTag, ValidateOneTaintPerKey))
+
+			err := validate.Struct(testConfig{Taints: tt.taints})
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}